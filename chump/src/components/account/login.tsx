@@ -44,6 +44,12 @@ export class Login extends RootComponent<ILoginProps, ILoginState> {
           }
         } else {
           this.props.loginCallback(this.state.username, response.user_id);
+          const uri = this.interactionURI();
+          if (uri !== null) {
+            // Interactions are resolved by the server, not within the app.
+            window.location.assign("/authorize_interaction?uri=" + encodeURIComponent(uri));
+            return;
+          }
           this.setState({
             redirect: true,
           });
@@ -95,6 +101,15 @@ export class Login extends RootComponent<ILoginProps, ILoginState> {
     );
   }
 
+  // interactionURI is the profile or post the user was sent here to interact
+  // with by another server, if any.
+  private interactionURI(): string | null {
+    if (this.props.location === undefined) {
+      return null;
+    }
+    return new URLSearchParams(this.props.location.search).get("uri");
+  }
+
   private handleUsername(event: React.ChangeEvent<HTMLInputElement>) {
     const target = event.target;
     this.setState({
@@ -57,6 +57,8 @@ cp -R services/activities/create build_out/activities/
 cp -R services/activities/delete build_out/activities/
 cp -R services/activities/undo build_out/activities/
 cp -R services/activities/update build_out/activities/
+cp -R services/activities/flag build_out/activities/
+cp -R services/activities/move build_out/activities/
 cp -R services/activities/follow build_out/activities/
 cp -R services/activities/like build_out/activities/
 cp -R services/activities/announce build_out/activities/
@@ -17,6 +17,11 @@ export RABBLE_NETWORK_CONFIG="external: true"
 export RABBLE_DBPATH="/repo/rabble2.db"
 export RABBLE_EXTERNAL_ADDRESS="skinny_2:1917"
 export RABBLE_INSTANCE_BLACKLIST_FILE="/repo/config/instance_blacklist"
+export RABBLE_INSTANCE_ALLOWLIST_FILE=""
+export RABBLE_ADMIN_USERS=""
+export RABBLE_INBOX_QUEUE_DIR="/repo/inbox_queue2"
+export RABBLE_SEEN_ACTIVITIES_FILE="/repo/seen_activities2"
+export RABBLE_ALLOW_PRIVATE_FETCHES="true"
 
 python3 build_out/containers/compose_builder.py \
   --template="build_out/containers/docker-compose.tmpl.yml" \
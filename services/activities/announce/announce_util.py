@@ -17,7 +17,8 @@ class AnnounceUtil:
             "published": published,
         }
 
-    def send_announce_activity(self, target_list, activity, response):
+    def send_announce_activity(self, target_list, activity, response,
+                               sender_id=None):
         # go through all targets and send announce activity
         # TODO (sailslick) make async/ parallel in the future
         for target in target_list:
@@ -27,7 +28,8 @@ class AnnounceUtil:
             target_actor = self._activ_util.build_actor(target.handle, host)
             activity["target"] = target_actor
             inbox = self._activ_util.build_inbox_url(target.handle, host)
-            resp, err = self._activ_util.send_activity(activity, inbox)
+            resp, err = self._activ_util.send_activity(
+                activity, inbox, sender_id=sender_id)
             if err is not None:
                 response.result_type = general_pb2.ResultType.ERROR
                 response.error = err
@@ -1,7 +1,6 @@
 from services.proto import database_pb2 as db_pb
 from services.proto import article_pb2
 from services.proto import general_pb2
-from activities.announce.announce_util import AnnounceUtil
 
 
 class ReceiveAnnounceServicer:
@@ -12,8 +11,6 @@ class ReceiveAnnounceServicer:
         self._activ_util = activ_util
         # Use the hostname passed in or get it manually
         self._hostname = hostname if hostname else self._activ_util._hostname
-        self._announce_util = AnnounceUtil(
-            logger, db, activ_util, self._hostname)
         self._article_stub = article_stub
 
     def get_user_by_ap_id(self, actor_tuple):
@@ -40,20 +37,6 @@ class ReceiveAnnounceServicer:
             error="Could not parse {} author id".format(actor_name),
         )
 
-    def send_to_followers(self, author, announce_time, announcer_id, announced_object, response):
-        parsed_ts = self._activ_util.timestamp_to_rfc(announce_time)
-        activity = self._announce_util.build_announce_activity(
-            announcer_id, announced_object, parsed_ts)
-
-        # Create a list of foreign followers
-        follow_list = self._users_util.get_follower_list(author.global_id)
-        foreign_follows = self._users_util.remove_local_users(follow_list)
-
-        # Send activity to all followers
-        response = self._announce_util.send_announce_activity(
-            foreign_follows, activity, response)
-        return response
-
     def create_post(self, author, req):
         self._logger.debug("Calling article service with new foreign article")
         # set flag in article service that is foreign (so no need to create service)
@@ -202,23 +185,14 @@ class ReceiveAnnounceServicer:
                     self._logger.debug(
                         "Target is local but not author, returning success")
                     return response
-                # if target, add to shares db, update share count, send to followers
+                # if target, add to shares db and update share count.
+                # The announce isn't passed on to the author's followers, as
+                # it's the announcer's and can't be signed by the author.
                 err_resp = self.add_share_update_count(
                     announcer, article, req.announce_time)
                 if err_resp is not None:
                     return err_resp
-                article_url = self._activ_util.build_local_article_url(
-                    author, article)
-                timestamp = self._activ_util.timestamp_to_rfc(
-                    article.creation_datetime)
-                article_obj = self._activ_util.build_article(
-                    req.announced_object, article.title, timestamp,
-                    req.author_ap_id, article.md_body, article.summary,
-                    article_url=article_url,
-                )
-                return self.send_to_followers(author, req.announce_time,
-                                              req.announcer_id,
-                                              article_obj, response)
+                return response
 
         # At this point, author, announcer and article all exist.
         err_resp = self.add_share_update_count(
@@ -100,8 +100,13 @@ class SendAnnounceServicer:
         if announcer not in foreign_follows:
             foreign_follows.append(announcer)
 
+        # Anyone who has blocked the announcer gets nothing from them
+        foreign_follows = self._users_util.remove_blocking_users(
+            announcer.global_id, foreign_follows)
+
         # Send activity to all followers
         response = self._announce_util.send_announce_activity(
-            foreign_follows, announce_activity, response)
+            foreign_follows, announce_activity, response,
+            sender_id=announcer.global_id)
 
         return response
@@ -12,11 +12,16 @@ class ReceiveCreateServicer:
         self._logger = logger
         self._users_util = users_util
 
-    def _get_actor_ids(self, author, follower):
+    def _get_actor_ids(self, author, follower, may_be_new=False):
         # parse_actor parses form host/@actor and returns (host, actor)
         author_user = self._users_util.parse_actor(author)
 
-        author_entry = self._users_util.get_user_from_db(
+        # Anyone may reply to a post or mention the recipient, so their
+        # authors may be new to us.
+        get_author = self._users_util.get_user_from_db
+        if may_be_new:
+            get_author = self._users_util.get_or_create_user_from_db
+        author_entry = get_author(
             handle=author_user[1],
             host=author_user[0]
         )
@@ -54,17 +59,34 @@ class ReceiveCreateServicer:
             return False
 
         if len(follow_resp.results) != 1:
-            self._logger.error("No record of follow for foreign article")
+            self._logger.info("No record of follow for foreign article")
             return False
 
         return True
 
-    def _add_to_posts_db(self, author_id, req):
+    def _list_article(self, article):
+        self._logger.info("Listing article %d", article.global_id)
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.UPDATE,
+            match=database_pb2.PostsEntry(global_id=article.global_id),
+        )
+        req.entry.unlisted.value = False
+        resp = self._db_stub.Posts(req)
+        if resp.result_type != general_pb2.ResultType.OK:
+            self._logger.error("Could not list article: %s", resp.error)
+            return False
+        return True
+
+    def _add_to_posts_db(self, author_id, req, unlisted):
         self._logger.debug("Calling article service with new foreign article")
 
         # check if in posts db
         article = get_article(self._logger, self._db_stub, ap_id=req.id)
         if article is not None:
+            # It may have been kept only for a mention before a follower of
+            # its author received it.
+            if article.unlisted.value and not unlisted:
+                return self._list_article(article)
             return True
 
         # set flag in article service that is foreign (so no need to create service)
@@ -76,6 +98,9 @@ class ReceiveCreateServicer:
             foreign=True,
             ap_id=req.id,
             summary=req.summary,
+            in_reply_to=req.in_reply_to,
+            mentions=req.mentions,
+            unlisted=unlisted,
         )
         article_resp = self._article_stub.CreateNewArticle(na)
         if article_resp.result_type == general_pb2.ResultType.ERROR:
@@ -91,20 +116,29 @@ class ReceiveCreateServicer:
         resp = general_pb2.GeneralResponse()
 
         # get actor ids
+        is_reply = req.in_reply_to != 0
+        mentions_recipient = req.recipient in req.mentions
         author_id, follower_id = self._get_actor_ids(
-            req.attributedTo, req.recipient)
+            req.attributedTo, req.recipient,
+            may_be_new=is_reply or mentions_recipient)
         if author_id is None:
             resp.result_type = general_pb2.ResultType.ERROR_400
             return resp
 
-        # check if local user follows
-        follower_flag = self._check_follow(author_id, follower_id)
-        if follower_flag is False:
-            resp.result_type = general_pb2.ResultType.ERROR
-            return resp
+        # check if local user follows, unless this replies to a post we
+        # have. Posts mentioning the recipient are accepted from anyone, but
+        # are kept out of feeds and search unless the recipient follows
+        # their author.
+        unlisted = False
+        if not is_reply:
+            follower_flag = self._check_follow(author_id, follower_id)
+            if follower_flag is False and not mentions_recipient:
+                resp.result_type = general_pb2.ResultType.ERROR
+                return resp
+            unlisted = follower_flag is False
 
         # add to article db
-        added_flag = self._add_to_posts_db(author_id, req)
+        added_flag = self._add_to_posts_db(author_id, req, unlisted)
         if added_flag is False:
             resp.result_type = general_pb2.ResultType.ERROR
             return resp
@@ -2,6 +2,7 @@ import urllib3
 
 from services.proto import general_pb2
 from services.proto import database_pb2
+from utils.articles import get_article, get_mentioned_users
 
 
 class SendCreateServicer:
@@ -29,22 +30,31 @@ class SendCreateServicer:
             return "Error inserting ap_id into DB: " + str(resp.error)
         return None
 
-    # follower is (host, handle)
-    def _post_create_req(self, follower, req, ap_id, author, article_url):
-        target = self._activ_util.build_actor(follower.handle, follower.host)
+    def _get_parent(self, global_id):
+        """
+        Returns the ActivityPub id and author of the post with the given
+        global_id, or (None, None) if it can't be found.
+        """
+        parent = get_article(self._logger, self._db_stub, global_id=global_id)
+        if parent is None:
+            return None, None
+        author = self._users_util.get_user_from_db(global_id=parent.author_id)
+        if author is None:
+            return None, None
+        return self._activ_util.build_article_ap_id(author, parent), author
+
+    def _build_create(self, req, ap_id, author, article_url,
+                      in_reply_to=None, tags=None, mentioned_ids=None):
         actor = self._activ_util.build_actor(author.handle, self._host_name)
         timestamp = req.creation_datetime.ToJsonString()
-        article = self._activ_util.build_article(
-            ap_id, req.title, timestamp, actor, req.body,
-            req.summary, article_url=article_url)
-        create_activity = {
-            "@context":  self._activ_util.rabble_context(),
-            "type": "Create",
-            "to": [target],
-            "actor": actor,
-            "object": article,
-        }
+        article = self._activ_util.build_local_article(
+            ap_id, req.title, timestamp, actor, req.body, req.summary,
+            article_url, tags=tags, mentioned_ids=mentioned_ids,
+            in_reply_to=in_reply_to, private=author.private.value)
+        return self._activ_util.build_create(article)
 
+    # follower is (host, handle)
+    def _post_create_req(self, follower, create_activity, author):
         target_inbox = self._activ_util.build_inbox_url(
             follower.handle, follower.host)
 
@@ -74,15 +84,47 @@ class SendCreateServicer:
         if err is not None:
             self._logger.error("Continuing through error: %s", err)
 
+        in_reply_to, parent_author = None, None
+        if req.in_reply_to:
+            in_reply_to, parent_author = self._get_parent(req.in_reply_to)
+            if in_reply_to is None:
+                self._logger.error(
+                    "Could not find post %d replied to", req.in_reply_to)
+
+        tags, mentioned_ids = None, None
+        mentioned = get_mentioned_users(
+            self._logger, self._db_stub, self._users_util, req.global_id)
+        article = get_article(self._logger, self._db_stub,
+                              global_id=req.global_id)
+        if article is not None:
+            tags, mentioned_ids = self._activ_util.build_article_tags(
+                article, mentioned)
+
         # list of follow objects
         follow_list = self._users_util.get_follower_list(author.global_id)
         # remove local users
         foreign_follows = self._users_util.remove_local_users(follow_list)
+        # The author of the post replied to and the users mentioned are sent
+        # the article, even if they don't follow its author.
+        addressed = list(mentioned)
+        if parent_author is not None:
+            addressed.append(parent_author)
+        for user in addressed:
+            if (user.host and
+                    all(f.global_id != user.global_id
+                        for f in foreign_follows)):
+                foreign_follows.append(user)
+        foreign_follows = self._users_util.remove_blocking_users(
+            author.global_id, foreign_follows)
+
+        create_activity = self._build_create(
+            req, ap_id, author, article_url, in_reply_to=in_reply_to,
+            tags=tags, mentioned_ids=mentioned_ids)
 
         # go through follow send create activity
         # TODO (sailslick) make async/ parallel in the future
         for follower in foreign_follows:
-            self._post_create_req(follower, req, ap_id, author, article_url)
+            self._post_create_req(follower, create_activity, author)
 
         resp = general_pb2.GeneralResponse()
         resp.result_type = general_pb2.ResultType.OK
@@ -0,0 +1,93 @@
+import unittest
+from unittest.mock import Mock
+
+from receive_create_servicer import ReceiveCreateServicer
+from services.proto import article_pb2
+from services.proto import create_pb2
+from services.proto import database_pb2
+from services.proto import general_pb2
+
+
+class MockDB:
+    def __init__(self, following):
+        self.following = following
+        self.posts = []
+        self.updates = []
+
+    def Follow(self, req):
+        results = [req.match] if self.following else []
+        return database_pb2.DbFollowResponse(
+            result_type=general_pb2.ResultType.OK, results=results)
+
+    def Posts(self, req):
+        if req.request_type == database_pb2.RequestType.UPDATE:
+            self.updates.append(req)
+            return database_pb2.PostsResponse(
+                result_type=general_pb2.ResultType.OK)
+        return database_pb2.PostsResponse(
+            result_type=general_pb2.ResultType.OK, results=self.posts)
+
+
+class ReceiveCreateServicerTest(unittest.TestCase):
+
+    def setUp(self):
+        self.db = MockDB(following=False)
+        self.article = Mock()
+        self.article.CreateNewArticle.return_value = \
+            article_pb2.NewArticleResponse(
+                result_type=general_pb2.ResultType.OK)
+        users_util = Mock()
+        users_util.parse_actor = lambda x: ('remote.test', 'sender')
+        users_util.get_user_from_db.return_value = \
+            database_pb2.UsersEntry(global_id=1)
+        users_util.get_or_create_user_from_db.return_value = \
+            database_pb2.UsersEntry(global_id=2)
+        self.servicer = ReceiveCreateServicer(
+            self.db, self.article, Mock(), users_util)
+
+    def create(self, recipient='alice', mentions=()):
+        req = create_pb2.NewForeignArticle(
+            attributedTo='remote.test/ap/@sender',
+            recipient=recipient,
+            id='remote.test/ap/@sender/1',
+            mentions=mentions,
+        )
+        return self.servicer.ReceiveCreate(req, None)
+
+    def test_article_from_followed_user(self):
+        self.db.following = True
+        resp = self.create()
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        na = self.article.CreateNewArticle.call_args[0][0]
+        self.assertFalse(na.unlisted)
+
+    def test_article_from_stranger(self):
+        resp = self.create()
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.article.CreateNewArticle.assert_not_called()
+
+    def test_mention_of_recipient_is_unlisted(self):
+        resp = self.create(mentions=['alice'])
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        na = self.article.CreateNewArticle.call_args[0][0]
+        self.assertTrue(na.unlisted)
+        self.assertEqual(list(na.mentions), ['alice'])
+
+    def test_mention_of_someone_else(self):
+        resp = self.create(mentions=['bob'])
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.article.CreateNewArticle.assert_not_called()
+
+    def test_follower_lists_unlisted_article(self):
+        post = database_pb2.PostsEntry(global_id=5)
+        post.unlisted.value = True
+        self.db.posts = [post]
+        self.db.following = True
+        resp = self.create()
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        self.assertEqual(len(self.db.updates), 1)
+        self.assertEqual(self.db.updates[0].match.global_id, 5)
+        self.assertTrue(self.db.updates[0].entry.HasField('unlisted'))
+        self.assertFalse(self.db.updates[0].entry.unlisted.value)
+        self.article.CreateNewArticle.assert_not_called()
+
@@ -1,6 +1,6 @@
 from services.proto import delete_pb2 as dpb
 from services.proto import general_pb2
-from utils.articles import delete_article, get_article, get_sharers_of_article
+from utils.articles import delete_article, get_article
 
 
 class ReceiveDeleteServicer:
@@ -29,25 +29,20 @@ class ReceiveDeleteServicer:
                 result_type=general_pb2.ResultType.ERROR,
                 error="Could not retrieve author",
             )
-        # Grab the people who shared the article before we delete everything.
-        sharer_ids = get_sharers_of_article(
-            self._logger, self._db, article.global_id)
-        # Delete the local copy.
+        if not self._users_util.is_actor_of(req.actor, author):
+            self._logger.warning("%s may not delete article %s",
+                                 req.actor, req.ap_id)
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR_401,
+                error="Only the author can delete an article",
+            )
+        # Delete the local copy. The delete isn't passed on to the followers
+        # of those who shared it, as it can only be signed by the author.
         if not delete_article(self._logger, self._db, ap_id=req.ap_id):
             return general_pb2.GeneralResponse(
                 result_type=general_pb2.ResultType.ERROR,
                 error="Could not delete article",
             )
-        # Forward the delete to the announcers.
-        delete_obj = self._activ_util.build_delete(
-            author, article, self._hostname)
-        for user_id in sharer_ids:
-            err = self._activ_util.forward_activity_to_followers(
-                user_id, delete_obj)
-            if err is not None:
-                # Warn but do not quit on error sending to announcer followers.
-                self._logger.warning(
-                    "Sending activity to %d followers failed", user_id)
         return general_pb2.GeneralResponse(
             result_type=general_pb2.ResultType.OK
         )
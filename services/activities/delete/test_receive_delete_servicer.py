@@ -0,0 +1,41 @@
+import unittest
+from unittest.mock import Mock, patch
+
+from activities.delete.receive_delete_servicer import ReceiveDeleteServicer
+from services.proto import database_pb2
+from services.proto import delete_pb2
+from services.proto import general_pb2
+
+SERVICER = 'activities.delete.receive_delete_servicer.'
+
+
+class ReceiveDeleteServicerTest(unittest.TestCase):
+
+    def setUp(self):
+        self.users_util = Mock()
+        self.users_util.get_user_from_db.return_value = \
+            database_pb2.UsersEntry(global_id=2, handle='sender',
+                                    host='https://remote.test')
+        self.servicer = ReceiveDeleteServicer(
+            Mock(), Mock(), Mock(), self.users_util, hostname='b.com')
+        self.req = delete_pb2.ReceivedDeleteDetails(
+            ap_id='https://remote.test/notes/1',
+            actor='https://remote.test/ap/@sender')
+        article = database_pb2.PostsEntry(global_id=5, author_id=2)
+        for name, ret in (('get_article', article),
+                          ('delete_article', True)):
+            p = patch(SERVICER + name, return_value=ret)
+            setattr(self, name, p.start())
+            self.addCleanup(p.stop)
+
+    def test_delete_by_author(self):
+        self.users_util.is_actor_of.return_value = True
+        resp = self.servicer.ReceiveDeleteActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        self.delete_article.assert_called_once()
+
+    def test_delete_by_someone_else(self):
+        self.users_util.is_actor_of.return_value = False
+        resp = self.servicer.ReceiveDeleteActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR_401)
+        self.delete_article.assert_not_called()
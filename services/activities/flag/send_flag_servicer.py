@@ -0,0 +1,48 @@
+from services.proto import general_pb2
+
+
+class SendFlagServicer:
+    def __init__(self, logger, db, activ_util, users_util, hostname=None):
+        self._logger = logger
+        self._db = db
+        self._activ_util = activ_util
+        self._users_util = users_util
+        self._hostname = hostname if hostname else self._activ_util._hostname
+
+    def _build_flag(self, instance_actor, req):
+        # Reports are sent as the instance, so that the reported user's
+        # server doesn't learn who reported them.
+        return {
+            "@context": self._activ_util.rabble_context(),
+            "type": "Flag",
+            "actor": self._activ_util.build_actor(instance_actor.handle,
+                                                  self._hostname),
+            "object": list(req.objects),
+            "content": req.comment,
+        }
+
+    def SendFlagActivity(self, req, ctx):
+        self._logger.info("Got request to send report from %d to %s",
+                          req.reporter_id, req.inbox)
+        instance_actor = self._users_util.get_or_create_instance_actor()
+        if instance_actor is None:
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error="Could not retrieve instance actor",
+            )
+        activity = self._build_flag(instance_actor, req)
+        resp, err = self._activ_util.send_activity(
+            activity, req.inbox, sender_id=instance_actor.global_id)
+        if err is not None:
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error=err,
+            )
+        if resp.status_code < 200 or resp.status_code >= 300:
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error="Got non-2xx HTTP status: {}".format(resp.status_code),
+            )
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
@@ -0,0 +1,9 @@
+from services.proto import flag_pb2_grpc
+
+from send_flag_servicer import SendFlagServicer
+
+
+class S2SFlagServicer(flag_pb2_grpc.S2SFlagServicer):
+    def __init__(self, logger, db, activ_util, users_util):
+        sf = SendFlagServicer(logger, db, activ_util, users_util)
+        self.SendFlagActivity = sf.SendFlagActivity
@@ -0,0 +1,59 @@
+import unittest
+from unittest.mock import Mock
+
+from activities.flag.send_flag_servicer import SendFlagServicer
+from services.proto import database_pb2
+from services.proto import flag_pb2
+from services.proto import general_pb2
+
+
+class SendFlagServicerTest(unittest.TestCase):
+
+    def setUp(self):
+        self.activ_util = Mock()
+        self.activ_util.rabble_context.return_value = \
+            'https://www.w3.org/ns/activitystreams'
+        self.activ_util.build_actor = \
+            lambda handle, host: f'https://{host}/ap/@{handle}'
+        self.activ_util.send_activity.return_value = \
+            (Mock(status_code=202), None)
+        self.users_util = Mock()
+        self.users_util.get_or_create_instance_actor.return_value = \
+            database_pb2.UsersEntry(global_id=7, handle='instance.actor')
+        self.servicer = SendFlagServicer(
+            Mock(), Mock(), self.activ_util, self.users_util,
+            hostname='b.com')
+        self.req = flag_pb2.FlagDetails(
+            reporter_id=1, inbox='https://c.com/inbox',
+            objects=['https://c.com/users/bob', 'https://c.com/notes/2'],
+            comment='spam')
+
+    def test_send_flag_as_instance(self):
+        resp = self.servicer.SendFlagActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        self.activ_util.send_activity.assert_called_once_with({
+            '@context': 'https://www.w3.org/ns/activitystreams',
+            'type': 'Flag',
+            'actor': 'https://b.com/ap/@instance.actor',
+            'object': ['https://c.com/users/bob', 'https://c.com/notes/2'],
+            'content': 'spam',
+        }, 'https://c.com/inbox', sender_id=7)
+        self.users_util.get_user_from_db.assert_not_called()
+
+    def test_no_instance_actor(self):
+        self.users_util.get_or_create_instance_actor.return_value = None
+        resp = self.servicer.SendFlagActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.activ_util.send_activity.assert_not_called()
+
+    def test_send_error(self):
+        self.activ_util.send_activity.return_value = (None, 'down')
+        resp = self.servicer.SendFlagActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.assertEqual(resp.error, 'down')
+
+    def test_rejected_by_inbox(self):
+        self.activ_util.send_activity.return_value = \
+            (Mock(status_code=401), None)
+        resp = self.servicer.SendFlagActivity(self.req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
@@ -50,8 +50,26 @@ class SendFollowServicer:
             return None
         return resp.results[0].global_id
 
-    def _send(self, activ, url, handle):
+    def _blocked_by(self, sender_id, followed):
+        '''Reports whether the foreign user `followed` has blocked the local
+        user sender_id. Users we have never heard of can't have.'''
+        if sender_id is None:
+            return False
+        host = self._activ_util.normalise_hostname(followed.host)
+        user = database_pb2.UsersEntry(handle=followed.handle, host=host)
+        req = database_pb2.UsersRequest(request_type=database_pb2.RequestType.FIND,
+                                        match=user)
+        resp = self._db.Users(req)
+        if resp.result_type != general_pb2.ResultType.OK or not len(resp.results):
+            return False
+        return self._activ_util.has_blocked(resp.results[0].global_id,
+                                            sender_id)
+
+    def _send(self, activ, url, handle, followed):
         sender_id = self._get_local_user_id(handle)
+        if self._blocked_by(sender_id, followed):
+            return "You have been blocked by {}@{}".format(
+                followed.handle, followed.host)
         resp, err = self._activ_util.send_activity(
             activ, url, sender_id=sender_id)
         if err is not None:
@@ -72,7 +90,8 @@ class SendFollowServicer:
         self._logger.debug('Sending follow activity to foreign server')
         self._logger.debug(str(activity))
 
-        err = self._send(activity, inbox_url, req.follower.handle)
+        err = self._send(activity, inbox_url, req.follower.handle,
+                         req.followed)
         if err is None:
             resp.result_type = general_pb2.ResultType.OK
         else:
@@ -2,7 +2,6 @@ from services.proto import database_pb2 as db_pb
 from services.proto import like_pb2
 from services.proto import recommend_posts_pb2
 from services.proto import general_pb2
-from like_util import build_like_activity
 
 
 class ReceiveLikeServicer:
@@ -72,13 +71,9 @@ class ReceiveLikeServicer:
                 result_type=general_pb2.ResultType.ERROR,
                 error="Could not add like to DB: " + err
             )
+        # The like isn't passed on to the author's followers, as it's the
+        # liker's and can't be signed by the author.
         if self._user_util.user_is_local(article.author_id):
-            # This is the author's local server, must distribute like to
-            # all the servers who follow this user.
-            self._activ_util.forward_activity_to_followers(
-                article.author_id,
-                build_like_activity(req.liker_id, req.liked_object))
-
             # If post_recommender is on, send like to post_recommender
             if self._post_recommendation_stub is not None:
                 self._add_like_to_user_model(user_id, article.global_id)
@@ -57,7 +57,19 @@ class SendLikeServicer:
             self._activ_util.build_actor(req.liker_handle, self._hostname),
             self._activ_util.build_article_ap_id(author, article))
         inbox = self._activ_util.build_inbox_url(author.handle, author.host)
-        resp, err = self._activ_util.send_activity(activity, inbox)
+        liker = self._user_util.get_user_from_db(handle=req.liker_handle,
+                                                 host_is_null=True)
+        if liker is None:
+            self._logger.error("Error getting liker from DB")
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = "Error getting liker from DB"
+            return response
+        if self._activ_util.has_blocked(author.global_id, liker.global_id):
+            self._logger.info("Not sending like to %s@%s, who has blocked %s",
+                              author.handle, author.host, req.liker_handle)
+            return response
+        resp, err = self._activ_util.send_activity(
+            activity, inbox, sender_id=liker.global_id)
         if err is not None:
             response.result_type = general_pb2.ResultType.ERROR
             response.error = err
@@ -41,6 +41,10 @@ class MockDB:
     def Users(self, *args):
         return self.users_response
 
+    def FindBlock(self, *args):
+        return database_pb2.FindBlockResponse(
+            result_type=general_pb2.ResultType.OK)
+
 
 class SendLikeServicerTest(unittest.TestCase):
     def setUp(self):
@@ -55,9 +59,10 @@ class SendLikeServicerTest(unittest.TestCase):
         self.url = None
         self.activ_util.send_activity = self.save_request
 
-    def save_request(self, data, url):
+    def save_request(self, data, url, sender_id=None):
         self.data = data
         self.url = url
+        self.sender_id = sender_id
         return "my_response", None
 
     def test_SendLikeActivity(self):
@@ -77,6 +82,8 @@ class SendLikeServicerTest(unittest.TestCase):
         # Check the request was sent to a valid URL.
         self.assertIn("rabble.mojang.com", self.url)
         self.assertIn("@minecraft4ever", self.url)
+        # Check the request was signed by the liker.
+        self.assertEqual(self.sender_id, 456)
 
     def test_SendLikeActivityLocal(self):
         req = like_pb2.LikeDetails(
@@ -105,7 +112,7 @@ class SendLikeServicerTest(unittest.TestCase):
             article_id=123,
             liker_handle="farmlover73",
         )
-        self.activ_util.send_activity = lambda *_: ("", "Error 404")
+        self.activ_util.send_activity = lambda *_, **__: ("", "Error 404")
         resp = self.servicer.SendLikeActivity(req, None)
         self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
 
@@ -120,3 +127,17 @@ class SendLikeServicerTest(unittest.TestCase):
         )
         resp = self.servicer.SendLikeActivity(req, None)
         self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+
+    def test_SendLikeActivityBlocked(self):
+        req = like_pb2.LikeDetails(
+            article_id=123,
+            liker_handle="farmlover73",
+        )
+        self.db.FindBlock = lambda *_: database_pb2.FindBlockResponse(
+            result_type=general_pb2.ResultType.OK,
+            exists=True,
+        )
+        resp = self.servicer.SendLikeActivity(req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        # Nothing is sent to an author who has blocked the liker.
+        self.assertIsNone(self.data)
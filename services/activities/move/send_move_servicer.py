@@ -0,0 +1,41 @@
+from services.proto import general_pb2
+
+
+class SendMoveServicer:
+    def __init__(self, logger, db, activ_util, users_util, hostname=None):
+        self._logger = logger
+        self._db = db
+        self._activ_util = activ_util
+        self._users_util = users_util
+        self._hostname = hostname if hostname else self._activ_util._hostname
+
+    def _build_move(self, mover, target):
+        actor = self._activ_util.build_actor(mover.handle, self._hostname)
+        return {
+            "@context": self._activ_util.rabble_context(),
+            "type": "Move",
+            "actor": actor,
+            "object": actor,
+            "target": target,
+        }
+
+    def SendMoveActivity(self, req, ctx):
+        self._logger.info("Got request to send move of %d to %s",
+                          req.mover_id, req.target)
+        mover = self._users_util.get_user_from_db(global_id=req.mover_id)
+        if mover is None:
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error="Could not retrieve mover",
+            )
+        activity = self._build_move(mover, req.target)
+        err = self._activ_util.forward_activity_to_followers(
+            mover.global_id, activity)
+        if err is not None:
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error=err,
+            )
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
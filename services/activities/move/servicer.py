@@ -0,0 +1,9 @@
+from services.proto import move_pb2_grpc
+
+from send_move_servicer import SendMoveServicer
+
+
+class S2SMoveServicer(move_pb2_grpc.S2SMoveServicer):
+    def __init__(self, logger, db, activ_util, users_util):
+        sm = SendMoveServicer(logger, db, activ_util, users_util)
+        self.SendMoveActivity = sm.SendMoveActivity
@@ -0,0 +1,52 @@
+import unittest
+from unittest.mock import Mock
+
+from activities.move.send_move_servicer import SendMoveServicer
+from services.proto import database_pb2
+from services.proto import general_pb2
+from services.proto import move_pb2
+
+
+class SendMoveServicerTest(unittest.TestCase):
+
+    def setUp(self):
+        self.activ_util = Mock()
+        self.activ_util.rabble_context.return_value = \
+            'https://www.w3.org/ns/activitystreams'
+        self.activ_util.build_actor = \
+            lambda handle, host: f'https://{host}/ap/@{handle}'
+        self.activ_util.forward_activity_to_followers.return_value = None
+        self.users_util = Mock()
+        self.users_util.get_user_from_db.return_value = \
+            database_pb2.UsersEntry(global_id=1, handle='alice')
+        self.servicer = SendMoveServicer(
+            Mock(), Mock(), self.activ_util, self.users_util,
+            hostname='b.com')
+
+    def test_send_move(self):
+        req = move_pb2.MoveDetails(
+            mover_id=1, target='https://c.com/users/alice')
+        resp = self.servicer.SendMoveActivity(req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.OK)
+        self.activ_util.forward_activity_to_followers.assert_called_once_with(
+            1, {
+                '@context': 'https://www.w3.org/ns/activitystreams',
+                'type': 'Move',
+                'actor': 'https://b.com/ap/@alice',
+                'object': 'https://b.com/ap/@alice',
+                'target': 'https://c.com/users/alice',
+            })
+
+    def test_unknown_mover(self):
+        self.users_util.get_user_from_db.return_value = None
+        req = move_pb2.MoveDetails(mover_id=1, target='https://c.com/@a')
+        resp = self.servicer.SendMoveActivity(req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.activ_util.forward_activity_to_followers.assert_not_called()
+
+    def test_forward_error(self):
+        self.activ_util.forward_activity_to_followers.return_value = 'down'
+        req = move_pb2.MoveDetails(mover_id=1, target='https://c.com/@a')
+        resp = self.servicer.SendMoveActivity(req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.assertEqual(resp.error, 'down')
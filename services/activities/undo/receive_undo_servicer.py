@@ -1,4 +1,3 @@
-from activities.like import like_util
 from services.proto import database_pb2 as dbpb
 from services.proto import general_pb2
 
@@ -57,16 +56,41 @@ class ReceiveLikeUndoServicer:
                                   + req.liked_object_ap_id)
         if not self.remove_like_from_db(user.global_id, article.global_id):
             return self.gen_error("Error removing like from DB")
-        # TODO(CianLR): If this is the author's local server then federate
-        # the unlike
-        if self._users_util.user_is_local(article.author_id):
-            # Build the activity.
-            a = self._activ_util.build_undo(like_util.build_like_activity(
-                req.liking_user_ap_id,
-                req.liked_object_ap_id))
-            # Forward it to the followers
-            self._activ_util.forward_activity_to_followers(
-                article.author_id, a)
+        # The unlike isn't passed on to the author's followers, as it's the
+        # liker's and can't be signed by the author.
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+
+
+class ReceiveAnnounceUndoServicer(ReceiveLikeUndoServicer):
+    def remove_share_from_db(self, user_id, article_id):
+        req = dbpb.ShareEntry(
+            user_id=user_id,
+            article_id=article_id,
+        )
+        resp = self._db.RemoveShare(req)
+        if resp.result_type != general_pb2.ResultType.OK:
+            self._logger.error("Error from DB: %s", resp.error)
+            return False
+        return True
+
+    def ReceiveAnnounceUndoActivity(self, req, ctx):
+        self._logger.debug("Got undo for announce object")
+        user = self.get_user(req.announcer_ap_id)
+        if user is None:
+            # We never recorded a share by this user.
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.OK,
+            )
+        article, err = self._activ_util.get_article_by_ap_id(
+            req.announced_object_ap_id)
+        if err is not None:
+            self._logger.error("Error getting article: %s", err)
+            return self.gen_error("Could not get article: "
+                                  + req.announced_object_ap_id)
+        if not self.remove_share_from_db(user.global_id, article.global_id):
+            return self.gen_error("Error removing share from DB")
         return general_pb2.GeneralResponse(
             result_type=general_pb2.ResultType.OK,
         )
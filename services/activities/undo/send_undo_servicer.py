@@ -56,11 +56,16 @@ class SendLikeUndoServicer:
                 raise SendUndoException("Error getting author")
             if not author.host:
                 author.host = self._hostname
+            liker = self._users_util.get_user_from_db(
+                handle=req.liker_handle, host_is_null=True)
+            if liker is None:
+                raise SendUndoException("Error getting liker")
             undo_obj = self._build_like_undo_object(
                 req.liker_handle, author, article)
             inbox = self._activ_util.build_inbox_url(
                 author.handle, author.host)
-            _, err = self._activ_util.send_activity(undo_obj, inbox)
+            _, err = self._activ_util.send_activity(
+                undo_obj, inbox, sender_id=liker.global_id)
             if err:
                 raise SendUndoException(err)
         except SendUndoException as e:
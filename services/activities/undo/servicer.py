@@ -2,6 +2,7 @@ from services.proto import undo_pb2_grpc
 
 from send_undo_servicer import SendLikeUndoServicer
 from receive_undo_servicer import ReceiveLikeUndoServicer
+from receive_undo_servicer import ReceiveAnnounceUndoServicer
 
 
 class S2SUndoServicer(undo_pb2_grpc.S2SUndoServicer):
@@ -11,4 +12,6 @@ class S2SUndoServicer(undo_pb2_grpc.S2SUndoServicer):
         self.SendLikeUndoActivity = send_like_undo.SendLikeUndoActivity
         rd = ReceiveLikeUndoServicer(logger, db, activ_util, users_util)
         self.ReceiveLikeUndoActivity = rd.ReceiveLikeUndoActivity
-
+        ra = ReceiveAnnounceUndoServicer(
+            logger, db, activ_util, users_util)
+        self.ReceiveAnnounceUndoActivity = ra.ReceiveAnnounceUndoActivity
@@ -64,9 +64,10 @@ class SendLikeUndoServicerTest(unittest.TestCase):
         self.activ_util.build_inbox_url = lambda handle, host: (
             host + '/' + handle + '/inbox')
 
-    def save_request(self, data, url):
+    def save_request(self, data, url, sender_id=None):
         self.data = data
         self.url = url
+        self.sender_id = sender_id
         return "my_response", None
 
     def test_foreign_request(self):
@@ -95,7 +96,7 @@ class SendLikeUndoServicerTest(unittest.TestCase):
         self.assertIn(self.db.users_response.results[0].handle, self.url)
 
     def test_sending_error(self):
-        self.activ_util.send_activity = lambda *_: (None, "Error 404")
+        self.activ_util.send_activity = lambda *_, **__: (None, "Error 404")
         resp = self.servicer.SendLikeUndoActivity(self.req, None)
         self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
 
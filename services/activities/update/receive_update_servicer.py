@@ -1,7 +1,7 @@
 from services.proto import database_pb2 as dbpb
 from services.proto import update_pb2 as upb
 from services.proto import general_pb2
-from utils.articles import md_to_html
+from utils.articles import get_article, md_to_html
 
 
 class ReceiveUpdateServicer:
@@ -15,6 +15,21 @@ class ReceiveUpdateServicer:
 
     def ReceiveUpdateActivity(self, req, ctx):
         self._logger.info("Received edit for article '%s'", req.title)
+        article = get_article(self._logger, self._db, ap_id=req.ap_id)
+        if article is None:
+            self._logger.info("Don't have article %s, exiting", req.ap_id)
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.OK
+            )
+        author = self._users_util.get_user_from_db(global_id=article.author_id)
+        if author is None or not self._users_util.is_actor_of(req.actor,
+                                                               author):
+            self._logger.warning("%s may not edit article %s",
+                                 req.actor, req.ap_id)
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR_401,
+                error="Only the author can edit an article",
+            )
         html_body = md_to_html(self._md, req.body)
         resp = self._db.Posts(dbpb.PostsRequest(
             request_type=dbpb.RequestType.UPDATE,
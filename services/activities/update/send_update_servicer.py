@@ -1,6 +1,11 @@
+from google.protobuf.timestamp_pb2 import Timestamp
+
 from services.proto import database_pb2 as dbpb
 from services.proto import general_pb2
-from utils.articles import get_article, convert_to_tags_string, md_to_html
+from utils.articles import (
+    get_article, get_mentioned_users, convert_md, convert_to_tags_string,
+    merge_tags, set_mentions,
+)
 
 
 class SendUpdateServicer:
@@ -12,9 +17,10 @@ class SendUpdateServicer:
         self._users_util = users_util
         self._hostname = hostname if hostname else self._activ_util._hostname
 
-    def _update_locally(self, article, req):
+    def _update_locally(self, article, req, updated):
         self._logger.info("Sending update request to DB")
-        html_body = md_to_html(self._md, req.body)
+        html_body, mentions, hashtags = convert_md(self._md, req.body)
+        tags = convert_to_tags_string(merge_tags(req.tags, hashtags))
         resp = self._db.Posts(dbpb.PostsRequest(
             request_type=dbpb.RequestType.UPDATE,
             match=dbpb.PostsEntry(global_id=article.global_id),
@@ -22,16 +28,20 @@ class SendUpdateServicer:
                 title=req.title,
                 body=html_body,
                 md_body=req.body,
-                tags=convert_to_tags_string(req.tags),
+                tags=tags,
                 summary=req.summary,
+                updated_datetime=updated,
             ),
         ))
         if resp.result_type != general_pb2.ResultType.OK:
             self._logger.error("Could not update article: %s", resp.error)
             return False
+        article.tags = tags
+        set_mentions(self._logger, self._db, self._users_util,
+                     article.global_id, mentions)
         return True
 
-    def _build_update(self, user, article, req):
+    def _build_update(self, user, article, req, updated):
         actor = self._activ_util.build_actor(user.handle, self._hostname)
         article_url = self._activ_util.build_local_article_url(user, article)
         timestamp = article.creation_datetime.ToJsonString()
@@ -44,6 +54,15 @@ class SendUpdateServicer:
             req.summary,
             article_url=article_url,
         )
+        ap_article["updated"] = updated.ToJsonString()
+        mentioned = get_mentioned_users(
+            self._logger, self._db, self._users_util, article.global_id)
+        tags, mentioned_ids = self._activ_util.build_article_tags(
+            article, mentioned)
+        if tags:
+            ap_article["tag"] = tags
+        if mentioned_ids:
+            ap_article["cc"] = mentioned_ids
         return {
             "@context": self._activ_util.rabble_context(),
             "type": "Update",
@@ -72,14 +91,16 @@ class SendUpdateServicer:
             return general_pb2.GeneralResponse(
                 result_type=general_pb2.ResultType.ERROR_401
             )
+        updated = Timestamp()
+        updated.GetCurrentTime()
         # Update article locally
-        if not self._update_locally(article, req):
+        if not self._update_locally(article, req, updated):
             return general_pb2.GeneralResponse(
                 result_type=general_pb2.ResultType.ERROR,
                 error="Error updating article",
             )
         # Send out update activity
-        update_obj = self._build_update(user, article, req)
+        update_obj = self._build_update(user, article, req, updated)
         self._logger.info("Activity: %s", str(update_obj))
         err = self._activ_util.forward_activity_to_followers(
             req.user_id, update_obj)
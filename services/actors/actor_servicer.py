@@ -53,6 +53,7 @@ class ActorsServicer:
         actor_url = self._activ_util.build_actor(handle, self._host_name)
         following_url = actor_url + "/following"
         followers_url = actor_url + "/followers"
+        outbox_url = actor_url + "/outbox"
 
         public_key = self._get_public_key(username)
         return actors_pb2.ActorObject(
@@ -61,8 +62,7 @@ class ActorsServicer:
             preferredUsername=handle,
             name=user.display_name,
             inbox=inbox_url,
-            # TODO(iandioch): Create outbox URL when we have outboxes.
-            outbox=None,
+            outbox=outbox_url,
             following=following_url,
             followers=followers_url,
             global_id=user.global_id,
@@ -3,7 +3,9 @@ from services.proto import database_pb2
 from services.proto import create_pb2
 from services.proto import search_pb2
 from services.proto import general_pb2
-from utils.articles import convert_to_tags_string, md_to_html
+from utils.articles import (
+    convert_md, convert_to_tags_string, md_to_html, merge_tags, set_mentions,
+)
 
 
 class NewArticleServicer:
@@ -42,8 +44,12 @@ class NewArticleServicer:
             return database_pb2.PostsResponse.error, None
         global_id = author.global_id
 
-        html_body = md_to_html(self._md_stub, req.body)
-        tags_string = convert_to_tags_string(req.tags)
+        html_body, mentions, hashtags = convert_md(self._md_stub, req.body)
+        if req.foreign:
+            # A foreign body names users of the author's server, so the
+            # local users it mentions are found from its activity instead.
+            mentions, hashtags = req.mentions, []
+        tags_string = convert_to_tags_string(merge_tags(req.tags, hashtags))
         pe = database_pb2.PostsEntry(
             author_id=global_id,
             title=req.title,
@@ -53,7 +59,10 @@ class NewArticleServicer:
             ap_id=req.ap_id,
             tags=tags_string,
             summary=req.summary,
+            in_reply_to=req.in_reply_to,
         )
+        if req.foreign and req.unlisted:
+            pe.unlisted.value = True
         pr = database_pb2.PostsRequest(
             request_type=database_pb2.RequestType.INSERT,
             entry=pe
@@ -64,6 +73,12 @@ class NewArticleServicer:
                 'Could not insert into db: %s', posts_resp.error)
 
         pe.global_id = posts_resp.global_id
+        if mentions and posts_resp.result_type == general_pb2.ResultType.OK:
+            set_mentions(self._logger, self._db_stub, self._users_util,
+                         pe.global_id, mentions)
+        if pe.unlisted.value:
+            # Only kept so the users it mentions can see it.
+            return posts_resp.result_type, posts_resp.global_id
         self.index(pe)
 
         # If post_recommender is on, send new post to post_recommender
@@ -82,6 +97,7 @@ class NewArticleServicer:
             creation_datetime=req.creation_datetime,
             global_id=global_id,
             summary=req.summary,
+            in_reply_to=req.in_reply_to,
         )
         create_resp = self._create_stub.SendCreate(ad)
 
@@ -5,6 +5,9 @@ from database.servicers.like_servicer import LikeDatabaseServicer
 from database.servicers.view_servicer import ViewDatabaseServicer
 from database.servicers.log_servicer import LogDatabaseServicer
 from database.servicers.share_servicer import ShareDatabaseServicer
+from database.servicers.block_servicer import BlockDatabaseServicer
+from database.servicers.reports_servicer import ReportsDatabaseServicer
+from database.servicers.aliases_servicer import AliasesDatabaseServicer
 
 from services.proto import database_pb2_grpc
 
@@ -23,6 +26,11 @@ class DatabaseServicer(database_pb2_grpc.DatabaseServicer):
         self.RandomPosts = posts_servicer.RandomPosts
         self.SafeRemovePost = posts_servicer.SafeRemovePost
         self.TaggedPosts = posts_servicer.TaggedPosts
+        self.AddPin = posts_servicer.AddPin
+        self.RemovePin = posts_servicer.RemovePin
+        self.SetMentions = posts_servicer.SetMentions
+        self.ArticleMentions = posts_servicer.ArticleMentions
+        self.UserMentions = posts_servicer.UserMentions
         users_servicer = UsersDatabaseServicer(db, logger)
         self.Users = users_servicer.Users
         self.SearchUsers = users_servicer.SearchUsers
@@ -39,9 +47,23 @@ class DatabaseServicer(database_pb2_grpc.DatabaseServicer):
         log_servicer = LogDatabaseServicer(db, logger)
         self.AddLog = log_servicer.AddLog
         self.AllUsers = users_servicer.AllUsers
+        self.LocalUsage = users_servicer.LocalUsage
+        self.TombstoneUser = users_servicer.TombstoneUser
         self.AllUserLikes = users_servicer.AllUserLikes
         share_servicer = ShareDatabaseServicer(db, logger)
         self.AddShare = share_servicer.AddShare
         self.FindShare = share_servicer.FindShare
+        self.RemoveShare = share_servicer.RemoveShare
         self.SharedPosts = share_servicer.SharedPosts
         self.GetSharersOfPost = share_servicer.GetSharersOfPost
+        block_servicer = BlockDatabaseServicer(db, logger)
+        self.AddBlock = block_servicer.AddBlock
+        self.FindBlock = block_servicer.FindBlock
+        self.RemoveBlock = block_servicer.RemoveBlock
+        reports_servicer = ReportsDatabaseServicer(db, logger)
+        self.Reports = reports_servicer.Reports
+        aliases_servicer = AliasesDatabaseServicer(db, logger)
+        self.AddAlias = aliases_servicer.AddAlias
+        self.RemoveAlias = aliases_servicer.RemoveAlias
+        self.Aliases = aliases_servicer.Aliases
+        self.SetMovedTo = aliases_servicer.SetMovedTo
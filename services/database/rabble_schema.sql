@@ -9,7 +9,16 @@ CREATE TABLE IF NOT EXISTS posts (
   likes_count       integer NOT NULL DEFAULT 0,
   shares_count      integer NOT NULL DEFAULT 0,
   tags              text    NOT NULL,
-  summary           text    NOT NULL
+  summary           text    NOT NULL,
+  /* updated_datetime is null until the post is first edited. */
+  updated_datetime  integer,
+  /* in_reply_to is the global_id of the post this is a reply to, or null
+   * for articles. */
+  in_reply_to       integer,
+  /* unlisted posts are foreign posts kept only because they mention a
+   * local user, or replies to posts of deleted users. They are left out of
+   * feeds, search and recommendations. */
+  unlisted          boolean NOT NULL DEFAULT 0
 );
 
 CREATE TABLE IF NOT EXISTS users (
@@ -27,6 +36,8 @@ CREATE TABLE IF NOT EXISTS users (
   custom_css        text    NOT NULL DEFAULT '',
   public_key        text    NOT NULL,
   private_key       text    NOT NULL,
+  /* profile_fields is a JSON list of {"name": ..., "value": ...} objects. */
+  profile_fields    text    NOT NULL DEFAULT '[]',
   UNIQUE (handle, host)
 );
 
@@ -100,3 +111,64 @@ CREATE TABLE IF NOT EXISTS shares (
   announce_datetime integer NOT NULL,
   PRIMARY KEY (user_id, article_id)
 );
+
+/*
+  blocker and blocked both match global_id in entries in users table.
+  While a block exists nothing from blocked is sent to blocker.
+*/
+CREATE TABLE IF NOT EXISTS blocks (
+  blocker           integer NOT NULL,
+  blocked           integer NOT NULL,
+  PRIMARY KEY (blocker, blocked)
+);
+
+/*
+  alias is the ActivityPub id of another account of the local user user_id,
+  which is allowed to move to them.
+*/
+CREATE TABLE IF NOT EXISTS aliases (
+  user_id           integer NOT NULL,
+  alias             text    NOT NULL,
+  PRIMARY KEY (user_id, alias)
+);
+
+/*
+  article_id is a post its author pinned to their profile.
+*/
+CREATE TABLE IF NOT EXISTS pins (
+  article_id        integer PRIMARY KEY
+);
+
+/*
+  user_id is mentioned in the post article_id. Mentions of local users in
+  posts from anywhere are kept so they can be notified.
+*/
+CREATE TABLE IF NOT EXISTS mentions (
+  article_id        integer NOT NULL,
+  user_id           integer NOT NULL,
+  PRIMARY KEY (article_id, user_id)
+);
+
+/*
+  moved_to is the ActivityPub id of the account the user user_id moved to.
+*/
+CREATE TABLE IF NOT EXISTS moves (
+  user_id           integer PRIMARY KEY,
+  moved_to          text    NOT NULL
+);
+
+/*
+  reporter is the ActivityPub id of whoever filed the report, and objects the
+  ActivityPub ids of the users and posts reported, one per line.
+  state is the state of the report, see ReportEntry in database.proto.
+  ap_id is the id of the Flag activity for reports from other instances.
+*/
+CREATE TABLE IF NOT EXISTS reports (
+  global_id         integer PRIMARY KEY AUTOINCREMENT,
+  reporter          text    NOT NULL,
+  objects           text    NOT NULL,
+  comment           text    NOT NULL DEFAULT '',
+  state             integer NOT NULL DEFAULT 0,
+  creation_datetime integer NOT NULL,
+  ap_id             text    NOT NULL DEFAULT ''
+);
@@ -0,0 +1,79 @@
+import sqlite3
+
+from services.proto import database_pb2 as db_pb
+from services.proto import general_pb2
+
+
+class AliasesDatabaseServicer:
+    def __init__(self, db, logger):
+        self._db = db
+        self._logger = logger
+
+    def AddAlias(self, req, context):
+        self._logger.debug("Adding alias %s of %d", req.alias, req.user_id)
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            self._db.execute(
+                'INSERT OR REPLACE INTO aliases (user_id, alias) '
+                'VALUES (?, ?)',
+                req.user_id, req.alias)
+        except sqlite3.Error as e:
+            self._logger.error("AddAlias error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
+
+    def RemoveAlias(self, req, context):
+        self._logger.debug("Removing alias %s of %d", req.alias, req.user_id)
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            self._db.execute(
+                'DELETE FROM aliases WHERE user_id = ? AND alias = ?',
+                req.user_id, req.alias)
+        except sqlite3.Error as e:
+            self._logger.error("RemoveAlias error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
+
+    def Aliases(self, req, context):
+        self._logger.debug("Finding aliases of %d", req.user_id)
+        response = db_pb.AliasesResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            aliases = self._db.execute(
+                'SELECT alias FROM aliases WHERE user_id = ? '
+                'ORDER BY alias', req.user_id)
+            moves = self._db.execute(
+                'SELECT moved_to FROM moves WHERE user_id = ?', req.user_id)
+        except sqlite3.Error as e:
+            self._logger.error("Aliases error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+            return response
+        response.aliases.extend(tup[0] for tup in aliases)
+        if moves:
+            response.moved_to = moves[0][0]
+        return response
+
+    def SetMovedTo(self, req, context):
+        self._logger.debug("Recording move of %d to %s",
+                           req.user_id, req.alias)
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            self._db.execute(
+                'INSERT OR REPLACE INTO moves (user_id, moved_to) '
+                'VALUES (?, ?)',
+                req.user_id, req.alias)
+        except sqlite3.Error as e:
+            self._logger.error("SetMovedTo error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
@@ -0,0 +1,67 @@
+import sqlite3
+
+from services.proto import database_pb2 as db_pb
+from services.proto import general_pb2
+
+
+class BlockDatabaseServicer:
+    def __init__(self, db, logger):
+        self._db = db
+        self._logger = logger
+
+    def AddBlock(self, req, context):
+        self._logger.debug(
+            "Adding block of %d by %d",
+            req.blocked, req.blocker
+        )
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            # Blocking someone twice is the same as blocking them once.
+            self._db.execute(
+                'INSERT OR REPLACE INTO blocks (blocker, blocked) '
+                'VALUES (?, ?)',
+                req.blocker, req.blocked)
+        except sqlite3.Error as e:
+            self._logger.error("AddBlock error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
+
+    def RemoveBlock(self, req, context):
+        self._logger.debug(
+            "Removing block of %d by %d",
+            req.blocked, req.blocker
+        )
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            self._db.execute(
+                'DELETE FROM blocks WHERE blocker = ? AND blocked = ?',
+                req.blocker, req.blocked)
+        except sqlite3.Error as e:
+            self._logger.error("RemoveBlock error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
+
+    def FindBlock(self, req, context):
+        self._logger.debug(
+            "Finding block of %d by %d",
+            req.blocked, req.blocker
+        )
+        response = db_pb.FindBlockResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            res = self._db.execute(
+                'SELECT * FROM blocks WHERE blocker = ? AND blocked = ?',
+                req.blocker, req.blocked)
+            response.exists = len(res) > 0
+        except sqlite3.Error as e:
+            self._logger.error("FindBlock error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
@@ -22,14 +22,20 @@ class PostsDatabaseServicer:
             "p.global_id, p.author_id, p.title, p.body, "
             "p.creation_datetime, p.md_body, p.ap_id, p.likes_count, "
             "l.user_id IS NOT NULL, f.follower IS NOT NULL, "
-            "s.user_id IS NOT NULL, p.shares_count, p.tags, p.summary "
+            "s.user_id IS NOT NULL, p.shares_count, p.tags, p.summary, "
+            "p.updated_datetime, pn.article_id IS NOT NULL, p.in_reply_to, "
+            "p.unlisted "
             "FROM posts p LEFT OUTER JOIN likes l ON "
             "l.article_id=p.global_id AND l.user_id=? "
             "LEFT OUTER JOIN shares s ON "
             "s.article_id=p.global_id AND s.user_id=? "
             "LEFT OUTER JOIN follows f ON "
             "f.followed=p.author_id AND f.follower=? "
+            "LEFT OUTER JOIN pins pn ON pn.article_id=p.global_id "
         )
+        self._filter_defer = {
+            'unlisted': self._unlisted_to_filter,
+        }
         self._type_handlers = {
             database_pb2.RequestType.INSERT: self._handle_insert,
             database_pb2.RequestType.FIND: self._handle_find,
@@ -37,6 +43,11 @@ class PostsDatabaseServicer:
             database_pb2.RequestType.UPDATE: self._handle_update,
         }
 
+    def _unlisted_to_filter(self, entry, comp):
+        if not entry.HasField("unlisted"):
+            return "", util.DONT_USE_FIELD
+        return "unlisted" + comp, entry.unlisted.value
+
     def Posts(self, request, context):
         response = database_pb2.PostsResponse()
         self._type_handlers[request.request_type](request, response)
@@ -56,6 +67,7 @@ class PostsDatabaseServicer:
                                    'INNER JOIN users u '
                                    'ON p.author_id = u.global_id '
                                    'WHERE u.host IS NULL AND u.private = 0 '
+                                   'AND p.in_reply_to IS NULL '
                                    'ORDER BY p.global_id DESC '
                                    'LIMIT ?', user_id, user_id, user_id, n)
             for tup in res:
@@ -75,7 +87,7 @@ class PostsDatabaseServicer:
         try:
             res = self._db.execute(self._select_base +
                                    'WHERE l.user_id is not ? AND s.user_id is not ? '
-                                   'AND p.author_id is not ?'
+                                   'AND p.author_id is not ? AND p.unlisted = 0 '
                                    'ORDER BY random() '
                                    'LIMIT ?', user_id, user_id, user_id,
                                    user_id, user_id, user_id, n)
@@ -96,7 +108,8 @@ class PostsDatabaseServicer:
                                    'p.global_id, p.author_id, p.tags '
                                    'FROM posts p LEFT OUTER JOIN users u ON '
                                    'p.author_id = u.global_id '
-                                   'WHERE p.tags is not NULL OR p.tags = "" AND u.private = 0 '
+                                   'WHERE p.unlisted = 0 AND '
+                                   '(p.tags is not NULL OR p.tags = "" AND u.private = 0) '
                                    )
             for tup in res:
                 entry = resp.results.add()
@@ -137,7 +150,8 @@ class PostsDatabaseServicer:
             res = self._db.execute(self._select_base +
                                    'WHERE global_id IN ' +
                                    '(SELECT rowid FROM posts_idx WHERE posts_idx '
-                                   "MATCH ? LIMIT ?)", user_id, user_id, user_id, request.query + "*", n)
+                                   "MATCH ? LIMIT ?) AND p.unlisted = 0",
+                                   user_id, user_id, user_id, request.query + "*", n)
             for tup in res:
                 if not self._db_tuple_to_entry(tup, resp.results.add()):
                     del resp.results[-1]
@@ -192,8 +206,9 @@ class PostsDatabaseServicer:
             self._db.execute(
                 'INSERT INTO posts '
                 '(author_id, title, body, creation_datetime, '
-                'md_body, ap_id, likes_count, tags, summary) '
-                'VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)',
+                'md_body, ap_id, likes_count, tags, summary, in_reply_to, '
+                'unlisted) '
+                'VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)',
                 req.entry.author_id, req.entry.title,
                 req.entry.body,
                 req.entry.creation_datetime.seconds,
@@ -202,6 +217,8 @@ class PostsDatabaseServicer:
                 req.entry.likes_count,
                 req.entry.tags,
                 req.entry.summary,
+                req.entry.in_reply_to or None,
+                req.entry.unlisted.value,
                 commit=False)
             res = self._db.execute(
                 'SELECT last_insert_rowid() FROM posts LIMIT 1')
@@ -220,7 +237,7 @@ class PostsDatabaseServicer:
         resp.global_id = res[0][0]
 
     def _db_tuple_to_entry(self, tup, entry):
-        if len(tup) != 14:
+        if len(tup) != 18:
             self._logger.warning(
                 CONVERT_ERROR + "Wrong number of elements " + str(tup))
             return False
@@ -240,13 +257,20 @@ class PostsDatabaseServicer:
             entry.shares_count = tup[11]
             entry.tags = tup[12]
             entry.summary = tup[13]
+            if tup[14] is not None:
+                entry.updated_datetime.seconds = tup[14]
+            entry.pinned = tup[15]
+            if tup[16] is not None:
+                entry.in_reply_to = tup[16]
+            entry.unlisted.value = tup[17]
         except Exception as e:
             self._logger.warning(CONVERT_ERROR + str(e))
             return False
         return True
 
     def _handle_find(self, req, resp):
-        filter_clause, values = util.equivalent_filter(req.match)
+        filter_clause, values = util.equivalent_filter(
+            req.match, deferred=self._filter_defer)
         user_id = -1
         if req.HasField("user_global_id"):
             user_id = req.user_global_id.value
@@ -270,7 +294,8 @@ class PostsDatabaseServicer:
                 del resp.results[-1]
 
     def _handle_delete(self, req, resp):
-        filter_clause, values = util.equivalent_filter(req.match)
+        filter_clause, values = util.equivalent_filter(
+            req.match, deferred=self._filter_defer)
         try:
             if not filter_clause:
                 self._db.execute('DELETE FROM posts')
@@ -298,7 +323,13 @@ class PostsDatabaseServicer:
         else:
             match_sql = 'global_id = ?'
             match_val = req.match.global_id
-        update_clause, u_values = util.entry_to_update(req.entry)
+        update_clause, u_values = util.entry_to_update(
+            req.entry, deferred={
+                'updated_datetime': lambda entry, comp: (
+                    'updated_datetime' + comp,
+                    entry.updated_datetime.seconds),
+                **self._filter_defer,
+            })
         sql = 'UPDATE posts SET ' + update_clause + ' WHERE ' + match_sql
         self._logger.info(sql)
         try:
@@ -309,6 +340,123 @@ class PostsDatabaseServicer:
             return
         resp.result_type = general_pb2.ResultType.OK
 
+    def AddPin(self, req, ctx):
+        self._logger.debug("Pinning article %d of %d",
+                           req.article_id, req.user_id)
+        try:
+            res = self._db.execute(
+                'SELECT 1 FROM posts WHERE global_id = ? AND author_id = ?',
+                req.article_id, req.user_id)
+            if not res:
+                return general_pb2.GeneralResponse(
+                    result_type=general_pb2.ResultType.ERROR_400,
+                    error="No such article by this user",
+                )
+            self._db.execute(
+                'INSERT OR IGNORE INTO pins (article_id) VALUES (?)',
+                req.article_id)
+        except sqlite3.Error as e:
+            self._logger.error("AddPin error: %s", str(e))
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error=str(e),
+            )
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+
+    def RemovePin(self, req, ctx):
+        self._logger.debug("Unpinning article %d of %d",
+                           req.article_id, req.user_id)
+        try:
+            self._db.execute(
+                'DELETE FROM pins WHERE article_id IN '
+                '(SELECT global_id FROM posts '
+                'WHERE global_id = ? AND author_id = ?)',
+                req.article_id, req.user_id)
+        except sqlite3.Error as e:
+            self._logger.error("RemovePin error: %s", str(e))
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error=str(e),
+            )
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+
+    def SetMentions(self, req, ctx):
+        self._logger.debug("Setting mentions of %s in article %d",
+                           list(req.user_ids), req.article_id)
+        try:
+            self._db.execute(
+                'DELETE FROM mentions WHERE article_id = ?',
+                req.article_id, commit=False)
+            for user_id in req.user_ids:
+                self._db.execute(
+                    'INSERT OR IGNORE INTO mentions (article_id, user_id) '
+                    'VALUES (?, ?)',
+                    req.article_id, user_id, commit=False)
+            self._db.commit()
+        except sqlite3.Error as e:
+            self._db.discard_cursor()
+            self._logger.error("SetMentions error: %s", str(e))
+            return general_pb2.GeneralResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error=str(e),
+            )
+        return general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+
+    def ArticleMentions(self, req, ctx):
+        resp = database_pb2.MentionsResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+        try:
+            res = self._db.execute(
+                'SELECT m.user_id, u.handle, u.host FROM mentions m '
+                'INNER JOIN users u ON u.global_id = m.user_id '
+                'WHERE m.article_id = ? '
+                'ORDER BY m.user_id',
+                req.article_id)
+            for tup in res:
+                resp.user_ids.append(tup[0])
+                user = resp.users.add(global_id=tup[0], handle=tup[1])
+                if tup[2] is not None:
+                    user.host = tup[2]
+                else:
+                    user.host_is_null = True
+        except sqlite3.Error as e:
+            self._logger.error("ArticleMentions error: %s", str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+        return resp
+
+    def UserMentions(self, req, ctx):
+        resp = database_pb2.PostsResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+        n = req.num_posts
+        if not n:
+            n = DEFAULT_NUM_POSTS
+        user_id = req.user_id
+        try:
+            res = self._db.execute(self._select_base +
+                                   'INNER JOIN mentions m '
+                                   'ON m.article_id = p.global_id '
+                                   'WHERE m.user_id = ? '
+                                   'ORDER BY p.global_id DESC '
+                                   'LIMIT ?',
+                                   user_id, user_id, user_id, user_id, n)
+            for tup in res:
+                if not self._db_tuple_to_entry(tup, resp.results.add()):
+                    del resp.results[-1]
+        except sqlite3.Error as e:
+            self._logger.error("UserMentions error: %s", str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+        return resp
+
     def SafeRemovePost(self, req, ctx):
         if not req.global_id and not req.ap_id:
             return database_pb2.PostsResponse(
@@ -335,10 +483,24 @@ class PostsDatabaseServicer:
             'shares.article_id = posts.global_id AND ' +
             match_sql + ')'
         )
+        pins_sql = (
+            'DELETE FROM pins WHERE EXISTS (' +
+            'SELECT * FROM posts WHERE ' +
+            'pins.article_id = posts.global_id AND ' +
+            match_sql + ')'
+        )
+        mentions_sql = (
+            'DELETE FROM mentions WHERE EXISTS (' +
+            'SELECT * FROM posts WHERE ' +
+            'mentions.article_id = posts.global_id AND ' +
+            match_sql + ')'
+        )
         posts_sql = 'DELETE FROM posts WHERE ' + match_sql
         try:
             self._db.execute(likes_sql, match_val, commit=False)
             self._db.execute(shares_sql, match_val, commit=False)
+            self._db.execute(pins_sql, match_val, commit=False)
+            self._db.execute(mentions_sql, match_val, commit=False)
             self._db.execute(posts_sql, match_val)
         except sqlite3.Error as e:
             self._db.discard_cursor()
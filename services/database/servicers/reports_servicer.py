@@ -0,0 +1,114 @@
+import sqlite3
+
+from services.proto import database_pb2
+from services.proto import general_pb2
+
+
+class ReportsDatabaseServicer:
+
+    def __init__(self, db, logger):
+        self._db = db
+        self._logger = logger
+        self._reports_type_handlers = {
+            database_pb2.RequestType.INSERT: self._reports_handle_insert,
+            database_pb2.RequestType.FIND: self._reports_handle_find,
+            database_pb2.RequestType.UPDATE: self._reports_handle_update,
+        }
+
+    def _db_tuple_to_entry(self, tup, entry):
+        if len(tup) != 7:
+            self._logger.warning(
+                "Error converting tuple to ReportEntry: " +
+                "Wrong number of elements " + str(tup))
+            return False
+        try:
+            # Tuple items are in order of columns of reports table in db.
+            entry.global_id = tup[0]
+            entry.reporter = tup[1]
+            entry.objects.extend(o for o in tup[2].split('\n') if o)
+            entry.comment = tup[3]
+            entry.state = tup[4]
+            entry.creation_datetime.seconds = tup[5]
+            entry.ap_id = tup[6]
+        except Exception as e:
+            self._logger.warning(
+                "Error converting tuple to ReportEntry: " +
+                str(e))
+            return False
+        return True
+
+    def Reports(self, request, context):
+        response = database_pb2.ReportsResponse()
+        if request.request_type not in self._reports_type_handlers:
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = "Unsupported request type for reports"
+            return response
+        self._reports_type_handlers[request.request_type](request, response)
+        return response
+
+    def _reports_handle_insert(self, req, resp):
+        self._logger.info('Inserting new report into Reports database.')
+        try:
+            self._db.execute(
+                'INSERT INTO reports '
+                '(reporter, objects, comment, state, creation_datetime, '
+                'ap_id) VALUES (?, ?, ?, ?, ?, ?)',
+                req.entry.reporter,
+                '\n'.join(req.entry.objects),
+                req.entry.comment,
+                database_pb2.ReportEntry.OPEN,
+                req.entry.creation_datetime.seconds,
+                req.entry.ap_id,
+                commit=False)
+            res = self._db.execute(
+                'SELECT last_insert_rowid() FROM reports LIMIT 1')
+        except sqlite3.Error as e:
+            self._db.discard_cursor()
+            self._logger.error("Error inserting report: %s", str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+            return
+        if len(res) != 1 or len(res[0]) != 1:
+            err = "Global ID data in weird format: " + str(res)
+            self._logger.error(err)
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = err
+            return
+        resp.result_type = general_pb2.ResultType.OK
+        resp.global_id = res[0][0]
+
+    def _reports_handle_find(self, req, resp):
+        try:
+            res = self._db.execute(
+                'SELECT global_id, reporter, objects, comment, state, '
+                'creation_datetime, ap_id FROM reports '
+                'ORDER BY global_id DESC')
+        except sqlite3.Error as e:
+            self._logger.error("Error finding reports: %s", str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+            return
+        for tup in res:
+            if not self._db_tuple_to_entry(tup, resp.results.add()):
+                del resp.results[-1]
+        resp.result_type = general_pb2.ResultType.OK
+
+    def _reports_handle_update(self, req, resp):
+        if not req.match.global_id:
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = "bad parameters: please set match.global_id"
+            return
+        try:
+            count = self._db.execute_count(
+                'UPDATE reports SET state = ? WHERE global_id = ?',
+                req.entry.state, req.match.global_id)
+        except sqlite3.Error as e:
+            self._logger.warning('Got error writing to DB: ' + str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+            return
+        if count != 1:
+            resp.result_type = general_pb2.ResultType.ERROR_400
+            resp.error = 'No report with id {}'.format(req.match.global_id)
+            return
+        resp.result_type = general_pb2.ResultType.OK
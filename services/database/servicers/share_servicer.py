@@ -111,6 +111,37 @@ class ShareDatabaseServicer:
             response.error = str(e)
         return response
 
+    def RemoveShare(self, req, context):
+        self._logger.debug(
+            "Removing share by %d of article %d",
+            req.user_id, req.article_id
+        )
+        response = general_pb2.GeneralResponse(
+            result_type=general_pb2.ResultType.OK
+        )
+        try:
+            res = self._db.execute(
+                'SELECT * FROM shares WHERE user_id = ? AND article_id = ?',
+                req.user_id, req.article_id)
+            if len(res) == 0:
+                # Nothing to remove, so the count is already right.
+                return response
+            self._db.execute(
+                'DELETE FROM shares WHERE user_id = ? AND article_id = ?',
+                req.user_id, req.article_id, commit=False)
+            self._db.execute(
+                'UPDATE posts SET shares_count = shares_count - 1 '
+                'WHERE global_id=?',
+                req.article_id,
+                commit=True
+            )
+        except sqlite3.Error as e:
+            self._db.discard_cursor()
+            self._logger.error("RemoveShare error: %s", str(e))
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+        return response
+
     def FindShare(self, req, context):
         self._logger.debug(
             "Finding share by %d of article %d",
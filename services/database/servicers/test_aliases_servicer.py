@@ -0,0 +1,62 @@
+import unittest
+import logging
+import os
+
+import database.servicers.aliases_servicer as aliases_servicer
+import database.db as database
+from services.proto import database_pb2
+from services.proto import general_pb2
+
+ALIASES_DB_PATH = "/repo/build_out/database/testdb/aliases.db"
+
+
+class AliasesDatabase(unittest.TestCase):
+
+    def setUp(self):
+        def clean_database():
+            os.remove(ALIASES_DB_PATH)
+
+        logger = logging.getLogger()
+        self.db = database.build_database(
+            logger,
+            "/repo/build_out/database/rabble_schema.sql",
+            ALIASES_DB_PATH)
+        self.addCleanup(clean_database)
+        self.service = aliases_servicer.AliasesDatabaseServicer(
+            self.db, logger)
+        self.ctx = None
+
+    def aliases(self, user_id):
+        res = self.service.Aliases(
+            database_pb2.AliasEntry(user_id=user_id), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        return res
+
+    def test_add_and_remove_alias(self):
+        for alias in ['https://b.com/ap/@a', 'https://a.com/users/a',
+                      'https://b.com/ap/@a']:
+            res = self.service.AddAlias(
+                database_pb2.AliasEntry(user_id=1, alias=alias), self.ctx)
+            self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.service.AddAlias(
+            database_pb2.AliasEntry(user_id=2, alias='https://c.com/@c'),
+            self.ctx)
+        self.assertEqual(list(self.aliases(1).aliases),
+                         ['https://a.com/users/a', 'https://b.com/ap/@a'])
+
+        res = self.service.RemoveAlias(
+            database_pb2.AliasEntry(user_id=1, alias='https://b.com/ap/@a'),
+            self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertEqual(list(self.aliases(1).aliases),
+                         ['https://a.com/users/a'])
+        self.assertEqual(list(self.aliases(2).aliases), ['https://c.com/@c'])
+
+    def test_set_moved_to(self):
+        self.assertEqual(self.aliases(1).moved_to, '')
+        for target in ['https://a.com/users/a', 'https://b.com/ap/@a']:
+            res = self.service.SetMovedTo(
+                database_pb2.AliasEntry(user_id=1, alias=target), self.ctx)
+            self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertEqual(self.aliases(1).moved_to, 'https://b.com/ap/@a')
+        self.assertEqual(self.aliases(2).moved_to, '')
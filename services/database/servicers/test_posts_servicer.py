@@ -309,3 +309,145 @@ class PostsDatabase(PostsDatabaseHelper):
         self.assertEqual(len(res.results), 2)
         self.assertIn(want0, res.results)
         self.assertIn(want1, res.results)
+
+    def test_update_sets_updated_datetime(self):
+        self.add_user(handle='tayne', host=None)  # local user, id 1
+        self.add_post(author_id=1, title='hi', body='hello sam')
+
+        res = self.find_post(user=1)
+        self.assertFalse(res.results[0].HasField('updated_datetime'))
+
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.UPDATE,
+            match=database_pb2.PostsEntry(global_id=1),
+            entry=database_pb2.PostsEntry(
+                title='hey',
+                updated_datetime={'seconds': 1000},
+            ),
+        )
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+
+        res = self.find_post(user=1)
+        self.assertEqual(res.results[0].title, 'hey')
+        self.assertEqual(res.results[0].updated_datetime.seconds, 1000)
+
+    def test_pins(self):
+        self.add_user(handle='tayne', host=None)  # local user, id 1
+        self.add_user(handle='tayne2', host=None)  # local user, id 2
+        self.add_post(author_id=1, title='hi', body='hello sam')
+
+        # Only the author can pin a post.
+        res = self.posts.AddPin(
+            database_pb2.PinEntry(user_id=2, article_id=1), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.ERROR_400)
+        res = self.posts.AddPin(
+            database_pb2.PinEntry(user_id=1, article_id=1), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertTrue(self.find_post(user=2).results[0].pinned)
+
+        res = self.posts.RemovePin(
+            database_pb2.PinEntry(user_id=1, article_id=1), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertFalse(self.find_post(user=2).results[0].pinned)
+
+    def test_replies(self):
+        self.add_user(handle='tayne', host=None)  # local user, id 1
+        self.add_post(author_id=1, title='hi', body='hello sam')
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.INSERT,
+            entry=database_pb2.PostsEntry(
+                author_id=1, body='hi yourself', in_reply_to=1),
+        )
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.FIND,
+            match=database_pb2.PostsEntry(in_reply_to=1),
+        )
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual(len(res.results), 1)
+        self.assertEqual(res.results[0].global_id, 2)
+        self.assertEqual(res.results[0].in_reply_to, 1)
+
+        # Replies are shown under their article, not in the feed.
+        res = self.instance_feed(5)
+        self.assertEqual([p.global_id for p in res.results], [1])
+
+    def test_mentions(self):
+        self.add_user(handle='tayne', host=None)  # local user, id 1
+        self.add_user(handle='sam', host=None)  # local user, id 2
+        self.add_user(handle='paul', host='rudd.com')  # foreign user, id 3
+        self.add_post(author_id=1, title='hi', body='hello sam and paul')
+        self.add_post(author_id=3, title='yo', body='hello sam')
+
+        res = self.posts.SetMentions(database_pb2.MentionsEntry(
+            article_id=1, user_ids=[2, 3]), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.posts.SetMentions(database_pb2.MentionsEntry(
+            article_id=2, user_ids=[2]), self.ctx)
+
+        res = self.posts.ArticleMentions(database_pb2.MentionsEntry(
+            article_id=1), self.ctx)
+        self.assertEqual(list(res.user_ids), [2, 3])
+        self.assertEqual([(u.handle, u.host) for u in res.users],
+                         [('sam', ''), ('paul', 'rudd.com')])
+
+        res = self.posts.UserMentions(database_pb2.UserMentionsRequest(
+            user_id=2), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertEqual([p.global_id for p in res.results], [2, 1])
+
+        # Editing an article replaces its mentions.
+        self.posts.SetMentions(database_pb2.MentionsEntry(
+            article_id=1, user_ids=[3]), self.ctx)
+        res = self.posts.UserMentions(database_pb2.UserMentionsRequest(
+            user_id=2), self.ctx)
+        self.assertEqual([p.global_id for p in res.results], [2])
+
+        self.posts.SafeRemovePost(database_pb2.PostsEntry(
+            global_id=2), self.ctx)
+        res = self.posts.UserMentions(database_pb2.UserMentionsRequest(
+            user_id=2), self.ctx)
+        self.assertEqual(len(res.results), 0)
+
+    def test_unlisted(self):
+        self.add_user(handle='tayne', host=None)  # local user, id 1
+        self.add_user(handle='paul', host='rudd.com')  # foreign user, id 2
+        self.add_post(author_id=2, title='yo', body='hello tayne')
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.INSERT,
+            entry=database_pb2.PostsEntry(
+                author_id=2, body='hi @tayne', tags='spam'),
+        )
+        req.entry.unlisted.value = True
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+
+        res = self.find_post(user=1, author_id=2)
+        self.assertEqual(
+            [(p.global_id, p.unlisted.value) for p in res.results],
+            [(2, True), (1, False)])
+
+        # Unlisted posts are only kept for their mentions.
+        res = self.posts.RandomPosts(database_pb2.RandomPostsRequest(
+            num_posts=5, user_id=1), self.ctx)
+        self.assertEqual([p.global_id for p in res.results], [1])
+        res = self.posts.TaggedPosts(database_pb2.PostsRequest(), self.ctx)
+        self.assertNotIn(2, [p.global_id for p in res.results])
+
+        # A post can be listed when a follower of its author receives it.
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.UPDATE,
+            match=database_pb2.PostsEntry(global_id=2),
+        )
+        req.entry.unlisted.value = False
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.FIND,
+            match=database_pb2.PostsEntry(global_id=2),
+        )
+        res = self.posts.Posts(req, self.ctx)
+        self.assertFalse(res.results[0].unlisted.value)
@@ -6,6 +6,7 @@ import database.servicers.posts_servicer as posts_servicer
 import database.servicers.users_servicer as users_servicer
 import database.servicers.like_servicer as like_servicer
 import database.servicers.follow_servicer as follow_servicer
+import database.servicers.reports_servicer as reports_servicer
 import database.db as database
 from services.proto import database_pb2
 from services.proto import general_pb2
@@ -33,6 +34,8 @@ class UsersDatabaseHelper(unittest.TestCase):
         self.users = users_servicer.UsersDatabaseServicer(self.db, logger)
         self.like = like_servicer.LikeDatabaseServicer(self.db, logger)
         self.follow = follow_servicer.FollowDatabaseServicer(self.db, logger)
+        self.reports = reports_servicer.ReportsDatabaseServicer(self.db,
+                                                                logger)
         self.ctx = fake_context()
 
     def add_user(self, handle=None, host=None):
@@ -69,6 +72,118 @@ class UsersDatabase(UsersDatabaseHelper):
         )
         self.assertEqual(want, res)
 
+    def test_local_usage(self):
+        local = self.add_user(handle='gerry adams', host=None).global_id
+        foreign = self.add_user(handle='mao_zedong', host='cpc.cn').global_id
+        for author in (local, local, foreign):
+            req = database_pb2.PostsRequest(
+                request_type=database_pb2.RequestType.INSERT,
+                entry=database_pb2.PostsEntry(author_id=author),
+            )
+            self.posts.Posts(req, self.ctx)
+        res = self.users.LocalUsage(database_pb2.LocalUsageRequest(), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertEqual(res.users, 1)
+        self.assertEqual(res.posts, 2)
+
+    def test_tombstone_user(self):
+        local = self.add_user(handle='tayne', host=None).global_id
+        foreign = self.add_user(handle='nude_tayne',
+                                host='celery.com').global_id
+        articles = []
+        for author in (local, foreign):
+            req = database_pb2.PostsRequest(
+                request_type=database_pb2.RequestType.INSERT,
+                entry=database_pb2.PostsEntry(author_id=author, title='hi'),
+            )
+            articles.append(self.posts.Posts(req, self.ctx).global_id)
+        self.like.AddLike(database_pb2.LikeEntry(
+            user_id=foreign, article_id=articles[0]), self.ctx)
+        self.like.AddLike(database_pb2.LikeEntry(
+            user_id=local, article_id=articles[1]), self.ctx)
+        self.follow.Follow(database_pb2.DbFollowRequest(
+            request_type=database_pb2.RequestType.INSERT,
+            entry=database_pb2.Follow(follower=local, followed=foreign,
+                                      state=database_pb2.Follow.ACTIVE),
+        ), self.ctx)
+
+        res = self.users.TombstoneUser(
+            database_pb2.TombstoneUserRequest(global_id=foreign), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.FIND)
+        req.user_global_id.value = local
+        res = self.posts.Posts(req, self.ctx)
+        self.assertEqual([(p.global_id, p.is_liked) for p in res.results],
+                         [(articles[0], False)])
+        self.assertEqual(self.db.execute('SELECT * FROM follows'), [])
+
+        # Local users can't be tombstoned.
+        res = self.users.TombstoneUser(
+            database_pb2.TombstoneUserRequest(global_id=local), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.ERROR_400)
+
+    def add_post(self, author, ap_id='', in_reply_to=0):
+        req = database_pb2.PostsRequest(
+            request_type=database_pb2.RequestType.INSERT,
+            entry=database_pb2.PostsEntry(author_id=author, title='hi',
+                                          ap_id=ap_id,
+                                          in_reply_to=in_reply_to),
+        )
+        return self.posts.Posts(req, self.ctx).global_id
+
+    def add_report(self, reporter, *objects):
+        req = database_pb2.ReportsRequest(
+            request_type=database_pb2.RequestType.INSERT,
+            entry=database_pb2.ReportEntry(reporter=reporter,
+                                           objects=objects),
+        )
+        return self.reports.Reports(req, self.ctx).global_id
+
+    def test_tombstone_user_cleans_up(self):
+        actor = 'https://celery.com/ap/@nude_tayne'
+        local = self.add_user(handle='tayne', host=None).global_id
+        foreign = self.add_user(handle='nude_tayne',
+                                host='celery.com').global_id
+        article = self.add_post(foreign, ap_id=actor + '/1')
+        reply = self.add_post(local, in_reply_to=article)
+        own_reply = self.add_post(foreign, ap_id=actor + '/2',
+                                  in_reply_to=article)
+        other = self.add_post(local)
+        self.posts.SetMentions(database_pb2.MentionsEntry(
+            article_id=article, user_ids=[local]), self.ctx)
+        self.posts.SetMentions(database_pb2.MentionsEntry(
+            article_id=other, user_ids=[foreign]), self.ctx)
+        self.posts.AddPin(database_pb2.PinEntry(
+            user_id=foreign, article_id=article), self.ctx)
+        local_actor = 'https://rabble.test/ap/@tayne'
+        by_actor = self.add_report(actor, local_actor)
+        about_actor = self.add_report(local_actor, actor, actor + '/1')
+        about_both = self.add_report(local_actor, actor, local_actor)
+
+        res = self.users.TombstoneUser(database_pb2.TombstoneUserRequest(
+            global_id=foreign, actor_id=actor), self.ctx)
+        self.assertEqual(res.result_type, general_pb2.ResultType.OK)
+        self.assertEqual(sorted(res.post_ids),
+                         sorted([article, reply, own_reply]))
+
+        # Replies to the deleted posts are unlisted rather than removed.
+        self.assertEqual(self.db.execute(
+            'SELECT global_id, unlisted FROM posts ORDER BY global_id'),
+            [(reply, 1), (other, 0)])
+        self.assertEqual(self.db.execute('SELECT * FROM mentions'), [])
+        self.assertEqual(self.db.execute('SELECT * FROM pins'), [])
+
+        res = self.reports.Reports(database_pb2.ReportsRequest(
+            request_type=database_pb2.RequestType.FIND), self.ctx)
+        states = {r.global_id: r.state for r in res.results}
+        self.assertEqual(states, {
+            by_actor: database_pb2.ReportEntry.DISMISSED,
+            about_actor: database_pb2.ReportEntry.DISMISSED,
+            about_both: database_pb2.ReportEntry.OPEN,
+        })
+
     def test_all_users(self):
         res = self.all_users()
         self.assertEqual(0, len(res.results))
@@ -20,7 +20,8 @@ class UsersDatabaseServicer:
             "SELECT u.global_id, u.handle, u.host, u.display_name, "
             "u.password, u.bio, u.rss, u.private, "
             "f.follower IS NOT NULL, "
-            "u.custom_css, u.public_key, u.private_key FROM users u "
+            "u.custom_css, u.public_key, u.private_key, u.profile_fields "
+            "FROM users u "
             "LEFT OUTER JOIN follows f ON "
             "f.followed=u.global_id AND f.follower=? "
         )
@@ -47,7 +48,7 @@ class UsersDatabaseServicer:
         return "", util.DONT_USE_FIELD
 
     def _db_tuple_to_entry(self, tup, entry):
-        if len(tup) != 12:
+        if len(tup) != 13:
             self._logger.warning(
                 CONVERT_ERROR + "Wrong number of elements " + str(tup))
             return False
@@ -68,6 +69,7 @@ class UsersDatabaseServicer:
             entry.custom_css = tup[9]
             entry.public_key = tup[10]
             entry.private_key = tup[11]
+            entry.profile_fields = tup[12]
         except Exception as e:
             self._logger.warning(CONVERT_ERROR + str(e))
             return False
@@ -186,6 +188,23 @@ class UsersDatabaseServicer:
                 del response.results[-1]
         return response
 
+    def LocalUsage(self, request, context):
+        response = database_pb2.LocalUsageResponse()
+        try:
+            db_res = self._db.execute(
+                'SELECT '
+                '(SELECT COUNT(*) FROM users WHERE host IS NULL), '
+                '(SELECT COUNT(*) FROM posts p '
+                'INNER JOIN users u ON p.author_id = u.global_id '
+                'WHERE u.host IS NULL)')
+        except sqlite3.Error as e:
+            response.result_type = general_pb2.ResultType.ERROR
+            response.error = str(e)
+            return response
+        response.result_type = general_pb2.ResultType.OK
+        response.users, response.posts = db_res[0]
+        return response
+
     def AllUserLikes(self, request, context):
         resp = database_pb2.UsersResponse()
         try:
@@ -224,6 +243,93 @@ class UsersDatabaseServicer:
                 break
         return resp
 
+    def TombstoneUser(self, request, context):
+        resp = database_pb2.TombstoneUserResponse()
+        if not request.global_id:
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = "Global ID is required for tombstone"
+            return resp
+        uid = request.global_id
+        try:
+            res = self._db.execute(
+                'SELECT host FROM users WHERE global_id = ?', uid)
+        except sqlite3.Error as e:
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+            return resp
+        if len(res) != 1 or res[0][0] is None:
+            # Local users are deleted through their own instance.
+            resp.result_type = general_pb2.ResultType.ERROR_400
+            resp.error = "No foreign user with id {}".format(uid)
+            return resp
+
+        own_posts = 'SELECT global_id FROM posts WHERE author_id = ?'
+        statements = [
+            ('UPDATE posts SET likes_count = likes_count - 1 '
+             'WHERE global_id IN '
+             '(SELECT article_id FROM likes WHERE user_id = ?)', uid),
+            ('UPDATE posts SET shares_count = shares_count - 1 '
+             'WHERE global_id IN '
+             '(SELECT article_id FROM shares WHERE user_id = ?)', uid),
+            ('DELETE FROM likes WHERE user_id = ? '
+             'OR article_id IN (' + own_posts + ')', uid, uid),
+            ('DELETE FROM shares WHERE user_id = ? '
+             'OR article_id IN (' + own_posts + ')', uid, uid),
+            ('DELETE FROM mentions WHERE user_id = ? '
+             'OR article_id IN (' + own_posts + ')', uid, uid),
+            ('DELETE FROM pins WHERE article_id IN (' + own_posts + ')', uid),
+            # Replies by others are kept, but without the post they answer
+            # they are left out of feeds and search.
+            ('UPDATE posts SET unlisted = 1 WHERE author_id != ? '
+             'AND in_reply_to IN (' + own_posts + ')', uid, uid),
+            ('DELETE FROM posts WHERE author_id = ?', uid),
+            ('DELETE FROM follows WHERE follower = ? OR followed = ?',
+             uid, uid),
+            ('DELETE FROM blocks WHERE blocker = ? OR blocked = ?',
+             uid, uid),
+            ("UPDATE users SET display_name = '', bio = '', "
+             "public_key = '' WHERE global_id = ?", uid),
+        ]
+        self._logger.info('Tombstoning user %d', uid)
+        try:
+            posts = self._db.execute(
+                'SELECT global_id, author_id, ap_id FROM posts '
+                'WHERE author_id = ? '
+                'OR in_reply_to IN (' + own_posts + ')',
+                uid, uid, commit=False)
+            for sql, *values in statements:
+                self._db.execute(sql, *values, commit=False)
+            self._dismiss_reports_of(request.actor_id, uid, posts)
+            self._db.commit()
+        except sqlite3.Error as e:
+            self._db.discard_cursor()
+            self._logger.error("Error tombstoning user: %s", str(e))
+            resp.result_type = general_pb2.ResultType.ERROR
+            resp.error = str(e)
+            return resp
+        resp.result_type = general_pb2.ResultType.OK
+        resp.post_ids.extend(p[0] for p in posts)
+        return resp
+
+    def _dismiss_reports_of(self, actor_id, uid, posts):
+        # Open reports filed by the actor, or only about them and their posts,
+        # are dismissed as there is nothing left to act on. This runs in the
+        # caller's transaction.
+        if not actor_id:
+            return
+        gone = {actor_id}
+        gone |= {ap_id for _, author, ap_id in posts if author == uid}
+        res = self._db.execute(
+            'SELECT global_id, reporter, objects FROM reports '
+            'WHERE state = ?', database_pb2.ReportEntry.OPEN, commit=False)
+        for global_id, reporter, objects in res:
+            objects = [o for o in objects.split('\n') if o]
+            if reporter != actor_id and not set(objects) <= gone:
+                continue
+            self._db.execute(
+                'UPDATE reports SET state = ? WHERE global_id = ?',
+                database_pb2.ReportEntry.DISMISSED, global_id, commit=False)
+
     def _users_handle_insert(self, req, resp):
         self._logger.info('Inserting new user into Users database.')
         try:
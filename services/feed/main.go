@@ -6,19 +6,27 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"sort"
 	"time"
 
 	pb "github.com/cpssd/rabble/services/proto"
 	utils "github.com/cpssd/rabble/services/utils"
+	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
 	"google.golang.org/grpc"
 )
 
 const (
 	MaxItemsReturned = 50
+
+	// maxThreadDepth is how deeply nested replies PerArticle returns.
+	maxThreadDepth = 8
 )
 
 type server struct {
 	db pb.DatabaseClient
+	// remoteActors fetches the actors of foreign users to find their pins.
+	remoteActors *utils.ActorResolver
 }
 
 func (s *server) convertManyToFeed(ctx context.Context, posts []*pb.PostsResponse, shares []*pb.SharesResponse) *pb.FeedResponse {
@@ -99,6 +107,7 @@ func (s *server) GetUserFeed(ctx context.Context, r *pb.FeedRequest) (*pb.FeedRe
 			return nil, err
 		}
 
+		resp.Results = feedArticles(resp.Results)
 		posts = append(posts, resp)
 
 		spr := &pb.SharedPostsRequest{
@@ -209,9 +218,104 @@ func (s *server) PerArticle(ctx context.Context, r *pb.ArticleRequest) (*pb.Feed
 	}
 	fp := &pb.FeedResponse{}
 	fp.Results = utils.ConvertDBToFeed(ctx, resp, s.db)
+	visible := map[int64]bool{author.GlobalId: true}
+	for _, p := range fp.Results {
+		if err := s.addReplies(ctx, p, r.UserGlobalId, visible, 0); err != nil {
+			return nil, err
+		}
+	}
 	return fp, nil
 }
 
+// feedArticles drops replies and unlisted posts from a list of posts, as
+// feeds only show articles. Replies are shown in the thread under their
+// article, and unlisted posts only to the users they mention.
+func feedArticles(posts []*pb.PostsEntry) []*pb.PostsEntry {
+	articles := []*pb.PostsEntry{}
+	for _, p := range posts {
+		if p.InReplyTo == 0 && !p.GetUnlisted().GetValue() {
+			articles = append(articles, p)
+		}
+	}
+	return articles
+}
+
+// canSee checks whether the user making a request may see the posts of
+// author, which for private users must be one of their followers.
+func (s *server) canSee(userGlobalID *wrapperpb.Int64Value, author *pb.UsersEntry) (bool, error) {
+	if author.Private == nil || !author.Private.Value {
+		return true, nil
+	} else if userGlobalID == nil {
+		return false, nil
+	}
+	return s.checkFollowing(userGlobalID.Value, author.GlobalId)
+}
+
+// visibleReplies drops the replies whose authors are private users the user
+// making the request doesn't follow. visible caches which authors can be
+// seen.
+func (s *server) visibleReplies(ctx context.Context, replies []*pb.PostsEntry, userGlobalID *wrapperpb.Int64Value, visible map[int64]bool) ([]*pb.PostsEntry, error) {
+	shown := []*pb.PostsEntry{}
+	for _, p := range replies {
+		ok, known := visible[p.AuthorId]
+		if !known {
+			author, err := utils.GetAuthorFromDb(ctx, "", "", false, p.AuthorId, s.db)
+			if err != nil {
+				return nil, err
+			}
+			if ok, err = s.canSee(userGlobalID, author); err != nil {
+				return nil, err
+			}
+			visible[p.AuthorId] = ok
+		}
+		if ok {
+			shown = append(shown, p)
+		}
+	}
+	return shown, nil
+}
+
+// addReplies fills in the thread of replies under a post, down to
+// maxThreadDepth. Replies by private users are only included for their
+// followers.
+func (s *server) addReplies(ctx context.Context, post *pb.Post, userGlobalID *wrapperpb.Int64Value, visible map[int64]bool, depth int) error {
+	if depth >= maxThreadDepth {
+		return nil
+	}
+	pr := &pb.PostsRequest{
+		RequestType:  pb.RequestType_FIND,
+		UserGlobalId: userGlobalID,
+		Match: &pb.PostsEntry{
+			InReplyTo: post.GlobalId,
+		},
+	}
+	resp, err := s.db.Posts(ctx, pr)
+	repliesErrFmt := "feed.PerArticle failed: db.Posts(%v) error: %v"
+	if err != nil {
+		return fmt.Errorf(repliesErrFmt, pr, err)
+	}
+	if resp.ResultType != pb.ResultType_OK {
+		return fmt.Errorf(repliesErrFmt, pr, resp.Error)
+	}
+
+	resp.Results, err = s.visibleReplies(ctx, resp.Results, userGlobalID, visible)
+	if err != nil {
+		return fmt.Errorf("feed.PerArticle failed: %v", err)
+	}
+
+	// Posts are found newest first, but conversations read oldest first.
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		return resp.Results[i].GlobalId < resp.Results[j].GlobalId
+	})
+	post.Replies = utils.ConvertDBToFeed(ctx, resp, s.db)
+	for _, reply := range post.Replies {
+		if err := s.addReplies(ctx, reply, userGlobalID, visible, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *server) checkFollowing(follower_id int64, followed_id int64) (bool, error) {
 	if follower_id == followed_id {
 		return true, nil // Users are 'following' themselves.
@@ -258,6 +362,8 @@ func (s *server) PerUser(ctx context.Context, r *pb.FeedRequest) (*pb.FeedRespon
 		return &pb.FeedResponse{Error: pb.FeedResponse_USER_NOT_FOUND}, nil
 	}
 	authorID := author.GlobalId
+	// ctx is replaced by the contexts of the database calls below.
+	reqCtx := ctx
 
 	if author.Private != nil && author.Private.Value {
 		if r.UserGlobalId == nil {
@@ -308,15 +414,55 @@ func (s *server) PerUser(ctx context.Context, r *pb.FeedRequest) (*pb.FeedRespon
 	if shareResp.ResultType != pb.ResultType_OK {
 		return nil, fmt.Errorf(shareErrFmt, *spr, shareResp.Error)
 	}
+	resp.Results = feedArticles(resp.Results)
+	if author.Host != "" {
+		s.markRemotePins(reqCtx, author, resp.Results)
+	}
+	// Pinned posts come first, and must do so before the feed is cut short.
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		return resp.Results[i].Pinned && !resp.Results[j].Pinned
+	})
+
 	fp := &pb.FeedResponse{}
 	fp.Results = utils.ConvertDBToFeed(ctx, resp, s.db)
 	fp.ShareResults = utils.ConvertShareToFeed(ctx, shareResp, s.db)
 	return fp, nil
 }
 
+// markRemotePins marks the posts of a foreign user which are in their
+// featured collection as pinned. Pinned posts we don't have aren't shown.
+// The actor and its pins are cached by remoteActors, so they are only
+// fetched once in a while.
+func (s *server) markRemotePins(ctx context.Context, author *pb.UsersEntry, posts []*pb.PostsEntry) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	a, err := s.remoteActors.Resolve(ctx, author.Handle, author.Host)
+	if err != nil {
+		log.Printf("Could not get actor of %s@%s for pins: %v", author.Handle, author.Host, err)
+		return
+	}
+	featured, err := s.remoteActors.FetchFeatured(ctx, a)
+	if err != nil {
+		log.Printf("Could not get pins of %s: %v", a.ID, err)
+		return
+	}
+	pinned := map[string]bool{}
+	for _, id := range featured {
+		pinned[id] = true
+	}
+	for _, p := range posts {
+		p.Pinned = pinned[p.ApId]
+	}
+}
+
 func newServer(c *grpc.ClientConn) *server {
 	db := pb.NewDatabaseClient(c)
-	return &server{db: db}
+	client := utils.NewRemoteHTTPClient(os.Getenv("ALLOW_PRIVATE_FETCHES") == "true")
+	return &server{
+		db:           db,
+		remoteActors: utils.NewActorResolver(client, utils.DefaultActorCacheTTL),
+	}
 }
 
 func main() {
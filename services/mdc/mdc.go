@@ -4,37 +4,178 @@ import (
 	"context"
 	"log"
 	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
 
 	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
 	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
 	"github.com/microcosm-cc/bluemonday"
 	"google.golang.org/grpc"
 )
 
+var (
+	// mentionRegexp matches mentions of local users, "@alice", and of users
+	// on other servers, "@alice@remote.host". The character before the @
+	// can't be part of a word, so email addresses aren't mentions.
+	mentionRegexp = regexp.MustCompile(
+		`(?:^|[^\w@/])(@(\w+)(?:@([\w-]+(?:\.[\w-]+)*(?::\d+)?))?)`)
+	hashtagRegexp = regexp.MustCompile(`(?:^|[^\w&/#])(#(\w+))`)
+)
+
 type MDServer struct {
 	sanitizer *bluemonday.Policy
+	// host is the normalised hostname of this server, used to link to
+	// profiles and tag searches in the web app.
+	host string
 }
 
-func newMDServer() *MDServer {
+func newMDServer(hostname string) *MDServer {
 	policy := bluemonday.UGCPolicy()
-	return &MDServer{sanitizer: policy}
+	return &MDServer{
+		sanitizer: policy,
+		host:      util.NormaliseHost(hostname),
+	}
+}
+
+// entity is a mention or hashtag found in some text.
+type entity struct {
+	start, end int
+	href       string
+}
+
+// findEntities finds the mentions and hashtags in text, in the order they
+// appear. The handles mentioned and the tags used are added to r.
+func (s *MDServer) findEntities(text string, r *pb.MDResponse) []entity {
+	var ents []entity
+	for _, m := range mentionRegexp.FindAllStringSubmatchIndex(text, -1) {
+		handle := text[m[4]:m[5]]
+		if m[6] != -1 {
+			handle += "@" + text[m[6]:m[7]]
+		}
+		ents = append(ents, entity{
+			start: m[2],
+			end:   m[3],
+			href:  s.host + "/#/@" + handle,
+		})
+		r.Mentions = appendUnique(r.Mentions, handle)
+	}
+	for _, m := range hashtagRegexp.FindAllStringSubmatchIndex(text, -1) {
+		tag := text[m[4]:m[5]]
+		if strings.Trim(tag, "0123456789") == "" {
+			// "#1" is more likely a number than a tag.
+			continue
+		}
+		ents = append(ents, entity{
+			start: m[2],
+			end:   m[3],
+			href:  s.host + "/#/search/" + url.PathEscape(tag),
+		})
+		r.Hashtags = appendUnique(r.Hashtags, tag)
+	}
+	sort.Slice(ents, func(i, j int) bool { return ents[i].start < ents[j].start })
+	return ents
+}
+
+// appendUnique appends s to l if it isn't in it yet, ignoring case.
+func appendUnique(l []string, s string) []string {
+	for _, e := range l {
+		if strings.EqualFold(e, s) {
+			return l
+		}
+	}
+	return append(l, s)
+}
+
+// linkText replaces t with the text around the entities in it and links to
+// them.
+func linkText(t *ast.Text, ents []entity) {
+	var nodes []ast.Node
+	last := 0
+	for _, e := range ents {
+		if e.start < last {
+			// Overlaps the previous entity.
+			continue
+		}
+		if e.start > last {
+			nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: t.Literal[last:e.start]}})
+		}
+		link := &ast.Link{Destination: []byte(e.href)}
+		ast.AppendChild(link, &ast.Text{Leaf: ast.Leaf{Literal: t.Literal[e.start:e.end]}})
+		nodes = append(nodes, link)
+		last = e.end
+	}
+	if last < len(t.Literal) {
+		nodes = append(nodes, &ast.Text{Leaf: ast.Leaf{Literal: t.Literal[last:]}})
+	}
+
+	parent := t.GetParent()
+	children := parent.GetChildren()
+	for i, c := range children {
+		if c != t {
+			continue
+		}
+		replaced := append(children[:i:i], nodes...)
+		replaced = append(replaced, children[i+1:]...)
+		for _, n := range nodes {
+			n.SetParent(parent)
+		}
+		parent.SetChildren(replaced)
+		return
+	}
+}
+
+// linkEntities links the mentions and hashtags in the text of doc, other
+// than in links and code.
+func (s *MDServer) linkEntities(doc ast.Node, r *pb.MDResponse) {
+	var texts []*ast.Text
+	ast.WalkFunc(doc, func(n ast.Node, entering bool) ast.WalkStatus {
+		switch n := n.(type) {
+		case *ast.Link, *ast.Image:
+			return ast.SkipChildren
+		case *ast.Text:
+			if entering {
+				texts = append(texts, n)
+			}
+		}
+		return ast.GoToNext
+	})
+	for _, t := range texts {
+		if ents := s.findEntities(string(t.Literal), r); len(ents) > 0 {
+			linkText(t, ents)
+		}
+	}
 }
 
 func (s *MDServer) MarkdownToHTML(ctx context.Context, r *pb.MDRequest) (*pb.MDResponse, error) {
-	unsafe := markdown.ToHTML([]byte(r.MdBody), nil, nil)
-	html := s.sanitizer.SanitizeBytes(unsafe)
-	return &pb.MDResponse{HtmlBody: string(html)}, nil
+	resp := &pb.MDResponse{}
+	doc := markdown.Parse([]byte(r.MdBody), nil)
+	s.linkEntities(doc, resp)
+	renderer := html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags})
+	unsafe := markdown.Render(doc, renderer)
+	resp.HtmlBody = string(s.sanitizer.SanitizeBytes(unsafe))
+	return resp, nil
 }
 
 func main() {
 	log.Print("Starting markdown converter.")
 
+	hostname := os.Getenv("HOST_NAME")
+	if hostname == "" {
+		log.Fatal("HOST_NAME env var not set for markdown converter.")
+	}
+
 	lis, err := net.Listen("tcp", ":1937")
 	if err != nil {
 		log.Fatalf("failed to listen to 0.0.0.0:1937: %v", err)
 	}
 
 	grpcSrv := grpc.NewServer()
-	pb.RegisterConverterServer(grpcSrv, newMDServer())
+	pb.RegisterConverterServer(grpcSrv, newMDServer(hostname))
 	grpcSrv.Serve(lis)
 }
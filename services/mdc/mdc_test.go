@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"reflect"
 	"testing"
 
 	pb "github.com/cpssd/rabble/services/proto"
@@ -30,7 +31,7 @@ func TestMarkdownToHTML(t *testing.T) {
 		},
 	}
 
-	s := newMDServer()
+	s := newMDServer("rabble.test")
 	for _, tcase := range tests {
 		req := &pb.MDRequest{MdBody: tcase.in}
 
@@ -46,3 +47,52 @@ func TestMarkdownToHTML(t *testing.T) {
 
 	}
 }
+
+func TestMarkdownToHTMLEntities(t *testing.T) {
+	tests := []struct {
+		in       string
+		want     string
+		mentions []string
+		hashtags []string
+	}{
+		{
+			in:       "Hi @alice and @bob@remote.host, see #rabble.",
+			want:     "<p>Hi <a href=\"https://rabble.test/#/@alice\" rel=\"nofollow\">@alice</a> and <a href=\"https://rabble.test/#/@bob@remote.host\" rel=\"nofollow\">@bob@remote.host</a>, see <a href=\"https://rabble.test/#/search/rabble\" rel=\"nofollow\">#rabble</a>.</p>\n",
+			mentions: []string{"alice", "bob@remote.host"},
+			hashtags: []string{"rabble"},
+		},
+		{
+			in:   "Mail alice@remote.host about issue #1",
+			want: "<p>Mail alice@remote.host about issue #1</p>\n",
+		},
+		{
+			in:   "`@alice #code` and [#link](http://remote.host)",
+			want: "<p><code>@alice #code</code> and <a href=\"http://remote.host\" rel=\"nofollow\">#link</a></p>\n",
+		},
+		{
+			in:       "#Go and #go",
+			want:     "<p><a href=\"https://rabble.test/#/search/Go\" rel=\"nofollow\">#Go</a> and <a href=\"https://rabble.test/#/search/go\" rel=\"nofollow\">#go</a></p>\n",
+			hashtags: []string{"Go"},
+		},
+	}
+
+	s := newMDServer("rabble.test")
+	for _, tcase := range tests {
+		r, err := s.MarkdownToHTML(context.Background(), &pb.MDRequest{MdBody: tcase.in})
+		if err != nil {
+			t.Fatalf("s.MarkdownToHTML(%v), unexpected error: %v", tcase.in, err)
+		}
+		if r.HtmlBody != tcase.want {
+			t.Errorf("s.MarkdownToHTML(%v)\ngot: \t%#v\nwant\t%#v",
+				tcase.in, r.HtmlBody, tcase.want)
+		}
+		if !reflect.DeepEqual(r.Mentions, tcase.mentions) {
+			t.Errorf("s.MarkdownToHTML(%v) mentions: got %v, want %v",
+				tcase.in, r.Mentions, tcase.mentions)
+		}
+		if !reflect.DeepEqual(r.Hashtags, tcase.hashtags) {
+			t.Errorf("s.MarkdownToHTML(%v) hashtags: got %v, want %v",
+				tcase.in, r.Hashtags, tcase.hashtags)
+		}
+	}
+}
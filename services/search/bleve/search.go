@@ -104,6 +104,15 @@ func (s *Server) initIndex() {
 		log.Fatalf("Failed to create index: %v", err)
 	}
 
+	// Unlisted posts are only kept for the users they mention.
+	listed := []*pb.PostsEntry{}
+	for _, p := range res.Results {
+		if !p.GetUnlisted().GetValue() {
+			listed = append(listed, p)
+		}
+	}
+	res.Results = listed
+
 	results := util.ConvertDBToFeed(ctx, res, s.db)
 
 	for _, blog := range results {
@@ -180,6 +189,25 @@ func (s *Server) Index(ctx context.Context, r *pb.IndexRequest) (*pb.GeneralResp
 	return &pb.GeneralResponse{}, nil
 }
 
+func (s *Server) Remove(ctx context.Context, r *pb.RemoveRequest) (*pb.GeneralResponse, error) {
+	for _, id := range r.GlobalIds {
+		if _, exists := s.idToDoc[id]; !exists {
+			continue
+		}
+		if err := s.index.Delete(strconv.FormatInt(id, 10)); err != nil {
+			log.Printf("Error removing %d from index: %v", id, err)
+			return &pb.GeneralResponse{
+				ResultType: pb.ResultType_ERROR,
+				Error:      err.Error(),
+			}, nil
+		}
+		delete(s.idToDoc, id)
+	}
+
+	log.Printf("Removed articles %v from index", r.GlobalIds)
+	return &pb.GeneralResponse{}, nil
+}
+
 func main() {
 	log.Print("Starting bleve search service.")
 
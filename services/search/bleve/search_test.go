@@ -298,3 +298,39 @@ func TestStop(t *testing.T) {
 		t.Fatalf("Expcted to find 0 posts, got %v", len(res.Results))
 	}
 }
+
+func TestRemove(t *testing.T) {
+	s := newMockedServer(t)
+	s.initIndex()
+
+	r := &pb.RemoveRequest{GlobalIds: []int64{3, 4, MAX_TEST_POST}}
+	res, err := s.Remove(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Failed to call Remove(%v): %v", r, err)
+	}
+	if res.ResultType != pb.ResultType_OK {
+		t.Fatalf("Failed to call Remove(%v): %v", r, res.Error)
+	}
+
+	c, err := s.index.DocCount()
+	if err != nil {
+		t.Fatalf("Failed to count index: %v", err)
+	}
+	if c != LEN_TEST_POST-2 || len(s.idToDoc) != LEN_TEST_POST-2 {
+		t.Fatalf("Expected %d posts in index, got %v and %v",
+			LEN_TEST_POST-2, c, len(s.idToDoc))
+	}
+
+	sr := &pb.SearchRequest{
+		Query: &pb.SearchQuery{QueryText: "HTML"},
+	}
+	search, err := s.Search(context.Background(), sr)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for _, p := range search.Results {
+		if p.GlobalId == 3 || p.GlobalId == 4 {
+			t.Errorf("Expected post %d to be removed from search", p.GlobalId)
+		}
+	}
+}
@@ -67,6 +67,11 @@ func (s *Server) Index(ctx context.Context, r *pb.IndexRequest) (*pb.GeneralResp
 	return &pb.GeneralResponse{}, nil
 }
 
+// Remove Simple search reads posts straight from the database so this is a no-op
+func (s *Server) Remove(ctx context.Context, r *pb.RemoveRequest) (*pb.GeneralResponse, error) {
+	return &pb.GeneralResponse{}, nil
+}
+
 // Search is the handler for all search calls to the simple-search
 func (s *Server) Search(ctx context.Context, r *pb.SearchRequest) (*pb.SearchResponse, error) {
 	log.Printf("Query: %s\n", r.Query.QueryText)
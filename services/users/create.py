@@ -4,6 +4,7 @@ import subprocess
 from services.proto import users_pb2
 from services.proto import database_pb2
 from services.proto import general_pb2
+from utils.users import INSTANCE_ACTOR_HANDLE
 
 
 class CreateHandler:
@@ -30,6 +31,11 @@ class CreateHandler:
         return public_key, private_key
 
     def Create(self, request, context):
+        if request.handle == INSTANCE_ACTOR_HANDLE:
+            return users_pb2.CreateUserResponse(
+                result_type=general_pb2.ResultType.ERROR,
+                error="Handle is reserved",
+            )
         public_key, private_key = self._create_public_and_private_key()
         insert_request = database_pb2.UsersRequest(
             request_type=database_pb2.RequestType.INSERT,
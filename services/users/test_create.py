@@ -2,6 +2,7 @@ import unittest
 from unittest.mock import Mock
 
 from users.create import CreateHandler
+from utils.users import INSTANCE_ACTOR_HANDLE
 from services.proto import database_pb2
 from services.proto import users_pb2
 from services.proto import general_pb2
@@ -48,3 +49,9 @@ class CreateHandlerTest(unittest.TestCase):
         self.assertNotEqual(self.db_stub.Users.call_args, None)
         db_req = self.db_stub.Users.call_args[0][0]
         self.assertEqual(db_req.entry.handle, "CianLR")
+
+    def test_reserved_handle(self):
+        req = self._make_request(INSTANCE_ACTOR_HANDLE)
+        resp = self.create_handler.Create(req, None)
+        self.assertEqual(resp.result_type, general_pb2.ResultType.ERROR)
+        self.db_stub.Users.assert_not_called()
@@ -1,4 +1,5 @@
 import bcrypt
+import json
 
 import unittest
 from unittest.mock import Mock
@@ -90,3 +91,33 @@ class UpdateHandlerTest(unittest.TestCase):
         )
         resp = self.update_handler.Update(req, None)
         self.assertEqual(resp.result, general_pb2.ResultType.ERROR_401)
+
+    def test_profile_fields(self):
+        user_lookup = database_pb2.UsersResponse(
+            result_type=general_pb2.ResultType.OK,
+            results=[self._make_user()],
+        )
+        user_update = database_pb2.UsersResponse(
+            result_type=general_pb2.ResultType.OK,
+        )
+        self.db_stub.Users.side_effect = [user_lookup, user_update]
+
+        req = self._make_request()
+        req.profile_fields.fields.add(name="Website", value="rabble.network")
+        resp = self.update_handler.Update(req, None)
+        self.assertEqual(resp.result, general_pb2.ResultType.OK)
+        entry = self.db_stub.Users.call_args[0][0].entry
+        self.assertEqual(json.loads(entry.profile_fields),
+                         [{"name": "Website", "value": "rabble.network"}])
+
+    def test_too_many_profile_fields(self):
+        self.db_stub.Users.return_value = database_pb2.UsersResponse(
+            result_type=general_pb2.ResultType.OK,
+            results=[self._make_user()],
+        )
+        req = self._make_request()
+        for i in range(5):
+            req.profile_fields.fields.add(name=str(i), value=str(i))
+        resp = self.update_handler.Update(req, None)
+        self.assertEqual(resp.result, general_pb2.ResultType.ERROR)
+        self.assertEqual(self.db_stub.Users.call_count, 1)
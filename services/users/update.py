@@ -4,6 +4,10 @@ from services.proto import general_pb2
 
 from users.util import get_user_and_check_pw
 import bcrypt
+import json
+
+# The most profile metadata fields a user can have, as in Mastodon.
+MAX_PROFILE_FIELDS = 4
 
 
 class UpdateHandler:
@@ -36,6 +40,18 @@ class UpdateHandler:
         if request.new_password:
             pw = self._hash_password(request.new_password)
 
+        profile_fields = None
+        if request.HasField('profile_fields'):
+            fields = request.profile_fields.fields
+            if len(fields) > MAX_PROFILE_FIELDS:
+                return users_pb2.UpdateUserResponse(
+                    result=general_pb2.ResultType.ERROR,
+                    error='At most {} profile fields are allowed'.format(
+                        MAX_PROFILE_FIELDS),
+                )
+            profile_fields = json.dumps(
+                [{'name': f.name, 'value': f.value} for f in fields])
+
         update_request = database_pb2.UsersRequest(
             request_type=database_pb2.RequestType.UPDATE,
             match=user,
@@ -45,6 +61,7 @@ class UpdateHandler:
                 bio=request.bio,
                 private=request.private,
                 custom_css=request.custom_css,
+                profile_fields=profile_fields,
             ),
         )
 
@@ -2,6 +2,7 @@ import json
 import sys
 import time
 import os
+from urllib.parse import quote
 
 from services.proto import database_pb2
 from services.proto import general_pb2
@@ -10,6 +11,9 @@ import requests
 
 from requests_http_signature import HTTPSignatureHeaderAuth
 
+# The collection of everyone, which public posts are addressed to.
+ACTIVITY_STREAMS_PUBLIC = "https://www.w3.org/ns/activitystreams#Public"
+
 
 class ActivitiesUtil:
     def __init__(self, logger, db):
@@ -172,9 +176,14 @@ class ActivitiesUtil:
         return f'{normalised_host}/#/@{author.handle}/{article.global_id}'
 
     def build_undo(self, obj):
+        # Only the actor of the undone activity may undo it.
+        actor = obj["actor"]
+        if isinstance(actor, dict):
+            actor = actor["id"]
         return {
             "@context": self.rabble_context(),
             "type": "Undo",
+            "actor": actor,
             "object": obj
         }
 
@@ -260,6 +269,88 @@ class ActivitiesUtil:
             "url": article_url,
         }
 
+    def build_local_article(self, ap_id, title, timestamp, author, content,
+                            summary, article_url, tags=None,
+                            mentioned_ids=None, in_reply_to=None,
+                            private=False):
+        """
+        Builds the ActivityPub object of an article by a local user, the same
+        as skinny serves at its id: addressed to the public, the author's
+        followers and the users mentioned, with its replies collection.
+        The articles of private authors aren't addressed to the public.
+        """
+        article = self.build_article(ap_id, title, timestamp, author, content,
+                                     summary, article_url=article_url)
+        if summary:
+            article["summary"] = summary
+        if private:
+            article["to"] = [author + "/followers"]
+            article["cc"] = list(mentioned_ids or [])
+        else:
+            article["to"] = [ACTIVITY_STREAMS_PUBLIC]
+            article["cc"] = ([author + "/followers"] +
+                             list(mentioned_ids or []))
+        article["tag"] = tags or []
+        article["replies"] = {
+            "id": ap_id + "/replies",
+            "type": "OrderedCollection",
+        }
+        if in_reply_to is not None:
+            # Comments are untitled, so are sent as Notes.
+            article["type"] = "Note"
+            article["inReplyTo"] = in_reply_to
+        return article
+
+    def build_create(self, article):
+        """
+        Wraps an article built by build_local_article in the Create activity
+        publishing it, which skinny serves next to the article.
+        """
+        return {
+            "@context": self.rabble_context(),
+            "type": "Create",
+            "id": article["id"] + "/activity",
+            "actor": article["attributedTo"],
+            "published": article["published"],
+            "to": article["to"],
+            "cc": article["cc"],
+            "object": article,
+        }
+
+    def build_article_tags(self, article, mentioned):
+        """
+        Builds the tag array of an article, with a Hashtag for each of its
+        tags and a Mention of each user in mentioned.
+        article must be a PostsEntry proto, mentioned a list of UsersEntry.
+        Returns the tags and the actor ids of the mentioned users, who the
+        article is addressed to.
+        """
+        normalised_host = self.normalise_hostname(self._hostname)
+        tags = []
+        for tag in article.tags.split('|') if article.tags else []:
+            tag = tag.replace('%7C', '|')
+            tags.append({
+                "type": "Hashtag",
+                "href": f'{normalised_host}/#/search/{quote(tag, safe="")}',
+                "name": '#' + tag,
+            })
+        mentioned_ids = []
+        for user in mentioned:
+            host = user.host if user.host else self._hostname
+            actor = self.build_actor(user.handle, host)
+            if actor is None:
+                self._logger.warning('Could not find actor of %s@%s',
+                                     user.handle, host)
+                continue
+            tags.append({
+                "type": "Mention",
+                "href": actor,
+                "name": '@{}@{}'.format(
+                    user.handle, self._remove_protocol_from_host(host)),
+            })
+            mentioned_ids.append(actor)
+        return tags, mentioned_ids
+
     def send_activity(self, activity, target_inbox, sender_id=None):
         body = json.dumps(activity).encode("utf-8")
         headers = {"Content-Type": "application/ld+json"}
@@ -309,11 +400,30 @@ class ActivitiesUtil:
             return None, "No matching DB entry for this article"
         return resp.results[0], None
 
+    def has_blocked(self, blocker_id, blocked_id):
+        """
+        Reports whether blocker_id has blocked blocked_id, in which case
+        nothing from blocked_id may be sent to them. If the blocks can't be
+        read this errs on the side of the block existing.
+        """
+        resp = self._db.FindBlock(database_pb2.BlockEntry(
+            blocker=blocker_id,
+            blocked=blocked_id,
+        ))
+        if resp.result_type != general_pb2.ResultType.OK:
+            self._logger.error(
+                "Error finding block of %d by %d: %s",
+                blocked_id, blocker_id, resp.error)
+            return True
+        return resp.exists
+
     def forward_activity_to_followers(self, user_id, activity):
         """
         Sends an activity to all of the hosts with a follower of a given user.
         Some things to note about the behaviour:
+         - The activity is signed with the given user's key
          - Local users do not receive the activity
+         - Followers who have blocked the user do not receive the activity
          - An arbitrary user from each host is selected to receive the activity
          - Any followers or hosts not found are skipped with a warning.
         """
@@ -342,11 +452,13 @@ class ActivitiesUtil:
             user = user_resp.results[0]
             if not user.host or user.host_is_null:
                 continue  # Local user, skip.
+            if self.has_blocked(user.global_id, user_id):
+                continue
             hosts_to_users[user.host] = user
         # Send the activities off.
         for host, user in hosts_to_users.items():
             inbox = self.build_inbox_url(user.handle, host)
-            resp, err = self.send_activity(activity, inbox)
+            resp, err = self.send_activity(activity, inbox, sender_id=user_id)
             if err:
                 self._logger.warning(
                     "Error sending activity to '%s' at '%s': %s",
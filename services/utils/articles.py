@@ -9,6 +9,29 @@ def md_to_html(md, body):
     return res.html_body
 
 
+def convert_md(md, body):
+    """
+    Converts a markdown body to HTML. Returns the HTML, the users mentioned,
+    as "alice" or "alice@remote.host", and the hashtags used in the body.
+    """
+    convert_req = mdc_pb2.MDRequest(md_body=body)
+    res = md.MarkdownToHTML(convert_req)
+    return res.html_body, list(res.mentions), list(res.hashtags)
+
+
+def merge_tags(tags, hashtags):
+    """
+    Returns tags followed by the hashtags not already in them, ignoring case.
+    """
+    merged = list(tags)
+    seen = set(t.lower() for t in merged)
+    for tag in hashtags:
+        if tag.lower() not in seen:
+            merged.append(tag)
+            seen.add(tag.lower())
+    return merged
+
+
 def convert_to_tags_string(tags_array):
     # Using | to separate tags. So url encode | character in tags
     tags_array = [x.replace("|", "%7C") for x in tags_array]
@@ -62,3 +85,45 @@ def get_sharers_of_article(logger, db, global_id):
         logger.error("Error getting sharers: %s", resp.error)
         return None
     return list(e.sharer_id for e in resp.results)
+
+
+def set_mentions(logger, db, users_util, global_id, mentions):
+    """
+    Records that the users in mentions, given as "alice" or
+    "alice@remote.host", are mentioned in the article global_id, replacing
+    any mentions it had. Users that can't be found are skipped.
+    Returns True on success and False on error.
+    """
+    user_ids = []
+    for mention in mentions:
+        user = users_util.get_mentioned_user(mention)
+        if user is not None and user.global_id not in user_ids:
+            user_ids.append(user.global_id)
+    logger.info("Article %d mentions users %s", global_id, user_ids)
+    resp = db.SetMentions(database_pb2.MentionsEntry(
+        article_id=global_id,
+        user_ids=user_ids,
+    ))
+    if resp.result_type != general_pb2.ResultType.OK:
+        logger.error("Error setting mentions: %s", resp.error)
+        return False
+    return True
+
+
+def get_mentioned_users(logger, db, users_util, global_id):
+    """
+    Returns the UsersEntry of the users mentioned in the article global_id.
+    Returns an empty list on error.
+    """
+    resp = db.ArticleMentions(database_pb2.MentionsEntry(
+        article_id=global_id,
+    ))
+    if resp.result_type != general_pb2.ResultType.OK:
+        logger.error("Error getting mentions: %s", resp.error)
+        return []
+    users = []
+    for user_id in resp.user_ids:
+        user = users_util.get_user_from_db(global_id=user_id)
+        if user is not None:
+            users.append(user)
+    return users
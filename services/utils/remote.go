@@ -0,0 +1,100 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxRemoteBodySize is the most that is read of a document fetched
+	// from another server.
+	MaxRemoteBodySize = 1 << 20
+
+	remoteFetchTimeout = 10 * time.Second
+)
+
+// privateNetworks are the address ranges which aren't reachable from the
+// internet, other than loopback and link-local addresses.
+var privateNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// IsPublicIP reports whether ip is an address on the public internet.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialPublicOnly is a net.Dialer Control function refusing connections to
+// addresses which aren't public. It is run after the host is resolved, so
+// it also covers redirects and names resolving to internal addresses.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+// NewRemoteHTTPClient creates a client for fetching documents from other
+// servers. As the URLs come from remote input, it won't connect to private,
+// loopback or link-local addresses, so that other servers can't make us
+// request internal services. allowPrivate turns this off, for development
+// instances federating on a private network.
+func NewRemoteHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   remoteFetchTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = dialPublicOnly
+	}
+	return &http.Client{
+		Timeout: remoteFetchTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   remoteFetchTimeout,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// DecodeRemoteJSON decodes a JSON document fetched from another server into
+// v, reading at most MaxRemoteBodySize bytes of it.
+func DecodeRemoteJSON(body io.Reader, v interface{}) error {
+	return json.NewDecoder(io.LimitReader(body, MaxRemoteBodySize)).Decode(v)
+}
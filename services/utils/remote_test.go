@@ -0,0 +1,61 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, tc := range []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.5", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	} {
+		if got := IsPublicIP(net.ParseIP(tc.ip)); got != tc.want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+}
+
+func TestRemoteHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "x"}`))
+	}))
+	defer srv.Close()
+
+	if _, err := NewRemoteHTTPClient(false).Get(srv.URL); err == nil {
+		t.Errorf("Expected fetching from a loopback address to fail")
+	}
+	resp, err := NewRemoteHTTPClient(true).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected fetch to work when private addresses are allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDecodeRemoteJSON(t *testing.T) {
+	big := `{"id": "` + strings.Repeat("a", MaxRemoteBodySize) + `"}`
+	var v struct {
+		ID string `json:"id"`
+	}
+	if err := DecodeRemoteJSON(strings.NewReader(big), &v); err == nil {
+		t.Errorf("Expected error decoding a document over the size limit")
+	}
+	if err := DecodeRemoteJSON(strings.NewReader(`{"id": "x"}`), &v); err != nil || v.ID != "x" {
+		t.Errorf("Expected id x, got %#v, %v", v.ID, err)
+	}
+}
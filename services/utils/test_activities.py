@@ -3,6 +3,7 @@ import unittest
 
 from unittest.mock import Mock
 from utils.activities import ActivitiesUtil
+from services.proto import database_pb2
 
 
 class ActivitiesUtilTest(unittest.TestCase):
@@ -26,3 +27,65 @@ class ActivitiesUtilTest(unittest.TestCase):
         _, e = self.activ_util.send_activity(activity,
                                              'https://followed.com/ap/@b/inbox')
         self.assertIsNone(e)
+
+    def test_build_article_tags(self):
+        self.activ_util._get_activitypub_actor_url = Mock(
+            return_value='https://c.com/users/c')
+        article = database_pb2.PostsEntry(tags='rabble|first post')
+        mentioned = [
+            database_pb2.UsersEntry(handle='a'),
+            database_pb2.UsersEntry(handle='c', host='https://c.com'),
+        ]
+        tags, cc = self.activ_util.build_article_tags(article, mentioned)
+        self.assertEqual(tags, [
+            {'type': 'Hashtag', 'href': 'https://b.com/#/search/rabble',
+             'name': '#rabble'},
+            {'type': 'Hashtag', 'href': 'https://b.com/#/search/first%20post',
+             'name': '#first post'},
+            {'type': 'Mention', 'href': 'https://b.com/ap/@a',
+             'name': '@a@b.com'},
+            {'type': 'Mention', 'href': 'https://c.com/users/c',
+             'name': '@c@c.com'},
+        ])
+        self.assertEqual(cc, ['https://b.com/ap/@a', 'https://c.com/users/c'])
+
+    def test_build_undo(self):
+        like = {'type': 'Like', 'object': 'https://c.com/notes/2',
+                'actor': {'type': 'Person', 'id': 'https://b.com/ap/@a'}}
+        undo = self.activ_util.build_undo(like)
+        self.assertEqual(undo['type'], 'Undo')
+        self.assertEqual(undo['actor'], 'https://b.com/ap/@a')
+        self.assertIs(undo['object'], like)
+
+    def test_build_create(self):
+        article = self.activ_util.build_local_article(
+            'https://b.com/ap/@a/1', 'Title', '2019-01-01T00:00:00Z',
+            'https://b.com/ap/@a', 'Body', 'Summary',
+            'https://b.com/#/@a/1', mentioned_ids=['https://c.com/users/c'],
+            in_reply_to='https://c.com/notes/2')
+        self.assertEqual(article['type'], 'Note')
+        self.assertEqual(article['inReplyTo'], 'https://c.com/notes/2')
+        self.assertEqual(article['summary'], 'Summary')
+        self.assertEqual(article['to'],
+                         ['https://www.w3.org/ns/activitystreams#Public'])
+        self.assertEqual(article['cc'], ['https://b.com/ap/@a/followers',
+                                         'https://c.com/users/c'])
+        self.assertEqual(article['replies'],
+                         {'id': 'https://b.com/ap/@a/1/replies',
+                          'type': 'OrderedCollection'})
+
+        private = self.activ_util.build_local_article(
+            'https://b.com/ap/@a/1', 'Title', '2019-01-01T00:00:00Z',
+            'https://b.com/ap/@a', 'Body', 'Summary',
+            'https://b.com/#/@a/1', mentioned_ids=['https://c.com/users/c'],
+            private=True)
+        self.assertEqual(private['to'], ['https://b.com/ap/@a/followers'])
+        self.assertEqual(private['cc'], ['https://c.com/users/c'])
+
+        create = self.activ_util.build_create(article)
+        self.assertEqual(create['type'], 'Create')
+        self.assertEqual(create['id'], 'https://b.com/ap/@a/1/activity')
+        self.assertEqual(create['actor'], 'https://b.com/ap/@a')
+        self.assertEqual(create['to'], article['to'])
+        self.assertEqual(create['cc'], article['cc'])
+        self.assertIs(create['object'], article)
@@ -2,6 +2,7 @@ import logging
 import os
 import unittest
 
+from services.proto import database_pb2
 from utils.users import UsersUtil
 
 
@@ -44,6 +45,18 @@ class UsersUtilTest(unittest.TestCase):
         self.assertEqual(a, 'https://neopets.com')
         self.assertEqual(b, 'cianlr')
 
+    def test_is_actor_of(self):
+        author = database_pb2.UsersEntry(handle='cianlr',
+                                         host='https://neopets.com')
+        self.assertTrue(self.util.is_actor_of(
+            'https://neopets.com/@cianlr', author))
+        self.assertFalse(self.util.is_actor_of(
+            'https://evil.com/@cianlr', author))
+        self.assertFalse(self.util.is_actor_of('', author))
+        local = database_pb2.UsersEntry(handle='cianlr', host_is_null=True)
+        self.assertFalse(self.util.is_actor_of(
+            'https://neopets.com/@cianlr', local))
+
     def test_parse_bad_username(self):
         with self.assertLogs(self.logger, level='WARNING'):
             a, b = self.util.parse_username('a@b@c')
@@ -2,6 +2,10 @@ from urllib.parse import urlparse
 
 import requests
 
+from cryptography.hazmat.backends import default_backend
+from cryptography.hazmat.primitives import serialization
+from cryptography.hazmat.primitives.asymmetric import rsa
+
 from services.proto import database_pb2
 from services.proto import general_pb2
 
@@ -9,6 +13,10 @@ from utils.activities import ActivitiesUtil
 
 MAX_FIND_RETRIES = 3
 
+# The handle of the local account that acts for the instance itself, such as
+# when it reports foreign posts. Nobody can register it or log in as it.
+INSTANCE_ACTOR_HANDLE = 'instance.actor'
+
 
 class UsersUtil:
 
@@ -156,6 +164,76 @@ class UsersUtil:
                                                host,
                                                attempt_number=attempt_number + 1)
 
+    def _create_key_pair(self):
+        key = rsa.generate_private_key(public_exponent=65537, key_size=2048,
+                                       backend=default_backend())
+        private_key = key.private_bytes(
+            encoding=serialization.Encoding.PEM,
+            format=serialization.PrivateFormat.TraditionalOpenSSL,
+            encryption_algorithm=serialization.NoEncryption())
+        public_key = key.public_key().public_bytes(
+            encoding=serialization.Encoding.PEM,
+            format=serialization.PublicFormat.SubjectPublicKeyInfo)
+        return public_key.decode('utf-8'), private_key.decode('utf-8')
+
+    def get_or_create_instance_actor(self):
+        """
+        Returns the local account that activities are sent as when they
+        shouldn't come from any user, creating it with a key pair the first
+        time. It has no password, so nobody can log in as it.
+        """
+        user = self.get_user_from_db(handle=INSTANCE_ACTOR_HANDLE,
+                                     host_is_null=True)
+        if user is not None:
+            return user
+        public_key, private_key = self._create_key_pair()
+        user_entry = database_pb2.UsersEntry(
+            handle=INSTANCE_ACTOR_HANDLE,
+            display_name=self._activ_util._hostname,
+            host_is_null=True,
+            public_key=public_key,
+            private_key=private_key,
+        )
+        if self._create_user_in_db(user_entry) is None:
+            # Another request may have created it first.
+            self._logger.info('Could not create instance actor, finding it')
+        return self.get_user_from_db(handle=INSTANCE_ACTOR_HANDLE,
+                                     host_is_null=True)
+
+    def get_mentioned_user(self, mention):
+        """
+        Returns the user mentioned as "alice" or "alice@remote.host", or None
+        if there is no such user. Foreign users we don't know yet are added
+        to the database if their server has them.
+        """
+        handle, host = self.parse_username(mention)
+        if handle is None:
+            return None
+        local_host = self._activ_util.normalise_hostname(
+            self._activ_util._hostname)
+        if (host is None or
+                self._activ_util.normalise_hostname(host) == local_host):
+            return self.get_user_from_db(handle=handle, host_is_null=True)
+        user = self.get_user_from_db(handle=handle, host=host)
+        if user is not None:
+            return user
+        if self._activ_util.build_actor(handle, host) is None:
+            self._logger.info('Mentioned user %s does not exist', mention)
+            return None
+        return self.get_or_create_user_from_db(handle=handle, host=host)
+
+    def is_actor_of(self, actor_uri, user):
+        """
+        Checks that actor_uri is the actor of a foreign user from the
+        database, so that they may act on what that user wrote.
+        """
+        if not actor_uri or not user.host:
+            return False
+        host, handle = self.parse_actor(actor_uri)
+        return (handle is not None and
+                handle == user.handle and
+                self._activ_util.normalise_hostname(user.host) == host)
+
     def user_is_local(self, global_id):
         user = self.get_user_from_db(global_id=global_id)
         if user is None:
@@ -230,3 +308,18 @@ class UsersUtil:
             if follower_entry.host:
                 foreign_followers.append(follower_entry)
         return foreign_followers
+
+    def remove_blocking_users(self, user_id, users):
+        """
+        Removes the users who have blocked user_id, who must not be sent
+        anything by them.
+        """
+        unblocked = []
+        for user in users:
+            if self._activ_util.has_blocked(user.global_id, user_id):
+                self._logger.info(
+                    "Not sending to %s@%s, who has blocked user %d",
+                    user.handle, user.host, user_id)
+                continue
+            unblocked.append(user)
+        return unblocked
@@ -212,6 +212,8 @@ func ConvertDBToFeed(ctx context.Context, p *pb.PostsResponse, db UsersGetter) [
 			SharesCount:   r.SharesCount,
 			Tags:          tags,
 			Summary:       r.Summary,
+			Pinned:        r.Pinned,
+			InReplyTo:     r.InReplyTo,
 		}
 		pe = append(pe, np)
 	}
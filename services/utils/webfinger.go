@@ -0,0 +1,469 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultActorCacheTTL is how long resolved actors are kept by an
+	// ActorResolver unless another TTL is given.
+	DefaultActorCacheTTL = time.Hour
+
+	// actorCacheSize is the most actors and accounts an ActorResolver
+	// keeps. Once it is reached expired entries are dropped, and if that
+	// isn't enough some of the others too.
+	actorCacheSize = 10000
+
+	activityJSONType = "application/activity+json"
+	ldJSONType       = "application/ld+json"
+)
+
+// ActorNotFoundErr is returned when a remote actor doesn't exist.
+var ActorNotFoundErr = errors.New("remote actor not found")
+
+// actorTypes are the ActivityStreams types an actor document may have.
+// See https://www.w3.org/TR/activitystreams-vocabulary/#actor-types
+var actorTypes = map[string]bool{
+	"Application":  true,
+	"Group":        true,
+	"Organization": true,
+	"Person":       true,
+	"Service":      true,
+}
+
+// IsActorType reports whether t is the ActivityStreams type of an actor.
+func IsActorType(t string) bool {
+	return actorTypes[t]
+}
+
+// RemoteActorKey is the public key published in a remote actor document.
+type RemoteActorKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// RemoteActorEndpoints holds the optional endpoints of a remote actor.
+type RemoteActorEndpoints struct {
+	SharedInbox string `json:"sharedInbox"`
+}
+
+// RemoteActor holds the fields of a remote actor document we use.
+// See https://www.w3.org/TR/activitypub/#actor-objects
+type RemoteActor struct {
+	ID                string                `json:"id"`
+	Type              string                `json:"type"`
+	PreferredUsername string                `json:"preferredUsername"`
+	Name              string                `json:"name"`
+	Summary           string                `json:"summary"`
+	Inbox             string                `json:"inbox"`
+	Outbox            string                `json:"outbox"`
+	Followers         string                `json:"followers"`
+	Following         string                `json:"following"`
+	Endpoints         *RemoteActorEndpoints `json:"endpoints"`
+	PublicKey         *RemoteActorKey       `json:"publicKey"`
+	// AlsoKnownAs are the ids of other accounts of the actor, which may move
+	// to it.
+	AlsoKnownAs IDList `json:"alsoKnownAs"`
+	// MovedTo is the id of the account the actor moved to, if it has.
+	MovedTo string `json:"movedTo"`
+	// Featured is the collection of posts the actor pinned.
+	Featured string `json:"featured"`
+}
+
+// IDList is a list of ActivityPub ids, which may be given in JSON as either
+// an array or a single id.
+type IDList []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (l *IDList) UnmarshalJSON(b []byte) error {
+	var id string
+	if err := json.Unmarshal(b, &id); err == nil {
+		*l = IDList{id}
+		return nil
+	}
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return err
+	}
+	*l = ids
+	return nil
+}
+
+// Host returns the normalised host of the actor, as stored in the users
+// table for foreign users.
+func (a *RemoteActor) Host() string {
+	u, err := url.Parse(a.ID)
+	if err != nil {
+		return ""
+	}
+	return NormaliseHost(u.Host)
+}
+
+// SharedInbox returns the shared inbox of the actor if it has one, and
+// otherwise its own inbox.
+func (a *RemoteActor) SharedInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+type webfingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+type webfingerResource struct {
+	Subject string          `json:"subject"`
+	Links   []webfingerLink `json:"links"`
+}
+
+type cachedActor struct {
+	actor   *RemoteActor
+	expires time.Time
+}
+
+type cachedFeatured struct {
+	ids     []string
+	expires time.Time
+}
+
+// ActorResolver looks up remote actors by handle using WebFinger, and
+// fetches their actor documents. Results are cached for the given TTL, up
+// to a fixed number of them.
+//
+// It is safe for concurrent use.
+type ActorResolver struct {
+	client  *http.Client
+	ttl     time.Duration
+	now     func() time.Time
+	maxSize int
+
+	mu sync.Mutex
+	// actors is keyed by actor id.
+	actors map[string]*cachedActor
+	// accounts maps "handle@host" to an actor id.
+	accounts map[string]string
+	// featured is keyed by the id of a featured collection.
+	featured map[string]*cachedFeatured
+}
+
+// NewActorResolver creates an ActorResolver which caches actors for ttl.
+// If client is nil, http.DefaultClient is used.
+func NewActorResolver(client *http.Client, ttl time.Duration) *ActorResolver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if ttl <= 0 {
+		ttl = DefaultActorCacheTTL
+	}
+	return &ActorResolver{
+		client:   client,
+		ttl:      ttl,
+		now:      time.Now,
+		maxSize:  actorCacheSize,
+		actors:   map[string]*cachedActor{},
+		accounts: map[string]string{},
+		featured: map[string]*cachedFeatured{},
+	}
+}
+
+// makeRoom drops entries from the caches once they are full, first those
+// which expired and then arbitrary others, until a tenth of the space is
+// free. It must be called with mu held.
+func (r *ActorResolver) makeRoom() {
+	if len(r.actors) < r.maxSize && len(r.accounts) < r.maxSize &&
+		len(r.featured) < r.maxSize {
+		return
+	}
+	now := r.now()
+	for id, c := range r.actors {
+		if now.After(c.expires) {
+			delete(r.actors, id)
+		}
+	}
+	target := r.maxSize - r.maxSize/10 - 1
+	for id, c := range r.featured {
+		if now.After(c.expires) || len(r.featured) > target {
+			delete(r.featured, id)
+		}
+	}
+	for id := range r.actors {
+		if len(r.actors) <= target {
+			break
+		}
+		delete(r.actors, id)
+	}
+	for account, id := range r.accounts {
+		if _, ok := r.actors[id]; !ok || len(r.accounts) > target {
+			delete(r.accounts, account)
+		}
+	}
+}
+
+func (r *ActorResolver) get(ctx context.Context, u string, accept string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ActorNotFoundErr
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("got status %d from %s", resp.StatusCode, u)
+	}
+	return DecodeRemoteJSON(resp.Body, v)
+}
+
+// Webfinger looks up the actor id of handle@host.
+func (r *ActorResolver) Webfinger(ctx context.Context, handle, host string) (string, error) {
+	base, err := url.Parse(NormaliseHost(host))
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("invalid host %#v", host)
+	}
+	q := url.Values{}
+	q.Set("resource", fmt.Sprintf("acct:%s@%s", handle, base.Host))
+	u := fmt.Sprintf("%s/.well-known/webfinger?%s", base.String(), q.Encode())
+
+	var res webfingerResource
+	if err := r.get(ctx, u, "application/jrd+json, application/json", &res); err != nil {
+		return "", err
+	}
+	for _, l := range res.Links {
+		if l.Rel != "self" || l.Href == "" {
+			continue
+		}
+		if l.Type == activityJSONType || strings.HasPrefix(l.Type, ldJSONType) {
+			return l.Href, nil
+		}
+	}
+	// Without an ActivityPub actor the account isn't in the fediverse.
+	return "", ActorNotFoundErr
+}
+
+func (r *ActorResolver) cached(id string) (*RemoteActor, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.actors[id]
+	if !ok || r.now().After(c.expires) {
+		return nil, false
+	}
+	return c.actor, true
+}
+
+func validateActor(id string, a *RemoteActor) error {
+	if a.ID == "" || a.Inbox == "" || a.PreferredUsername == "" {
+		return fmt.Errorf("actor %s is missing id, inbox or preferredUsername", id)
+	}
+	if !IsActorType(a.Type) {
+		return fmt.Errorf("actor %s has type %#v", id, a.Type)
+	}
+	// The document must describe itself, or anyone could serve an actor
+	// document claiming to be someone else.
+	want, err := url.Parse(id)
+	if err != nil {
+		return err
+	}
+	got, err := url.Parse(a.ID)
+	if err != nil || got.Host != want.Host {
+		return fmt.Errorf("actor %s claims to be %s", id, a.ID)
+	}
+	return nil
+}
+
+// FetchActor fetches and validates the actor document with the given id.
+func (r *ActorResolver) FetchActor(ctx context.Context, id string) (*RemoteActor, error) {
+	if a, ok := r.cached(id); ok {
+		return a, nil
+	}
+
+	var a RemoteActor
+	accept := activityJSONType + `, ` + ldJSONType +
+		`; profile="https://www.w3.org/ns/activitystreams"`
+	if err := r.get(ctx, id, accept, &a); err != nil {
+		return nil, err
+	}
+	if err := validateActor(id, &a); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.makeRoom()
+	c := &cachedActor{actor: &a, expires: r.now().Add(r.ttl)}
+	r.actors[id] = c
+	r.actors[a.ID] = c
+	r.mu.Unlock()
+	return &a, nil
+}
+
+// Forget drops the actor with the given id from the cache, so that the next
+// lookup fetches it again. It returns the actor it dropped, even if it had
+// expired, or nil if it wasn't cached or has since been evicted.
+func (r *ActorResolver) Forget(id string) *RemoteActor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.actors[id]
+	if !ok {
+		return nil
+	}
+	for k, v := range r.actors {
+		if v == c {
+			delete(r.actors, k)
+		}
+	}
+	return c.actor
+}
+
+// confirmAccount checks that an actor found by WebFinger on host is on host,
+// or else that the actor's own server gives it when asked by WebFinger too.
+// Otherwise any server could claim the actors of another as its accounts.
+func (r *ActorResolver) confirmAccount(ctx context.Context, host string, a *RemoteActor) error {
+	base, err := url.Parse(NormaliseHost(host))
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(a.ID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(u.Host, base.Host) {
+		return nil
+	}
+	id, err := r.Webfinger(ctx, a.PreferredUsername, u.Host)
+	if err != nil {
+		return fmt.Errorf("could not confirm %s for %s: %v", a.ID, host, err)
+	} else if id != a.ID {
+		return fmt.Errorf("%s doesn't confirm %s for %s", u.Host, a.ID, host)
+	}
+	return nil
+}
+
+// Resolve finds the actor for handle@host using WebFinger, and fetches its
+// actor document. Actors on other hosts are only returned if their own host
+// confirms them, see confirmAccount.
+func (r *ActorResolver) Resolve(ctx context.Context, handle, host string) (*RemoteActor, error) {
+	account := handle + "@" + host
+	r.mu.Lock()
+	id, known := r.accounts[account]
+	r.mu.Unlock()
+	if known {
+		if a, ok := r.cached(id); ok {
+			return a, nil
+		}
+	}
+
+	id, err := r.Webfinger(ctx, handle, host)
+	if err != nil {
+		return nil, err
+	}
+	a, err := r.FetchActor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.confirmAccount(ctx, host, a); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.makeRoom()
+	r.accounts[account] = id
+	r.mu.Unlock()
+	return a, nil
+}
+
+// remoteCollection holds the fields of a remote collection, or a page of it,
+// used to list its items. Items may be either ids or embedded objects.
+type remoteCollection struct {
+	OrderedItems []json.RawMessage `json:"orderedItems"`
+	Items        []json.RawMessage `json:"items"`
+	First        json.RawMessage   `json:"first"`
+}
+
+func (c *remoteCollection) ids() []string {
+	ids := []string{}
+	for _, item := range append(c.OrderedItems, c.Items...) {
+		var id string
+		if err := json.Unmarshal(item, &id); err == nil {
+			ids = append(ids, id)
+			continue
+		}
+		var o struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(item, &o); err == nil && o.ID != "" {
+			ids = append(ids, o.ID)
+		}
+	}
+	return ids
+}
+
+// FetchFeatured fetches the ids of the posts an actor pinned, from its
+// featured collection. Only the first page of the collection is read, as
+// there are few pins. An actor without one has no pinned posts. The ids are
+// cached like actors.
+func (r *ActorResolver) FetchFeatured(ctx context.Context, a *RemoteActor) ([]string, error) {
+	if a.Featured == "" {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	c, ok := r.featured[a.Featured]
+	r.mu.Unlock()
+	if ok && !r.now().After(c.expires) {
+		return c.ids, nil
+	}
+
+	ids, err := r.fetchFeatured(ctx, a.Featured)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.makeRoom()
+	r.featured[a.Featured] = &cachedFeatured{ids: ids, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+	return ids, nil
+}
+
+func (r *ActorResolver) fetchFeatured(ctx context.Context, featured string) ([]string, error) {
+	accept := activityJSONType + `, ` + ldJSONType +
+		`; profile="https://www.w3.org/ns/activitystreams"`
+	var c remoteCollection
+	if err := r.get(ctx, featured, accept, &c); err != nil {
+		return nil, err
+	}
+	if len(c.OrderedItems) > 0 || len(c.Items) > 0 || len(c.First) == 0 {
+		return c.ids(), nil
+	}
+
+	var first string
+	if err := json.Unmarshal(c.First, &first); err != nil {
+		// The first page is embedded.
+		var page remoteCollection
+		if err := json.Unmarshal(c.First, &page); err != nil {
+			return nil, err
+		}
+		return page.ids(), nil
+	}
+	var page remoteCollection
+	if err := r.get(ctx, first, accept, &page); err != nil {
+		return nil, err
+	}
+	return page.ids(), nil
+}
@@ -0,0 +1,285 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newFakeInstance serves a webfinger endpoint and actor documents, counting
+// the requests made to it.
+func newFakeInstance(t *testing.T, actorType string, requests *int) *httptest.Server {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		want := "acct:alice@" + srv.Listener.Addr().String()
+		if r.URL.Query().Get("resource") != want {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"subject": want,
+			"links": []map[string]string{
+				{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": srv.URL + "/@alice"},
+				{"rel": "self", "type": "application/activity+json", "href": srv.URL + "/users/alice"},
+			},
+		})
+	})
+	mux.HandleFunc("/users/alice", func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":                srv.URL + "/users/alice",
+			"type":              actorType,
+			"preferredUsername": "alice",
+			"inbox":             srv.URL + "/users/alice/inbox",
+			"endpoints":         map[string]string{"sharedInbox": srv.URL + "/inbox"},
+		})
+	})
+	// An actor which can't be found by WebFinger.
+	mux.HandleFunc("/users/unlisted", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":                srv.URL + "/users/unlisted",
+			"type":              "Person",
+			"preferredUsername": "unlisted",
+			"inbox":             srv.URL + "/users/unlisted/inbox",
+		})
+	})
+	mux.HandleFunc("/users/impostor", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":                "https://elsewhere.test/users/alice",
+			"type":              "Person",
+			"preferredUsername": "alice",
+			"inbox":             "https://elsewhere.test/users/alice/inbox",
+		})
+	})
+	srv = httptest.NewTLSServer(mux)
+	return srv
+}
+
+func TestActorResolverResolve(t *testing.T) {
+	requests := 0
+	srv := newFakeInstance(t, "Person", &requests)
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	r := NewActorResolver(srv.Client(), time.Minute)
+	a, err := r.Resolve(context.Background(), "alice", host)
+	if err != nil {
+		t.Fatalf("Resolve: unexpected error: %v", err)
+	}
+	if a.ID != srv.URL+"/users/alice" || a.PreferredUsername != "alice" {
+		t.Errorf("Unexpected actor %#v", a)
+	}
+	if a.SharedInbox() != srv.URL+"/inbox" {
+		t.Errorf("Expected shared inbox, got %#v", a.SharedInbox())
+	}
+	if a.Host() != "https://"+host {
+		t.Errorf("Expected host %#v, got %#v", "https://"+host, a.Host())
+	}
+
+	// A second lookup should come from the cache.
+	if _, err := r.Resolve(context.Background(), "alice", host); err != nil {
+		t.Fatalf("Resolve: unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests with cache, got %d", requests)
+	}
+
+	// Until the TTL runs out.
+	r.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := r.Resolve(context.Background(), "alice", host); err != nil {
+		t.Fatalf("Resolve: unexpected error: %v", err)
+	}
+	if requests != 4 {
+		t.Errorf("Expected 4 requests after TTL expired, got %d", requests)
+	}
+}
+
+func TestActorResolverConfirmsOtherHost(t *testing.T) {
+	requests := 0
+	actorSrv := newFakeInstance(t, "Person", &requests)
+	defer actorSrv.Close()
+
+	// A server whose WebFinger gives actors on actorSrv.
+	var target string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/webfinger", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"links": []map[string]string{
+				{"rel": "self", "type": "application/activity+json", "href": target},
+			},
+		})
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+	r := NewActorResolver(srv.Client(), time.Minute)
+
+	target = actorSrv.URL + "/users/alice"
+	if a, err := r.Resolve(context.Background(), "alice", host); err != nil {
+		t.Errorf("Resolve: unexpected error for actor confirmed by its host: %v", err)
+	} else if a.ID != target {
+		t.Errorf("Expected actor %#v, got %#v", target, a.ID)
+	}
+
+	target = actorSrv.URL + "/users/unlisted"
+	if a, err := r.Resolve(context.Background(), "unlisted", host); err == nil {
+		t.Errorf("Expected error for actor not confirmed by its host, got %#v", a.ID)
+	}
+}
+
+func TestActorResolverErrors(t *testing.T) {
+	requests := 0
+	srv := newFakeInstance(t, "Note", &requests)
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+	r := NewActorResolver(srv.Client(), time.Minute)
+
+	if _, err := r.Resolve(context.Background(), "bob", host); err != ActorNotFoundErr {
+		t.Errorf("Expected ActorNotFoundErr for unknown user, got %v", err)
+	}
+	if _, err := r.Resolve(context.Background(), "alice", host); err == nil {
+		t.Errorf("Expected error for actor that is not an actor type")
+	}
+	if _, err := r.FetchActor(context.Background(), srv.URL+"/users/impostor"); err == nil {
+		t.Errorf("Expected error for actor claiming a different id")
+	}
+}
+
+func TestActorResolverForget(t *testing.T) {
+	requests := 0
+	srv := newFakeInstance(t, "Person", &requests)
+	defer srv.Close()
+	r := NewActorResolver(srv.Client(), time.Minute)
+	id := srv.URL + "/users/alice"
+
+	if a := r.Forget(id); a != nil {
+		t.Errorf("Expected nothing to forget, got %#v", a)
+	}
+	if _, err := r.FetchActor(context.Background(), id); err != nil {
+		t.Fatalf("FetchActor: unexpected error: %v", err)
+	}
+	if a := r.Forget(id); a == nil || a.PreferredUsername != "alice" {
+		t.Errorf("Expected to forget alice, got %#v", a)
+	}
+	if _, err := r.FetchActor(context.Background(), id); err != nil {
+		t.Fatalf("FetchActor: unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected actor to be fetched again, got %d requests", requests)
+	}
+}
+
+func TestActorResolverCacheSize(t *testing.T) {
+	r := NewActorResolver(nil, time.Minute)
+	r.maxSize = 10
+	add := func(id string, expires time.Time) {
+		r.mu.Lock()
+		r.makeRoom()
+		r.actors[id] = &cachedActor{actor: &RemoteActor{ID: id}, expires: expires}
+		r.accounts[id+"@host"] = id
+		r.mu.Unlock()
+	}
+
+	add("expired", time.Now().Add(-time.Second))
+	for i := 0; i < 20; i++ {
+		add(fmt.Sprintf("actor%d", i), time.Now().Add(time.Minute))
+		if len(r.actors) > r.maxSize || len(r.accounts) > r.maxSize {
+			t.Fatalf("Cache grew to %d actors and %d accounts, want at most %d",
+				len(r.actors), len(r.accounts), r.maxSize)
+		}
+	}
+	if _, ok := r.actors["expired"]; ok {
+		t.Errorf("Expected expired actor to be evicted first")
+	}
+	if _, ok := r.cached("actor19"); !ok {
+		t.Errorf("Expected the newest actor to be cached")
+	}
+	for account, id := range r.accounts {
+		if _, ok := r.actors[id]; !ok {
+			t.Errorf("Account %s kept for evicted actor %s", account, id)
+		}
+	}
+}
+
+func TestIDListUnmarshal(t *testing.T) {
+	for in, want := range map[string]IDList{
+		`{"alsoKnownAs": "https://a.test/u/1"}`:                         {"https://a.test/u/1"},
+		`{"alsoKnownAs": ["https://a.test/u/1", "https://b.test/u/2"]}`: {"https://a.test/u/1", "https://b.test/u/2"},
+		`{}`: nil,
+	} {
+		var a RemoteActor
+		if err := json.Unmarshal([]byte(in), &a); err != nil {
+			t.Errorf("Unmarshal(%s): unexpected error: %v", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(a.AlsoKnownAs, want) {
+			t.Errorf("Unmarshal(%s): expected %v, got %v", in, want, a.AlsoKnownAs)
+		}
+	}
+}
+
+func TestActorResolverFetchFeatured(t *testing.T) {
+	var srv *httptest.Server
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/embedded", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type": "OrderedCollection",
+			"orderedItems": []interface{}{
+				map[string]string{"id": srv.URL + "/notes/1", "type": "Note"},
+				srv.URL + "/notes/2",
+			},
+		})
+	})
+	mux.HandleFunc("/paged", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":  "OrderedCollection",
+			"first": srv.URL + "/paged/1",
+		})
+	})
+	mux.HandleFunc("/paged/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":         "OrderedCollectionPage",
+			"orderedItems": []string{srv.URL + "/notes/3"},
+		})
+	})
+	srv = httptest.NewTLSServer(mux)
+	defer srv.Close()
+	r := NewActorResolver(srv.Client(), time.Minute)
+
+	for featured, want := range map[string][]string{
+		"":                    nil,
+		srv.URL + "/embedded": {srv.URL + "/notes/1", srv.URL + "/notes/2"},
+		srv.URL + "/paged":    {srv.URL + "/notes/3"},
+	} {
+		got, err := r.FetchFeatured(context.Background(), &RemoteActor{Featured: featured})
+		if err != nil {
+			t.Errorf("FetchFeatured(%#v): unexpected error: %v", featured, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("FetchFeatured(%#v) = %#v, want %#v", featured, got, want)
+		}
+	}
+	if _, err := r.FetchFeatured(context.Background(), &RemoteActor{Featured: srv.URL + "/missing"}); err != ActorNotFoundErr {
+		t.Errorf("Expected ActorNotFoundErr for missing collection, got %v", err)
+	}
+
+	// The pins are cached until the TTL runs out.
+	embedded := &RemoteActor{Featured: srv.URL + "/embedded"}
+	r.FetchFeatured(context.Background(), embedded)
+	if requests != 1 {
+		t.Errorf("Expected pins to be cached, got %d requests", requests)
+	}
+	r.now = func() time.Time { return time.Now().Add(time.Hour) }
+	r.FetchFeatured(context.Background(), embedded)
+	if requests != 2 {
+		t.Errorf("Expected pins to be fetched after TTL expired, got %d requests", requests)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+const adminRequired = "Must be logged in as an admin"
+
+// parseAdmins reads the comma separated list of local handles given in the
+// ADMIN_USERS env var.
+func parseAdmins(env string) map[string]bool {
+	admins := map[string]bool{}
+	for _, h := range strings.Split(env, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			admins[h] = true
+		}
+	}
+	return admins
+}
+
+// requireAdmin returns the handle of the logged in user if they are an admin
+// of the instance. Otherwise it writes a 403 and returns false, and the
+// caller should write its error response.
+func (s *serverWrapper) requireAdmin(w http.ResponseWriter, r *http.Request) (string, bool) {
+	handle, err := s.getSessionHandle(r)
+	if err != nil {
+		log.Printf("Call to admin endpoint %s while not logged in", r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+	if !s.admins[handle] {
+		log.Printf("Non-admin user %#v called admin endpoint %s", handle, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return "", false
+	}
+	return handle, true
+}
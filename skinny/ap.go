@@ -8,11 +8,14 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
 	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -37,14 +40,81 @@ func (s *serverWrapper) errorCheckGeneralResponse(w http.ResponseWriter, resp *p
 }
 
 type activity struct {
+	ID   string `json:"id"`
 	Type string `json:"type"`
 }
 
+// activityActor returns the id of the actor of an activity, which may be
+// given as an IRI or an object.
+func activityActor(body []byte) (string, error) {
+	var a map[string]interface{}
+	if err := json.Unmarshal(body, &a); err != nil {
+		return "", err
+	}
+	return newLDContext(a["@context"]).linkID(a["actor"]), nil
+}
+
+// isSelfDelete reports whether an activity is actor deleting themselves.
+func isSelfDelete(body []byte, actor string) bool {
+	a, err := parseAddressedActivity(body)
+	return err == nil && a.isSelfDelete() && a.Actor == actor
+}
+
+// readSignedActivity reads the body of an activity delivered to an inbox and
+// checks its HTTP Signature, that it was signed by the actor of the activity
+// and that the sender isn't blacklisted.
+// If false is returned the error has already been written to w.
+func (s *serverWrapper) readSignedActivity(w http.ResponseWriter, r *http.Request, inbox string) (string, bool) {
+	const (
+		inboxErr = "Error handling inbox for '%#v': %s: %v"
+		badSig   = "invalid http signature"
+		badActor = "activity not signed by its actor"
+	)
+
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(r.Body)
+	body := buf.String()
+
+	log.Printf("Received activity to %#v's inbox: %#v\n", inbox, body)
+
+	keyOwner, err := s.sigVerifier.Verify(r, buf.Bytes())
+	if gone, ok := err.(*actorGoneErr); ok && isSelfDelete(buf.Bytes(), gone.owner) {
+		// The key of a deleted actor can't be fetched, but the one we had
+		// for them will do for them to tell us they are gone.
+		keyOwner, err = gone.owner, nil
+	}
+	if err != nil {
+		log.Printf(inboxErr, inbox, badSig, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, "Could not verify request: %v.", badSig)
+		return "", false
+	}
+
+	if bad := s.blacklist.Actors(w, keyOwner); bad {
+		return "", false
+	}
+
+	// Otherwise anyone with a key could send activities as any actor.
+	actor, err := activityActor(buf.Bytes())
+	if err != nil || actor != keyOwner {
+		log.Printf(inboxErr, inbox, badActor, fmt.Errorf("actor %#v, signed by %#v (%v)", actor, keyOwner, err))
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintf(w, "Could not verify request: %v.", badActor)
+		return "", false
+	}
+	return body, true
+}
+
 // handleActorInbox is where server to server actions that relate to activities
 // are sent. It routes them using routeActivity to the correct handler.
 //
 // See https://www.w3.org/TR/activitypub/#inbox for details in the spec
 //
+// Every request must carry a valid HTTP Signature, see signatures.go.
+//
+// If the inbox queue is enabled the activity is only checked here, and
+// handled later by the queue workers. See inboxqueue.go.
+//
 // Specifically things modifying Actor collections are routed here.
 // See routes.go to view the activity routing in actorInboxRouter
 func (s *serverWrapper) handleActorInbox() http.HandlerFunc {
@@ -58,27 +128,20 @@ func (s *serverWrapper) handleActorInbox() http.HandlerFunc {
 		v := mux.Vars(r)
 		recipient := v["username"]
 
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(r.Body)
-		body := buf.String()
-
-		log.Printf("Received activity to %#v's inbox: %#v\n", recipient, body)
-
-		d := json.NewDecoder(strings.NewReader(body))
-		var a activity
+		body, ok := s.readSignedActivity(w, r, recipient)
+		if !ok {
+			return
+		}
 
-		if err := d.Decode(&a); err != nil {
+		a, err := parseAddressedActivity([]byte(body))
+		if err != nil {
 			log.Printf(inboxErr, recipient, typeField, err)
 			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "Invalid JSON-LD: %v.", typeField)
 			return
 		}
 
-		if s.actorInboxRouter == nil || len(s.actorInboxRouter) == 0 {
-			log.Fatalf("Actor inbox not initalized, can not continue.")
-		}
-
-		m, exists := s.actorInboxRouter[strings.ToLower(a.Type)]
+		m, exists := s.getInboxHandler(a.Type)
 		if !exists {
 			log.Printf(inboxErr, recipient, notFound, a.Type)
 			w.WriteHeader(http.StatusNotFound)
@@ -87,12 +150,46 @@ func (s *serverWrapper) handleActorInbox() http.HandlerFunc {
 			return
 		}
 
+		if !s.claimActivity(w, recipient, a) {
+			return
+		}
+
+		if s.inboxQueue != nil {
+			if err := s.inboxQueue.Enqueue(recipient, body); err != nil {
+				log.Printf(inboxErr, recipient, "could not queue activity", err)
+				s.unclaimActivity(recipient, a)
+				writeEnqueueError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
 		// We're reading from a stream, so we need to ensure it will
 		// get passed downwards without hitting EOF. We create another
 		// Reader and pass that onwards instead.
 		r.Body = ioutil.NopCloser(strings.NewReader(body))
-		m(w, r)
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		m(sw, r)
+		if sw.code >= 300 {
+			// Let the sender try again.
+			s.unclaimActivity(recipient, a)
+		}
+	}
+}
+
+// getInboxHandler returns the actorInboxRouter handler for an activity type,
+// wrapped so that it is passed the activity in normalised form.
+func (s *serverWrapper) getInboxHandler(activityType string) (http.HandlerFunc, bool) {
+	if s.actorInboxRouter == nil || len(s.actorInboxRouter) == 0 {
+		log.Fatalf("Actor inbox not initalized, can not continue.")
 	}
+
+	m, exists := s.actorInboxRouter[strings.ToLower(activityType)]
+	if !exists {
+		return nil, false
+	}
+	return s.normalisedInboxHandler(m), true
 }
 
 // ImageObject holds the type of the image e.g. ".png" and the url
@@ -110,24 +207,106 @@ type KeyObject struct {
 	PublicKeyPem string `json:"publicKeyPem"`
 }
 
+// EndpointsObject holds the endpoints an actor shares with the rest of the
+// instance.
+type EndpointsObject struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+// actorContextTerms defines the terms used in actors that aren't part of
+// ActivityStreams itself, in the same way as Mastodon.
+var actorContextTerms = map[string]interface{}{
+	"alsoKnownAs":               map[string]string{"@id": "as:alsoKnownAs", "@type": "@id"},
+	"movedTo":                   map[string]string{"@id": "as:movedTo", "@type": "@id"},
+	"toot":                      "http://joinmastodon.org/ns#",
+	"featured":                  map[string]string{"@id": "toot:featured", "@type": "@id"},
+	"discoverable":              "toot:discoverable",
+	"manuallyApprovesFollowers": "as:manuallyApprovesFollowers",
+	"schema":                    "http://schema.org#",
+	"PropertyValue":             "schema:PropertyValue",
+	"value":                     "schema:value",
+}
+
+// PropertyValue is a name and value pair shown on a user's profile, as
+// Mastodon's profile metadata fields.
+type PropertyValue struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
 // ActorObjectStruct holds all fields that a ActivityPub actor should hold.
 // see spec here: https://www.w3.org/TR/activitypub/#actor-objects
 type ActorObjectStruct struct {
 	// The @context in the output JSON-LD
-	Context []string `json:"@context"`
+	Context []interface{} `json:"@context"`
 
 	// The same types as the protobuf ActorObject.
-	Type              string       `json:"type"`
-	Inbox             string       `json:"inbox"`
-	Outbox            string       `json:"outbox"`
-	Name              string       `json:"name"`
-	PreferredUsername string       `json:"preferredUsername"`
-	Icon              *ImageObject `json:"icon,omitempty"`
-	Followers         string       `json:followers`
-	Following         string       `json:following`
-	PublicKey         *KeyObject   `json:"publicKey"`
-	ID                string       `json:"id"`
-	Summary           string       `json:"summary"`
+	Type              string           `json:"type"`
+	Inbox             string           `json:"inbox"`
+	Outbox            string           `json:"outbox"`
+	Name              string           `json:"name"`
+	PreferredUsername string           `json:"preferredUsername"`
+	Icon              *ImageObject     `json:"icon,omitempty"`
+	Followers         string           `json:"followers"`
+	Following         string           `json:"following"`
+	PublicKey         *KeyObject       `json:"publicKey"`
+	ID                string           `json:"id"`
+	Summary           string           `json:"summary"`
+	Endpoints         *EndpointsObject `json:"endpoints,omitempty"`
+	// AlsoKnownAs are other accounts of the user, which may move to them.
+	AlsoKnownAs []string `json:"alsoKnownAs,omitempty"`
+	// MovedTo is the account the user moved to, if they have.
+	MovedTo string `json:"movedTo,omitempty"`
+	// Featured is the collection of articles the user pinned.
+	Featured string `json:"featured"`
+	// URL is the user's profile page.
+	URL string `json:"url"`
+	// Image is the header shown at the top of the user's profile.
+	Image *ImageObject `json:"image,omitempty"`
+	// Attachment holds the user's profile fields.
+	Attachment []PropertyValue `json:"attachment"`
+	// ManuallyApprovesFollowers is set for private users, who have to
+	// accept follow requests.
+	ManuallyApprovesFollowers bool `json:"manuallyApprovesFollowers"`
+	// Discoverable says whether the user can be suggested to others.
+	Discoverable bool `json:"discoverable"`
+}
+
+// profileAttachment converts the profile fields stored for a user to
+// PropertyValues.
+func profileAttachment(user *pb.UsersEntry) ([]PropertyValue, error) {
+	attachment := []PropertyValue{}
+	if user.ProfileFields == "" {
+		return attachment, nil
+	}
+	var fields []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(user.ProfileFields), &fields); err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		attachment = append(attachment, PropertyValue{
+			Type:  "PropertyValue",
+			Name:  f.Name,
+			Value: f.Value,
+		})
+	}
+	return attachment, nil
+}
+
+// userImage returns the image at path served from the assets, or nil if the
+// user hasn't uploaded it.
+func (s *serverWrapper) userImage(filepath string) *ImageObject {
+	if _, err := os.Stat(filepath); err != nil {
+		return nil
+	}
+	return &ImageObject{
+		Type: "Image",
+		URL:  util.NormaliseHost(s.hostname) + "/assets/" + path.Base(filepath),
+	}
 }
 
 func (s *serverWrapper) handleActor() http.HandlerFunc {
@@ -154,9 +333,10 @@ func (s *serverWrapper) handleActor() http.HandlerFunc {
 			return
 		}
 
-		context := []string{
+		context := []interface{}{
 			"https://www.w3.org/ns/activitystreams",
 			"https://w3id.org/security/v1",
+			actorContextTerms,
 		}
 
 		// Unfortunately, there's no easier way to add a field to a struct.
@@ -171,90 +351,59 @@ func (s *serverWrapper) handleActor() http.HandlerFunc {
 			Following:         resp.Actor.Following,
 			ID:                resp.Actor.Id,
 			Summary:           resp.Actor.Summary,
+			Featured:          resp.Actor.Id + "/featured",
+			Endpoints: &EndpointsObject{
+				SharedInbox: s.sharedInboxURL(),
+			},
 		}
 
+		aliases, err := s.aliasesOf(ctx, resp.Actor.GlobalId)
+		if err != nil {
+			log.Printf("Could not get aliases of actor. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Could not create actor object.\n")
+			return
+		}
+		actor.AlsoKnownAs = aliases.Aliases
+		actor.MovedTo = aliases.MovedTo
+
 		actor.PublicKey = &KeyObject{
 			ID:           resp.Actor.PublicKey.Id,
 			Owner:        resp.Actor.PublicKey.Owner,
 			PublicKeyPem: resp.Actor.PublicKey.PublicKeyPem,
 		}
 
-		filepath := s.getProfilePicPath(resp.Actor.GlobalId)
-		if _, err := os.Stat(filepath); err == nil {
-			// Profile pic exists
-			actor.Icon = &ImageObject{
-				Type: "Image",
-				URL: fmt.Sprintf(
-					"http://%s/assets/user_%d",
-					s.hostname, resp.Actor.GlobalId),
-			}
-		}
-
-		enc := json.NewEncoder(w)
-		err = enc.Encode(actor)
+		user, err := util.GetAuthorFromDb(ctx, u, "", true, 0, s.database)
 		if err != nil {
-			log.Printf("Could not marshal Actor object. Error: %v", err)
+			log.Printf("Could not get user of actor. Error: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "Could not create actor object.\n")
 			return
 		}
-		log.Printf("Created actor successfully.")
-	}
-}
-
-func (s *serverWrapper) handleFollowingCollection() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		v := mux.Vars(r)
-		u := v["username"]
-		req := &pb.ActorRequest{Username: u}
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
-		defer cancel()
-
-		resp, err := s.actors.GetFollowing(ctx, req)
+		private := user.Private != nil && user.Private.Value
+		actor.ManuallyApprovesFollowers = private
+		actor.Discoverable = !private
+		actor.URL = util.NormaliseHost(s.hostname) + "/#/@" + user.Handle
+		actor.Attachment, err = profileAttachment(user)
 		if err != nil {
-			log.Printf("Could not create following collection object. Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Could not create following collection object.\n")
-			return
-		}
-		if resp.Collection == "" {
-			log.Printf("Actors service GetFollowing returned empty string\n")
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Could not create following collection object.\n")
-			return
+			// A user shouldn't lose their actor over malformed fields.
+			log.Printf("Could not parse profile fields of %#v: %v", u, err)
+			actor.Attachment = []PropertyValue{}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, resp.Collection)
-		log.Printf("Created following collection successfully.")
-	}
-}
-
-func (s *serverWrapper) handleFollowersCollection() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		v := mux.Vars(r)
-		u := v["username"]
-		req := &pb.ActorRequest{Username: u}
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
-		defer cancel()
+		actor.Icon = s.userImage(s.getProfilePicPath(resp.Actor.GlobalId))
+		actor.Image = s.userImage(s.getHeaderPicPath(resp.Actor.GlobalId))
 
-		resp, err := s.actors.GetFollowers(ctx, req)
+		w.Header().Set("Content-Type", activityJSONType)
+		enc := json.NewEncoder(w)
+		err = enc.Encode(actor)
 		if err != nil {
-			log.Printf("Could not create followers collection object. Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Could not create followers collection object.\n")
-			return
-		}
-		if resp.Collection == "" {
-			log.Printf("Actors service GetFollowers returned empty string\n")
+			log.Printf("Could not marshal Actor object. Error: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Could not create followers collection object.\n")
+			fmt.Fprintf(w, "Could not create actor object.\n")
 			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprintf(w, resp.Collection)
-		log.Printf("Created following collection successfully.")
+		log.Printf("Created actor successfully.")
 	}
 }
 
@@ -265,119 +414,247 @@ type ArticlePreviewStruct struct {
 	Name    string `json:"name"`
 }
 
+// ArticleTagStruct is an entry in the tag list of an article, such as a
+// Hashtag.
+type ArticleTagStruct struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
 // ArticleContentStruct contains the article content and metadata
 type ArticleContentStruct struct {
 	// The @context in the output JSON-LD
-	Context      []string              `json:"@context"`
-	Type         string                `json:"type"`
-	ID           string                `json:"id"`
-	URL          string                `json:"url"`
-	Content      string                `json:"content"`
-	Name         string                `json:"name"`
-	Published    string                `json:"published"`
-	To           []string              `json:"to"`
-	AttributedTo string                `json:"attributedTo"`
-	Preview      *ArticlePreviewStruct `json:"preview"`
+	Context      []string                 `json:"@context,omitempty"`
+	Type         string                   `json:"type"`
+	ID           string                   `json:"id"`
+	URL          string                   `json:"url"`
+	Content      string                   `json:"content"`
+	Name         string                   `json:"name"`
+	Summary      string                   `json:"summary,omitempty"`
+	Published    string                   `json:"published"`
+	Updated      string                   `json:"updated,omitempty"`
+	To           []string                 `json:"to"`
+	Cc           []string                 `json:"cc,omitempty"`
+	AttributedTo string                   `json:"attributedTo"`
+	InReplyTo    string                   `json:"inReplyTo,omitempty"`
+	Tag          []ArticleTagStruct       `json:"tag"`
+	Replies      *OrderedCollectionStruct `json:"replies,omitempty"`
+	Preview      *ArticlePreviewStruct    `json:"preview"`
 }
 
 // ArticleObjectStruct contains activitypub formatted articles
 type ArticleObjectStruct struct {
 	// The @context in the output JSON-LD
-	Context   []string              `json:"@context"`
+	Context   []string              `json:"@context,omitempty"`
 	Type      string                `json:"type"`
 	Actor     string                `json:"actor"`
 	Object    *ArticleContentStruct `json:"object"`
 	Published string                `json:"published"`
 	ID        string                `json:"id"`
 	To        []string              `json:"to"`
+	Cc        []string              `json:"cc,omitempty"`
 }
 
-func (s *serverWrapper) handleAPArticle() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		v := mux.Vars(r)
-		u := v["username"]
-		strArticleID, aOk := v["article_id"]
-		if !aOk || strArticleID == "" {
-			log.Println("Per Article AP passed bad articleId value")
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+// hashtagURL links a tag to a search for it on this instance.
+func (s *serverWrapper) hashtagURL(tag string) string {
+	return fmt.Sprintf("%s/#/search/%s", util.NormaliseHost(s.hostname), url.PathEscape(tag))
+}
 
-		articleID, string2IntErr := strconv.ParseInt(strArticleID, 10, 64)
-		if string2IntErr != nil {
-			log.Println("ID in handleAPArticle could not be converted to int")
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+// articleObject builds the AS2 Article for a post by a local author. Replies
+// are untitled comments, so are Notes instead. The posts of private authors
+// are only addressed to their followers, rather than the public.
+func (s *serverWrapper) articleObject(ctx context.Context, author *pb.UsersEntry, p *pb.PostsEntry) *ArticleContentStruct {
+	actor := s.localActorID(author.Handle)
+	apID := s.articleAPID(author, p.ApId, p.GlobalId)
+
+	tags := []ArticleTagStruct{}
+	for _, t := range util.SplitTags(p.Tags) {
+		tags = append(tags, ArticleTagStruct{
+			Type: "Hashtag",
+			Href: s.hashtagURL(t),
+			Name: "#" + t,
+		})
+	}
 
-		req := &pb.ArticleApRequest{
-			ArticleId: articleID,
-			Username:  u,
+	to := []string{activityStreamsPublic}
+	cc := []string{actor + "/followers"}
+	if author.Private != nil && author.Private.Value {
+		to, cc = cc, []string{}
+	}
+	mentions, err := s.mentionTags(ctx, p.GlobalId)
+	if err != nil {
+		log.Printf("Could not get mentions in %d: %v", p.GlobalId, err)
+	}
+	for _, m := range mentions {
+		tags = append(tags, m)
+		cc = append(cc, m.Href)
+	}
+
+	a := &ArticleContentStruct{
+		Type: "Article",
+		ID:   apID,
+		URL: fmt.Sprintf("%s/#/@%s/%d",
+			util.NormaliseHost(s.hostname), author.Handle, p.GlobalId),
+		Content:      p.Body,
+		Name:         p.Title,
+		Summary:      p.Summary,
+		Published:    util.ConvertPbTimestamp(p.CreationDatetime),
+		To:           to,
+		Cc:           cc,
+		AttributedTo: actor,
+		Tag:          tags,
+		// The replies are served at the collection's id, see
+		// handleRepliesCollection.
+		Replies: &OrderedCollectionStruct{
+			ID:   apID + "/replies",
+			Type: "OrderedCollection",
+		},
+		Preview: &ArticlePreviewStruct{
+			Content: p.Summary,
+			Type:    "Note",
+			Name:    "Summary",
+		},
+	}
+	if p.UpdatedDatetime != nil {
+		a.Updated = util.ConvertPbTimestamp(p.UpdatedDatetime)
+	}
+	if p.InReplyTo != 0 {
+		a.Type = "Note"
+		parent, err := s.postAPIDByGlobalID(ctx, p.InReplyTo)
+		if err != nil {
+			// The post may have been deleted, leaving the reply behind.
+			log.Printf("Could not get post %d replied to by %d: %v", p.InReplyTo, p.GlobalId, err)
 		}
+		a.InReplyTo = parent
+	}
+	return a
+}
+
+// createActivity wraps an article in the Create activity which published it.
+// The activity is served at its own id, next to the article.
+func createActivity(a *ArticleContentStruct) *ArticleObjectStruct {
+	return &ArticleObjectStruct{
+		Type:      "Create",
+		ID:        a.ID + "/activity",
+		Actor:     a.AttributedTo,
+		Published: a.Published,
+		To:        a.To,
+		Cc:        a.Cc,
+		Object:    a,
+	}
+}
+
+// getLocalPost finds a post by a local user, and the user, from the
+// variables of an article route, writing an error response if it can't.
+func (s *serverWrapper) getLocalPost(ctx context.Context, w http.ResponseWriter, r *http.Request) (*pb.UsersEntry, *pb.PostsEntry, bool) {
+	v := mux.Vars(r)
+	u := v["username"]
+	strArticleID, aOk := v["article_id"]
+	if !aOk || strArticleID == "" {
+		log.Println("Per Article AP passed bad articleId value")
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	articleID, string2IntErr := strconv.ParseInt(strArticleID, 10, 64)
+	if string2IntErr != nil {
+		log.Println("ID in handleAPArticle could not be converted to int")
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	author, err := util.GetAuthorFromDb(ctx, u, "", true, 0, s.database)
+	if err == util.UserNotFoundErr {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, nil, false
+	} else if err != nil {
+		log.Printf("Could not get author of article. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Could not create article object.\n")
+		return nil, nil, false
+	}
+
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match: &pb.PostsEntry{
+			GlobalId: articleID,
+			AuthorId: author.GlobalId,
+		},
+	})
+	if err != nil {
+		log.Printf("Could not get article. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Could not create article object.\n")
+		return nil, nil, false
+	} else if resp.ResultType != pb.ResultType_OK {
+		log.Printf("Could not get article. Error: %v", resp.Error)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Could not create article object.\n")
+		return nil, nil, false
+	} else if len(resp.Results) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return author, resp.Results[0], true
+}
+
+// getLocalArticle finds a post by a local user from the variables of an
+// article route, writing an error response if it can't. The posts of private
+// users are only found for their followers.
+func (s *serverWrapper) getLocalArticle(ctx context.Context, w http.ResponseWriter, r *http.Request) (*ArticleContentStruct, bool) {
+	author, p, ok := s.getLocalPost(ctx, w, r)
+	if !ok {
+		return nil, false
+	}
+	if author.Private != nil && author.Private.Value && !s.isFollowerFetch(ctx, r, author) {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+	return s.articleObject(ctx, author, p), true
+}
+
+// handleAPArticle serves the Article object of a local post at its id.
+func (s *serverWrapper) handleAPArticle() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
 		defer cancel()
 
-		resp, err := s.actors.GetArticle(ctx, req)
-		if err != nil {
-			log.Printf("Could not create article object. Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Could not create article object.\n")
+		article, ok := s.getLocalArticle(ctx, w, r)
+		if !ok {
 			return
 		}
-		if resp.Actor == "" {
-			log.Printf("Actors service GetArticle returned empty string\n")
+		article.Context = []string{activityStreamsContext}
+
+		if err := writeActivityJSON(w, article); err != nil {
+			log.Printf("Could not marshal Article object. Error: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "Could not create article object.\n")
 			return
 		}
+		log.Printf("Created article successfully.")
+	}
+}
 
-		context := []string{
-			"https://www.w3.org/ns/activitystreams",
-		}
-
-		to := []string{
-			"https://www.w3.org/ns/activitystreams#Public",
-		}
-
-		summaryContent := &ArticlePreviewStruct{
-			Content: resp.Summary,
-			Type:    "Note",
-			Name:    "Summary",
-		}
-
-		articleContent := &ArticleContentStruct{
-			Context:      context,
-			Type:         "Create",
-			ID:           resp.ApId,
-			URL:          resp.ArticleUrl,
-			Content:      resp.Content,
-			Name:         resp.Title,
-			Published:    resp.Published,
-			To:           to,
-			AttributedTo: resp.Actor,
-			Preview:      summaryContent,
-		}
+// handleAPArticleActivity serves the Create activity of a local post.
+func (s *serverWrapper) handleAPArticleActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
 
-		article := &ArticleObjectStruct{
-			Context:   context,
-			Type:      "Create",
-			Actor:     resp.Actor,
-			To:        to,
-			ID:        resp.ApId,
-			Published: resp.Published,
-			Object:    articleContent,
+		article, ok := s.getLocalArticle(ctx, w, r)
+		if !ok {
+			return
 		}
+		create := createActivity(article)
+		create.Context = []string{activityStreamsContext}
 
-		w.Header().Set("Content-Type", "application/json")
-		enc := json.NewEncoder(w)
-		err = enc.Encode(article)
-		if err != nil {
-			log.Printf("Could not marshal Article object. Error: %v", err)
+		if err := writeActivityJSON(w, create); err != nil {
+			log.Printf("Could not marshal Create activity. Error: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprintf(w, "Could not create article object.\n")
-			return
 		}
-		log.Printf("Created article successfully.")
 	}
 }
 
@@ -389,6 +666,8 @@ type articleObjectStruct struct {
 	Type         string               `json:"type"`
 	ID           string               `json:"id"`
 	URL          string               `json:"url"`
+	InReplyTo    string               `json:"inReplyTo"`
+	Tag          []ArticleTagStruct   `json:"tag"`
 	Preview      articleObjectPreview `json:"preview"`
 }
 
@@ -399,6 +678,7 @@ type articleObjectPreview struct {
 }
 
 type createActivityStruct struct {
+	ID        string              `json:"id"`
 	Actor     string              `json:"actor"`
 	Object    articleObjectStruct `json:"object"`
 	Recipient []string            `json:"to"`
@@ -415,7 +695,6 @@ func (s *serverWrapper) handleCreateActivity() http.HandlerFunc {
 
 		log.Printf("User %v received a create activity\n", recipient)
 
-		// TODO: Parse jsonLD in general case
 		decoder := json.NewDecoder(r.Body)
 		var t createActivityStruct
 		err := decoder.Decode(&t)
@@ -442,6 +721,25 @@ func (s *serverWrapper) handleCreateActivity() http.HandlerFunc {
 		if bad := s.blacklist.Actors(w, t.Actor, t.Object.AttributedTo); bad {
 			return
 		}
+		if !isAuthor(t.Actor, t.Object) {
+			log.Printf("%#v tried to create %#v attributed to %#v",
+				t.Actor, t.Object.ID, t.Object.AttributedTo)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot create another actor's article.\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		var parent int64
+		if t.Object.InReplyTo != "" {
+			parent, err = s.replyParentID(ctx, t.Actor, t.Object.InReplyTo)
+			if err != nil {
+				log.Printf("Could not find parent %#v of %#v: %v",
+					t.Object.InReplyTo, t.Object.ID, err)
+			}
+		}
 
 		var nfa *pb.NewForeignArticle
 
@@ -474,9 +772,15 @@ func (s *serverWrapper) handleCreateActivity() http.HandlerFunc {
 			fmt.Fprintf(w, "Cannot handle Create %s activity\n", t.Object.Type)
 			return
 		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
-		defer cancel()
+		nfa.Mentions = s.localMentions(t.Object.Tag)
+		// Replies to posts we have are kept as comments on them, so they
+		// don't need a title or a link back to their source.
+		if parent != 0 {
+			nfa.Content = t.Object.Content
+			nfa.Title = t.Object.Name
+			nfa.Summary = summary
+			nfa.InReplyTo = parent
+		}
 
 		resp, err := s.create.ReceiveCreate(ctx, nfa)
 		logStr := "Could not receive create activity. Error: %v"
@@ -491,6 +795,8 @@ func (s *serverWrapper) handleCreateActivity() http.HandlerFunc {
 }
 
 type updateActivity struct {
+	ID     string              `json:"id"`
+	Actor  string              `json:"actor"`
 	Object articleObjectStruct `json:"object"`
 	Type   string              `json:"type"`
 }
@@ -512,12 +818,27 @@ func (s *serverWrapper) handleUpdateActivity() http.HandlerFunc {
 			return
 		}
 
+		if util.IsActorType(t.Object.Type) {
+			if bad := s.blacklist.Actors(w, t.Actor, t.Object.ID); bad {
+				return
+			}
+			s.receiveActorUpdate(w, t.Actor, t.Object.ID)
+			return
+		}
+
 		summary := ""
 		if t.Object.Preview.Type == "Note" && t.Object.Preview.Name == "Summary" {
 			summary = t.Object.Preview.Content
 		}
 
-		if bad := s.blacklist.Actors(w, t.Object.AttributedTo); bad {
+		if bad := s.blacklist.Actors(w, t.Actor, t.Object.AttributedTo); bad {
+			return
+		}
+		if !isAuthor(t.Actor, t.Object) {
+			log.Printf("%#v tried to update %#v attributed to %#v",
+				t.Actor, t.Object.ID, t.Object.AttributedTo)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot update another actor's article.\n")
 			return
 		}
 
@@ -526,12 +847,18 @@ func (s *serverWrapper) handleUpdateActivity() http.HandlerFunc {
 			Body:    t.Object.Content,
 			Title:   t.Object.Name,
 			Summary: summary,
+			Actor:   t.Actor,
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
 		defer cancel()
 
 		resp, err := s.s2sUpdate.ReceiveUpdateActivity(ctx, ud)
-		if err != nil || resp.ResultType == pb.ResultType_ERROR {
+		if err == nil && resp.ResultType == pb.ResultType_ERROR_401 {
+			log.Printf("Update of %#v by %#v is denied", t.Object.ID, t.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot update another actor's article.\n")
+			return
+		} else if err != nil || resp.ResultType == pb.ResultType_ERROR {
 			if err != nil {
 				log.Printf("Could not receive update activity. Error: %v", err)
 			} else {
@@ -548,6 +875,7 @@ func (s *serverWrapper) handleUpdateActivity() http.HandlerFunc {
 }
 
 type followActivityStruct struct {
+	ID        string   `json:"id"`
 	Actor     string   `json:"actor"`
 	Object    string   `json:"object"`
 	Recipient []string `json:"to"`
@@ -561,7 +889,6 @@ func (s *serverWrapper) handleFollowActivity() http.HandlerFunc {
 			log.Printf("User %v received a follow activity.\n", recipient)
 		}
 
-		// TODO: Parse JSON-LD in other shapes.
 		decoder := json.NewDecoder(r.Body)
 		var t followActivityStruct
 		jsonErr := decoder.Decode(&t)
@@ -596,6 +923,8 @@ func (s *serverWrapper) handleFollowActivity() http.HandlerFunc {
 }
 
 type followUndoActivity struct {
+	ID     string               `json:"id"`
+	Actor  string               `json:"actor"`
 	Object followActivityStruct `json:"object"`
 	Type   string               `json:"type"`
 }
@@ -614,6 +943,14 @@ func (s *serverWrapper) handleFollowUndoActivity() http.HandlerFunc {
 			return
 		}
 
+		// Only the follower can take back their follow.
+		if t.Actor == "" || t.Actor != t.Object.Actor {
+			log.Printf("%#v tried to undo a follow by %#v", t.Actor, t.Object.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's follow.\n")
+			return
+		}
+
 		f := &pb.ReceivedFollowDetails{
 			Follower: t.Object.Actor,
 			Followed: t.Object.Object,
@@ -634,15 +971,11 @@ func (s *serverWrapper) handleFollowUndoActivity() http.HandlerFunc {
 	}
 }
 
-type likeActorStruct struct {
-	ID   string `json:"id"`
-	Type string `json:"type"`
-}
-
 type likeActivityStruct struct {
-	Actor  likeActorStruct `json:"actor"`
-	Object string          `json:"object"`
-	Type   string          `json:"type"`
+	ID     string `json:"id"`
+	Actor  string `json:"actor"`
+	Object string `json:"object"`
+	Type   string `json:"type"`
 }
 
 func (s *serverWrapper) handleLikeActivity() http.HandlerFunc {
@@ -651,7 +984,6 @@ func (s *serverWrapper) handleLikeActivity() http.HandlerFunc {
 		recipient := v["username"]
 		log.Printf("User %v received a like activity.\n", recipient)
 
-		// TODO(iandioch, sailslick, CianLR): Parse JSON-LD in other shapes.
 		decoder := json.NewDecoder(r.Body)
 		var t likeActivityStruct
 		jsonErr := decoder.Decode(&t)
@@ -663,13 +995,13 @@ func (s *serverWrapper) handleLikeActivity() http.HandlerFunc {
 			return
 		}
 
-		if bad := s.blacklist.Actors(w, t.Actor.ID); bad {
+		if bad := s.blacklist.Actors(w, t.Actor); bad {
 			return
 		}
 
 		f := &pb.ReceivedLikeDetails{
 			LikedObject: t.Object,
-			LikerId:     t.Actor.ID,
+			LikerId:     t.Actor,
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
@@ -695,6 +1027,7 @@ func (s *serverWrapper) handleLikeActivity() http.HandlerFunc {
 }
 
 type deleteActivity struct {
+	ID     string `json:"id"`
 	Object string `json:"object"`
 	Actor  string `json:"actor"`
 }
@@ -705,7 +1038,6 @@ func (s *serverWrapper) handleDeleteActivity() http.HandlerFunc {
 		recipient := v["username"]
 		log.Printf("User %v received a delete activity.\n", recipient)
 
-		// TODO(iandioch, sailslick, CianLR, devoxel): Parse JSON-LD in other shapes.
 		decoder := json.NewDecoder(r.Body)
 		var t deleteActivity
 		jsonErr := decoder.Decode(&t)
@@ -720,9 +1052,15 @@ func (s *serverWrapper) handleDeleteActivity() http.HandlerFunc {
 		if bad := s.blacklist.Actors(w, t.Actor); bad {
 			return
 		}
+		// An actor deleting themselves, rather than one of their articles.
+		if t.Object != "" && t.Object == t.Actor {
+			s.receiveActorDelete(w, t.Actor)
+			return
+		}
 
 		f := &pb.ReceivedDeleteDetails{
-			ApId: t.Object,
+			ApId:  t.Object,
+			Actor: t.Actor,
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
@@ -747,8 +1085,8 @@ func (s *serverWrapper) handleDeleteActivity() http.HandlerFunc {
 			fmt.Fprintf(w, "Issue with receiving delete activity.\n")
 			return
 		} else if resp.ResultType == pb.ResultType_ERROR_401 {
-			log.Printf("Delete activity is denied")
-			w.WriteHeader(http.StatusUnauthorized)
+			log.Printf("Delete of %#v by %#v is denied", t.Object, t.Actor)
+			w.WriteHeader(http.StatusForbidden)
 			fmt.Fprintf(w, "Delete activity is denied")
 			return
 		}
@@ -765,6 +1103,7 @@ type approvalObject struct {
 }
 
 type approvalActivity struct {
+	ID        string         `json:"id"`
 	Actor     string         `json:"actor"`
 	Object    approvalObject `json:"object"`
 	Recipient []string       `json:"to"`
@@ -781,7 +1120,6 @@ func (s *serverWrapper) handleApprovalActivity() http.HandlerFunc {
 		recipient := v["username"]
 		log.Printf("User %v received an approval activity.\n", recipient)
 
-		// TODO: Parse JSON-LD in other shapes.
 		decoder := json.NewDecoder(r.Body)
 		var t approvalActivity
 		jsonErr := decoder.Decode(&t)
@@ -833,6 +1171,8 @@ func (s *serverWrapper) handleApprovalActivity() http.HandlerFunc {
 }
 
 type undoActivity struct {
+	ID     string   `json:"id"`
+	Actor  string   `json:"actor"`
 	Object activity `json:"object"`
 	Type   string   `json:"type"`
 }
@@ -866,11 +1206,11 @@ func (s *serverWrapper) handleUndoActivity() http.HandlerFunc {
 		// depending on the type of the object to be undone.
 		m, exists := s.undoActivityRouter[strings.ToLower(del.Object.Type)]
 		if !exists {
-			log.Printf("Could not find undo handle for object of type %#v",
-				del.Object.Type)
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(w, "Could not handle Undo activity for '%#v'",
-				del.Object.Type)
+			// There's nothing we keep for other activities, so there's
+			// nothing to undo. Accept it so the sender doesn't retry.
+			log.Printf("Ignoring Undo of %#v from %#v, nothing to undo",
+				del.Object.Type, del.Actor)
+			fmt.Fprintf(w, "{}\n")
 			return
 		}
 
@@ -883,6 +1223,8 @@ func (s *serverWrapper) handleUndoActivity() http.HandlerFunc {
 }
 
 type likeUndoActivity struct {
+	ID     string             `json:"id"`
+	Actor  string             `json:"actor"`
 	Object likeActivityStruct `json:"object"`
 	Type   string             `json:"type"`
 }
@@ -905,12 +1247,19 @@ func (s *serverWrapper) handleLikeUndoActivity() http.HandlerFunc {
 			return
 		}
 
-		if bad := s.blacklist.Actors(w, t.Object.Actor.ID); bad {
+		if bad := s.blacklist.Actors(w, t.Object.Actor); bad {
+			return
+		}
+		// Only the liker can take back their like.
+		if t.Actor == "" || t.Actor != t.Object.Actor {
+			log.Printf("%#v tried to undo a like by %#v", t.Actor, t.Object.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's like.\n")
 			return
 		}
 		f := &pb.ReceivedLikeUndoDetails{
 			LikedObjectApId: t.Object.Object,
-			LikingUserApId:  t.Object.Actor.ID,
+			LikingUserApId:  t.Object.Actor,
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
@@ -935,6 +1284,149 @@ func (s *serverWrapper) handleLikeUndoActivity() http.HandlerFunc {
 	}
 }
 
+type announceUndoActivity struct {
+	ID     string                 `json:"id"`
+	Actor  string                 `json:"actor"`
+	Object announceActivityStruct `json:"object"`
+	Type   string                 `json:"type"`
+}
+
+func (s *serverWrapper) handleAnnounceUndoActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received an announce Undo activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t announceUndoActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Object.Actor); bad {
+			return
+		}
+		// Only the announcer can take back their announce.
+		if t.Actor != "" && t.Actor != t.Object.Actor {
+			log.Printf("%#v tried to undo an announce by %#v", t.Actor, t.Object.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's announce.\n")
+			return
+		}
+
+		f := &pb.ReceivedAnnounceUndoDetails{
+			AnnouncedObjectApId: t.Object.Object.ID,
+			AnnouncerApId:       t.Object.Actor,
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.s2sUndo.ReceiveAnnounceUndoActivity(ctx, f)
+		if err != nil {
+			log.Printf("Could not receive announce undo activity. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving announce undo activity.\n")
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not receive announce undo activity. Error: %v",
+				resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving announce undo activity.\n")
+			return
+		}
+
+		log.Println("Announce undo activity received successfully.")
+		fmt.Fprintf(w, "{}\n")
+	}
+}
+
+type createUndoActivity struct {
+	ID     string               `json:"id"`
+	Actor  string               `json:"actor"`
+	Object createActivityStruct `json:"object"`
+	Type   string               `json:"type"`
+}
+
+// isAuthor checks that an article sent by actor is attributed to them, and so
+// is on their server.
+func isAuthor(actor string, o articleObjectStruct) bool {
+	return actor != "" && o.AttributedTo == actor && sameHost(o.ID, actor)
+}
+
+// sameHost checks that two ActivityPub ids are on the same server.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Host != "" &&
+		strings.ToLower(ua.Host) == strings.ToLower(ub.Host)
+}
+
+// handleCreateUndoActivity takes back a created article, which is the same
+// as deleting it, along with any shares and likes of it.
+func (s *serverWrapper) handleCreateUndoActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received a create Undo activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t createUndoActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Actor); bad {
+			return
+		}
+		// Only the creator can take back their article, and articles are
+		// always on the same server as their creator.
+		objectID := t.Object.Object.ID
+		if t.Actor == "" || (t.Object.Actor != "" && t.Object.Actor != t.Actor) ||
+			!sameHost(t.Actor, objectID) {
+			log.Printf("%#v tried to undo create of %#v by %#v",
+				t.Actor, objectID, t.Object.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's create.\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.s2sDelete.ReceiveDeleteActivity(ctx,
+			&pb.ReceivedDeleteDetails{ApId: objectID, Actor: t.Actor})
+		if err != nil {
+			log.Printf("Could not receive create undo activity. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving create undo activity.\n")
+			return
+		} else if resp.ResultType == pb.ResultType_ERROR_401 {
+			log.Printf("Undo of create of %#v by %#v is denied", objectID, t.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's create.\n")
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not receive create undo activity. Error: %v",
+				resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving create undo activity.\n")
+			return
+		}
+
+		log.Println("Create undo activity received successfully.")
+		fmt.Fprintf(w, "{}\n")
+	}
+}
+
 // TODO(sailslick): Properly fill in announce structs
 type announceActor struct {
 	ID   string `json:"id"`
@@ -944,6 +1436,7 @@ type announceActor struct {
 type announceActivityStruct struct {
 	// TODO(#409): Change the object to simply be a createActivityObject
 	// that's gathered by its id in the original body.
+	ID        string              `json:"id"`
 	Actor     string              `json:"actor"`
 	Type      string              `json:"type"`
 	Published string              `json:"published"`
@@ -6,11 +6,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
 
 	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
 )
 
 func setupFakeActorInboxRoutes(t *testing.T, s *serverWrapper) {
@@ -39,15 +44,16 @@ func TestActorInboxRouting(t *testing.T) {
 	setupFakeActorInboxRoutes(t, srv)
 
 	tests := []string{
-		`{ "type": "create" }`,
-		`{ "type": "follow" }`,
-		`{ "type": "Create" }`,
-		`{ "type": "Follow" }`,
+		`{ "type": "create", "actor": "` + testKeyOwner + `" }`,
+		`{ "type": "follow", "actor": "` + testKeyOwner + `" }`,
+		`{ "type": "Create", "actor": {"id": "` + testKeyOwner + `"} }`,
+		`{ "type": "Follow", "actor": "` + testKeyOwner + `" }`,
 	}
 
 	for _, test := range tests {
 		r := bytes.NewBufferString(test)
 		req, _ := http.NewRequest("POST", "/ap/testuser/", r)
+		signTestRequest(req, []byte(test))
 		res := httptest.NewRecorder()
 		srv.handleActorInbox()(res, req)
 
@@ -84,8 +90,357 @@ func TestsHandleLikeActivity(t *testing.T) {
 	res := httptest.NewRecorder()
 	srv := newTestServerWrapper()
 
-	srv.handleLikeActivity()(res, req)
+	srv.normalisedInboxHandler(srv.handleLikeActivity())(res, req)
 	if res.Code != http.StatusOK {
 		t.Errorf("Expected 200 OK, got %#v", res.Code)
 	}
 }
+
+type UndoFake struct {
+	pb.S2SUndoClient
+
+	rq *pb.ReceivedAnnounceUndoDetails
+}
+
+func (u *UndoFake) ReceiveAnnounceUndoActivity(_ context.Context, r *pb.ReceivedAnnounceUndoDetails, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	u.rq = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+type DeleteFake struct {
+	pb.S2SDeleteClient
+
+	rq *pb.ReceivedDeleteDetails
+}
+
+func (d *DeleteFake) ReceiveDeleteActivity(_ context.Context, r *pb.ReceivedDeleteDetails, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	d.rq = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func TestHandleUndoActivities(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		code     int
+		announce *pb.ReceivedAnnounceUndoDetails
+		delete   *pb.ReceivedDeleteDetails
+	}{
+		{
+			name: "undo announce",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@sender",
+				"object": {"type": "Announce", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice/1"}}`,
+			code: http.StatusOK,
+			announce: &pb.ReceivedAnnounceUndoDetails{
+				AnnouncedObjectApId: "http://SKINNYTESTS:191/ap/@alice/1",
+				AnnouncerApId:       "http://remote.test/ap/@sender",
+			},
+		},
+		{
+			name: "undo someone else's announce",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@mallory",
+				"object": {"type": "Announce", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice/1"}}`,
+			code: http.StatusForbidden,
+		},
+		{
+			name: "undo someone else's like",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@mallory",
+				"object": {"type": "Like", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice/1"}}`,
+			code: http.StatusForbidden,
+		},
+		{
+			name: "undo someone else's follow",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@mallory",
+				"object": {"type": "Follow", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice"}}`,
+			code: http.StatusForbidden,
+		},
+		{
+			name: "undo create",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@sender",
+				"object": {"type": "Create", "actor": "http://remote.test/ap/@sender",
+					"object": {"id": "http://remote.test/ap/@sender/5", "type": "Note"}}}`,
+			code: http.StatusOK,
+			delete: &pb.ReceivedDeleteDetails{
+				ApId:  "http://remote.test/ap/@sender/5",
+				Actor: "http://remote.test/ap/@sender",
+			},
+		},
+		{
+			name: "undo create of an object on another server",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@sender",
+				"object": {"type": "Create", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice/1"}}`,
+			code: http.StatusForbidden,
+		},
+		{
+			name: "undo add",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@sender",
+				"object": {"type": "Add", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice/1",
+					"target": "http://remote.test/ap/@sender/featured"}}`,
+			code: http.StatusOK,
+		},
+	}
+
+	for _, tcase := range tests {
+		srv := newTestServerWrapper()
+		undo := &UndoFake{}
+		del := &DeleteFake{}
+		srv.s2sUndo = undo
+		srv.s2sDelete = del
+
+		req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(tcase.body))
+		res := httptest.NewRecorder()
+		srv.normalisedInboxHandler(srv.handleUndoActivity())(res, req)
+
+		if res.Code != tcase.code {
+			t.Errorf("%s: expected %d, got %d", tcase.name, tcase.code, res.Code)
+		}
+		if !reflect.DeepEqual(undo.rq, tcase.announce) {
+			t.Errorf("%s: expected announce undo %v, got %v", tcase.name, tcase.announce, undo.rq)
+		}
+		if !reflect.DeepEqual(del.rq, tcase.delete) {
+			t.Errorf("%s: expected delete %v, got %v", tcase.name, tcase.delete, del.rq)
+		}
+	}
+}
+
+func TestHandleActivityAuthorship(t *testing.T) {
+	srv := newTestServerWrapper()
+	create := &createFake{}
+	del := &DeleteFake{}
+	srv.create = create
+	srv.s2sDelete = del
+
+	post := func(h http.HandlerFunc, body string) int {
+		req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+		res := httptest.NewRecorder()
+		h(res, req)
+		return res.Code
+	}
+	article := func(typ, attributedTo, id string) string {
+		return `{"type": "` + typ + `", "actor": "` + testKeyOwner + `",
+			"object": {"type": "Note", "id": "` + id + `",
+				"attributedTo": "` + attributedTo + `",
+				"content": "hi", "published": "2019-01-01T00:00:00.000Z"}}`
+	}
+
+	forged := []string{
+		article("Create", "http://remote.test/ap/@mallory", testRemotePost),
+		article("Create", testKeyOwner, "http://other.test/notes/1"),
+	}
+	for _, body := range forged {
+		if code := post(srv.handleCreateActivity(), body); code != http.StatusForbidden {
+			t.Errorf("Expected 403 Forbidden for forged Create, got %d", code)
+		}
+	}
+	if create.nfa != nil {
+		t.Errorf("Expected no article to be created, got %v", create.nfa)
+	}
+	body := article("Update", "http://remote.test/ap/@mallory", testRemotePost)
+	if code := post(srv.handleUpdateActivity(), body); code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for forged Update, got %d", code)
+	}
+
+	body = `{"type": "Delete", "actor": "` + testKeyOwner + `", "object": "` + testRemotePost + `"}`
+	if code := post(srv.handleDeleteActivity(), body); code != http.StatusOK {
+		t.Errorf("Expected 200 OK for Delete, got %d", code)
+	}
+	want := &pb.ReceivedDeleteDetails{ApId: testRemotePost, Actor: testKeyOwner}
+	if !reflect.DeepEqual(del.rq, want) {
+		t.Errorf("Expected delete %v, got %v", want, del.rq)
+	}
+}
+
+func getTestArticle(srv *serverWrapper, h http.HandlerFunc, username, id string, v interface{}) int {
+	req, _ := http.NewRequest("GET", "/ap/@"+username+"/"+id, nil)
+	req = mux.SetURLVars(req, map[string]string{"username": username, "article_id": id})
+	res := httptest.NewRecorder()
+	h(res, req)
+	json.Unmarshal(res.Body.Bytes(), v)
+	return res.Code
+}
+
+func TestHandleAPArticle(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{{GlobalId: 1, Handle: "alice"}},
+		posts: []*pb.PostsEntry{{
+			GlobalId:         10,
+			AuthorId:         1,
+			Title:            "Hello",
+			Body:             "<p>Hello world</p>",
+			Summary:          "A greeting",
+			Tags:             "greetings|first post",
+			CreationDatetime: &tspb.Timestamp{Seconds: 1546300800},
+			UpdatedDatetime:  &tspb.Timestamp{Seconds: 1546304400},
+		}},
+	}
+
+	const id = "http://SKINNYTESTS:191/ap/@alice/10"
+	want := &ArticleContentStruct{
+		Type:         "Article",
+		ID:           id,
+		URL:          "http://SKINNYTESTS:191/#/@alice/10",
+		Content:      "<p>Hello world</p>",
+		Name:         "Hello",
+		Summary:      "A greeting",
+		Published:    util.ConvertPbTimestamp(&tspb.Timestamp{Seconds: 1546300800}),
+		Updated:      util.ConvertPbTimestamp(&tspb.Timestamp{Seconds: 1546304400}),
+		To:           []string{activityStreamsPublic},
+		Cc:           []string{"http://SKINNYTESTS:191/ap/@alice/followers"},
+		AttributedTo: "http://SKINNYTESTS:191/ap/@alice",
+		Tag: []ArticleTagStruct{
+			{Type: "Hashtag", Href: "http://SKINNYTESTS:191/#/search/greetings", Name: "#greetings"},
+			{Type: "Hashtag", Href: "http://SKINNYTESTS:191/#/search/first%20post", Name: "#first post"},
+		},
+		Replies: &OrderedCollectionStruct{ID: id + "/replies", Type: "OrderedCollection"},
+		Preview: &ArticlePreviewStruct{Type: "Note", Content: "A greeting", Name: "Summary"},
+	}
+
+	var article ArticleContentStruct
+	if code := getTestArticle(srv, srv.handleAPArticle(), "alice", "10", &article); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	want.Context = []string{activityStreamsContext}
+	if !reflect.DeepEqual(&article, want) {
+		t.Errorf("Expected article %#v, got %#v", want, &article)
+	}
+
+	var create ArticleObjectStruct
+	if code := getTestArticle(srv, srv.handleAPArticleActivity(), "alice", "10", &create); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	want.Context = nil
+	wantCreate := &ArticleObjectStruct{
+		Context:   []string{activityStreamsContext},
+		Type:      "Create",
+		ID:        id + "/activity",
+		Actor:     want.AttributedTo,
+		Published: want.Published,
+		To:        want.To,
+		Cc:        want.Cc,
+		Object:    want,
+	}
+	if !reflect.DeepEqual(&create, wantCreate) {
+		t.Errorf("Expected create %#v, got %#v", wantCreate, &create)
+	}
+
+	for _, tc := range []struct{ username, id string }{
+		{"alice", "11"},
+		{"bob", "10"},
+	} {
+		var a ArticleContentStruct
+		if code := getTestArticle(srv, srv.handleAPArticle(), tc.username, tc.id, &a); code != http.StatusNotFound {
+			t.Errorf("Expected 404 Not Found for @%s/%s, got %#v", tc.username, tc.id, code)
+		}
+	}
+}
+
+func TestHandleAPArticlePrivateUser(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice", Private: &wrapperpb.BoolValue{Value: true}},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		posts: []*pb.PostsEntry{{GlobalId: 10, AuthorId: 1, Title: "Hello"}},
+	}
+	get := func(h http.HandlerFunc, v interface{}) int {
+		req, _ := http.NewRequest("GET", "/ap/@alice/10", nil)
+		req = mux.SetURLVars(req, map[string]string{"username": "alice", "article_id": "10"})
+		signTestRequest(req, nil)
+		res := httptest.NewRecorder()
+		h(res, req)
+		json.Unmarshal(res.Body.Bytes(), v)
+		return res.Code
+	}
+
+	var a ArticleContentStruct
+	for _, h := range []http.HandlerFunc{srv.handleAPArticle(), srv.handleAPArticleActivity()} {
+		if code := get(h, &a); code != http.StatusNotFound {
+			t.Errorf("Expected 404 Not Found for someone not following, got %#v", code)
+		}
+	}
+
+	// Followers see it, addressed to only the author's followers.
+	srv.database.(*MemoryDatabaseFake).follows = []*pb.Follow{{Follower: 3, Followed: 1}}
+	if code := get(srv.handleAPArticle(), &a); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for a follower, got %#v", code)
+	}
+	want := []string{"http://SKINNYTESTS:191/ap/@alice/followers"}
+	if !reflect.DeepEqual(a.To, want) || len(a.Cc) != 0 {
+		t.Errorf("Expected article addressed to %v only, got to %v cc %v", want, a.To, a.Cc)
+	}
+	var create ArticleObjectStruct
+	if code := get(srv.handleAPArticleActivity(), &create); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for a follower, got %#v", code)
+	}
+	if !reflect.DeepEqual(create.To, want) {
+		t.Errorf("Expected create addressed to %v, got %v", want, create.To)
+	}
+}
+
+type actorsFake struct {
+	pb.ActorsClient
+}
+
+func (a *actorsFake) Get(_ context.Context, r *pb.ActorRequest, _ ...grpc.CallOption) (*pb.ActorResponse, error) {
+	id := "http://SKINNYTESTS:191/ap/@" + r.Username
+	return &pb.ActorResponse{Actor: &pb.ActorObject{
+		Type:              "Person",
+		Id:                id,
+		PreferredUsername: r.Username,
+		Followers:         id + "/followers",
+		Following:         id + "/following",
+		GlobalId:          1,
+		PublicKey:         &pb.PublicKey{Id: id + "#key", Owner: id},
+	}}, nil
+}
+
+func TestHandleActor(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.actors = &actorsFake{}
+	srv.database = &MemoryDatabaseFake{users: []*pb.UsersEntry{{
+		GlobalId:      1,
+		Handle:        "alice",
+		Private:       &wrapperpb.BoolValue{Value: true},
+		ProfileFields: `[{"name": "Website", "value": "rabble.network"}]`,
+	}}}
+
+	req, _ := http.NewRequest("GET", "/ap/@alice", nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+	res := httptest.NewRecorder()
+	srv.handleActor()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+
+	var a map[string]interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &a); err != nil {
+		t.Fatalf("Could not decode actor %#v: %v", res.Body.String(), err)
+	}
+	want := map[string]interface{}{
+		"followers":                 "http://SKINNYTESTS:191/ap/@alice/followers",
+		"following":                 "http://SKINNYTESTS:191/ap/@alice/following",
+		"url":                       "http://SKINNYTESTS:191/#/@alice",
+		"manuallyApprovesFollowers": true,
+		"discoverable":              false,
+		"endpoints":                 map[string]interface{}{"sharedInbox": "http://SKINNYTESTS:191/ap/inbox"},
+		"attachment": []interface{}{map[string]interface{}{
+			"type":  "PropertyValue",
+			"name":  "Website",
+			"value": "rabble.network",
+		}},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(a[k], v) {
+			t.Errorf("Expected actor %s to be %#v, got %#v", k, v, a[k])
+		}
+	}
+}
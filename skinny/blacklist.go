@@ -3,61 +3,169 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	util "github.com/cpssd/rabble/services/utils"
 )
 
-func loadBlacklistFile() io.Reader {
+const (
+	// blacklistPollInterval is how often the blacklist file is checked for
+	// changes made outside of skinny.
+	blacklistPollInterval = time.Second * 10
+
+	wildcardPrefix = "*."
+)
+
+func blacklistPath() string {
 	path := os.Getenv("BLACKLIST_FILE")
 	if path == "" {
 		log.Fatalln("BLACKLIST_FILE env var not set for skinny server.")
 	}
+	return path
+}
 
-	b, err := ioutil.ReadFile(path)
-	if err != nil {
-		log.Fatalf("blacklist file: %v", err)
+// loadFederationPolicy loads the allowlist given by ALLOWLIST_FILE if it is
+// set, so that the instance only federates with the hosts listed in it.
+// Otherwise it loads the blacklist given by BLACKLIST_FILE.
+func loadFederationPolicy(hostname string) (*Blacklist, error) {
+	if path := os.Getenv("ALLOWLIST_FILE"); path != "" {
+		log.Printf("Federating only with hosts in allowlist %s", path)
+		return LoadAllowlist(path, hostname)
 	}
+	return LoadBlacklist(blacklistPath())
+}
 
-	return bytes.NewReader(b)
+// Blacklist holds the hosts the instance has blocked. Entries are either
+// exact hosts, like "bad.example:1916", or wildcards, like "*.spam.example",
+// which block a domain and all of its subdomains.
+//
+// In allowlist mode the entries are instead the only hosts the instance
+// federates with, and every other host except our own is blocked.
+//
+// A Blacklist loaded from a file can be reloaded when the file changes, and
+// entries added or removed through the admin API are written back to it.
+// It is safe for concurrent use.
+type Blacklist struct {
+	mu        sync.RWMutex
+	hosts     map[string]struct{}
+	wildcards map[string]struct{}
+
+	allowlist bool
+	// localHost is the host of this instance, which is always allowed in
+	// allowlist mode.
+	localHost string
+
+	// path is empty if the blacklist isn't backed by a file.
+	path    string
+	modTime time.Time
+}
+
+// String logs the entries of the blacklist.
+func (b *Blacklist) String() string {
+	if b.allowlist {
+		return fmt.Sprintf("Allowlisted hosts: %v", strings.Join(b.List(), ", "))
+	}
+	return fmt.Sprintf("Blacklisted hosts: %v", strings.Join(b.List(), ", "))
 }
 
-// Blacklist type defines the format of the Rabble blacklist
-// URIs are mapped to empty structs
-type Blacklist map[string]struct{}
+// Allowlist reports whether the entries are the only hosts allowed.
+func (b *Blacklist) Allowlist() bool {
+	return b.allowlist
+}
 
-func (b Blacklist) String(m map[string]struct{}) {
+// List returns all entries in the blacklist, sorted.
+func (b *Blacklist) List() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	keys := []string{}
-	for k := range m {
+	for k := range b.hosts {
 		keys = append(keys, k)
 	}
-	log.Printf("Blacklisted hosts: %v", strings.Join(keys, ", "))
+	for k := range b.wildcards {
+		keys = append(keys, wildcardPrefix+k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitHostname(host string) (string, string) {
+	host = strings.ToLower(host)
+	hostname := host
+	if i := strings.LastIndex(host, ":"); i != -1 {
+		hostname = host[:i]
+	}
+	return host, hostname
+}
+
+// blocked checks a host, which may include a port, against the blacklist, or
+// the allowlist in allowlist mode.
+func (b *Blacklist) blocked(host string) bool {
+	if !b.allowlist {
+		return b.listed(host)
+	}
+	// Actors without a host can't be checked, and are handled as they are in
+	// blacklist mode.
+	if host == "" || strings.ToLower(host) == b.localHost {
+		return false
+	}
+	return !b.listed(host)
+}
+
+// listed checks if a host matches an entry.
+func (b *Blacklist) listed(host string) bool {
+	host, hostname := splitHostname(host)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if _, exists := b.hosts[host]; exists {
+		return true
+	}
+	if _, exists := b.hosts[hostname]; exists {
+		return true
+	}
+	// Check the domain and every parent domain against the wildcards.
+	for d := hostname; d != ""; {
+		if _, exists := b.wildcards[d]; exists {
+			return true
+		}
+		i := strings.Index(d, ".")
+		if i == -1 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return false
 }
 
 // Actor takes an actor and returns a boolean indicating if the actor is
 // blacklisted.
-func (b Blacklist) actorBlacklisted(actor string) (bool, error) {
+func (b *Blacklist) actorBlacklisted(actor string) (bool, error) {
 	u, err := url.Parse(actor)
 	if err != nil {
 		return false, err
 	}
-
-	if _, exists := b[u.Host]; exists {
-		return true, nil
-	}
-
-	return false, nil
+	return b.blocked(u.Host), nil
 }
 
 // Actors takes an actor from an Activity and returns true if the actor was blacklisted.
 //
 // This function takes place of handling of errors, so no additional
 // status/etc are required.
-func (b Blacklist) Actors(w http.ResponseWriter, actors ...string) bool {
+func (b *Blacklist) Actors(w http.ResponseWriter, actors ...string) bool {
 	for _, a := range actors {
 		if bad, err := b.actorBlacklisted(a); bad || err != nil {
 			b.HandleForbidden(w, err)
@@ -69,38 +177,312 @@ func (b Blacklist) Actors(w http.ResponseWriter, actors ...string) bool {
 
 // HandleForbidden will return the correct status code based on whether
 // there was an error or access was denied
-func (b Blacklist) HandleForbidden(w http.ResponseWriter, err error) {
+func (b *Blacklist) HandleForbidden(w http.ResponseWriter, err error) {
 	if err != nil {
 		log.Printf("Error in blacklist: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	log.Println("Received an activity from a blacklisted instance.")
+	if b.allowlist {
+		log.Println("Received an activity from an instance not in the allowlist.")
+	} else {
+		log.Println("Received an activity from a blacklisted instance.")
+	}
 	w.WriteHeader(http.StatusForbidden)
 	return
 }
 
-// NewBlacklist reads in the config blacklist
-func NewBlacklist(r io.Reader) Blacklist {
-	blacklisted := map[string]struct{}{}
+// parseBlacklistLine returns the entry on a line of a blacklist file, or ""
+// if there is none.
+func parseBlacklistLine(l string) string {
+	// Handle inline comments.
+	if i := strings.Index(l, "#"); i != -1 {
+		l = l[0:i]
+	}
+	return strings.ToLower(strings.TrimSpace(l))
+}
+
+// normaliseBlacklistEntry checks an entry given through the admin API.
+func normaliseBlacklistEntry(e string) (string, error) {
+	e = strings.ToLower(strings.TrimSpace(e))
+	host := strings.TrimPrefix(e, wildcardPrefix)
+	if host == "" || strings.ContainsAny(host, "#*/ \t@") {
+		return "", fmt.Errorf("invalid blacklist entry %#v", e)
+	}
+	return e, nil
+}
+
+func parseBlacklist(r io.Reader) (map[string]struct{}, map[string]struct{}, error) {
+	hosts := map[string]struct{}{}
+	wildcards := map[string]struct{}{}
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		l := strings.TrimSpace(scanner.Text())
-
-		// Handle comments.
-		if len(l) == 0 || l[0] == '#' {
+		l := parseBlacklistLine(scanner.Text())
+		if l == "" {
 			continue
 		}
+		if strings.HasPrefix(l, wildcardPrefix) {
+			wildcards[strings.TrimPrefix(l, wildcardPrefix)] = struct{}{}
+		} else {
+			hosts[l] = struct{}{}
+		}
+	}
+	return hosts, wildcards, scanner.Err()
+}
+
+// NewBlacklist reads in a blacklist that isn't backed by a file.
+func NewBlacklist(r io.Reader) *Blacklist {
+	hosts, wildcards, err := parseBlacklist(r)
+	if err != nil {
+		log.Fatalf("error reading blacklist file: %v", err)
+	}
+	return &Blacklist{hosts: hosts, wildcards: wildcards}
+}
+
+// LoadBlacklist reads the blacklist file at path. Changes made through Add
+// and Remove are persisted to it.
+func LoadBlacklist(path string) (*Blacklist, error) {
+	b := &Blacklist{path: path}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadAllowlist reads the allowlist file at path, blocking every host not
+// listed in it except localHost, the host of this instance.
+func LoadAllowlist(path string, localHost string) (*Blacklist, error) {
+	u, err := url.Parse(util.NormaliseHost(localHost))
+	if err != nil {
+		return nil, err
+	}
+	b := &Blacklist{path: path, allowlist: true, localHost: strings.ToLower(u.Host)}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
 
-		// Handle inline comments.
-		if i := strings.Index(l, "#"); i != -1 {
-			l = strings.TrimSpace(l[0:i])
+// Reload reads the blacklist file again, replacing all entries.
+func (b *Blacklist) Reload() error {
+	if b.path == "" {
+		return nil
+	}
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hosts, wildcards, err := parseBlacklist(f)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.hosts, b.wildcards = hosts, wildcards
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+	log.Print(b)
+	return nil
+}
+
+func (b *Blacklist) changedOnDisk() bool {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		log.Printf("Could not check blacklist file: %v", err)
+		return false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return !info.ModTime().Equal(b.modTime)
+}
+
+// Watch reloads the blacklist when skinny receives a SIGHUP, or when the
+// file is changed. It doesn't return, so should be run in a goroutine.
+func (b *Blacklist) Watch(poll time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+			log.Print("Received SIGHUP, reloading blacklist.")
+		case <-ticker.C:
+			if !b.changedOnDisk() {
+				continue
+			}
+			log.Print("Blacklist file changed, reloading.")
 		}
+		if err := b.Reload(); err != nil {
+			log.Printf("Could not reload blacklist, keeping old one: %v", err)
+		}
+	}
+}
+
+// persist rewrites the blacklist file with add appended and any lines for
+// remove taken out, keeping comments. It must be called with b.mu held.
+func (b *Blacklist) persist(add, remove string) error {
+	if b.path == "" {
+		return nil
+	}
+	old, err := ioutil.ReadFile(b.path)
+	if err != nil {
+		return err
+	}
 
-		blacklisted[l] = struct{}{}
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(old))
+	for scanner.Scan() {
+		if remove != "" && parseBlacklistLine(scanner.Text()) == remove {
+			continue
+		}
+		out.WriteString(scanner.Text() + "\n")
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("error reading blacklist file: %v", err)
+		return err
+	}
+	if add != "" {
+		out.WriteString(add + "\n")
+	}
+
+	// Write to a temporary file and rename it, so nobody reads a half
+	// written blacklist.
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), ".blacklist")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(out.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), b.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(b.path); err == nil {
+		b.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func (b *Blacklist) setFor(entry string) (map[string]struct{}, string) {
+	if strings.HasPrefix(entry, wildcardPrefix) {
+		return b.wildcards, strings.TrimPrefix(entry, wildcardPrefix)
 	}
-	return blacklisted
+	return b.hosts, entry
+}
+
+// Add blocks a host or wildcard, saving it to the blacklist file.
+func (b *Blacklist) Add(entry string) error {
+	entry, err := normaliseBlacklistEntry(entry)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	set, key := b.setFor(entry)
+	if _, exists := set[key]; exists {
+		return nil
+	}
+	if err := b.persist(entry, ""); err != nil {
+		return err
+	}
+	set[key] = struct{}{}
+	return nil
+}
+
+// Remove unblocks a host or wildcard, removing it from the blacklist file.
+func (b *Blacklist) Remove(entry string) error {
+	entry, err := normaliseBlacklistEntry(entry)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	set, key := b.setFor(entry)
+	if _, exists := set[key]; !exists {
+		return nil
+	}
+	if err := b.persist("", entry); err != nil {
+		return err
+	}
+	delete(set, key)
+	return nil
+}
+
+type blacklistEntryStruct struct {
+	Host string `json:"host"`
+}
+
+type blacklistResp struct {
+	Error     string   `json:"error"`
+	Allowlist bool     `json:"allowlist"`
+	Hosts     []string `json:"hosts"`
+}
+
+// handleBlacklist lists the blacklist for admins.
+func (s *serverWrapper) handleBlacklist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		if _, ok := s.requireAdmin(w, r); !ok {
+			enc.Encode(&blacklistResp{Error: adminRequired})
+			return
+		}
+		enc.Encode(&blacklistResp{
+			Allowlist: s.blacklist.Allowlist(),
+			Hosts:     s.blacklist.List(),
+		})
+	}
+}
+
+func (s *serverWrapper) handleBlacklistModify(modify func(*Blacklist, string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		handle, ok := s.requireAdmin(w, r)
+		if !ok {
+			enc.Encode(&blacklistResp{Error: adminRequired})
+			return
+		}
+
+		var e blacklistEntryStruct
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&blacklistResp{Error: invalidJSONError})
+			return
+		}
+
+		if err := modify(s.blacklist, e.Host); err != nil {
+			log.Printf("Admin %#v could not modify blacklist: %v", handle, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&blacklistResp{Error: err.Error()})
+			return
+		}
+		log.Printf("Admin %#v modified blacklist entry %#v", handle, e.Host)
+		enc.Encode(&blacklistResp{
+			Allowlist: s.blacklist.Allowlist(),
+			Hosts:     s.blacklist.List(),
+		})
+	}
+}
+
+// handleBlacklistAdd blocks a host, for admins.
+func (s *serverWrapper) handleBlacklistAdd() http.HandlerFunc {
+	return s.handleBlacklistModify((*Blacklist).Add)
+}
+
+// handleBlacklistRemove unblocks a host, for admins.
+func (s *serverWrapper) handleBlacklistRemove() http.HandlerFunc {
+	return s.handleBlacklistModify((*Blacklist).Remove)
 }
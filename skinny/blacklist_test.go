@@ -1,7 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -9,7 +17,7 @@ import (
 func TestParseBlacklist(t *testing.T) {
 	tests := []struct {
 		in  string
-		out Blacklist
+		out map[string]struct{}
 	}{
 		{
 			in:  "",
@@ -33,7 +41,7 @@ func TestParseBlacklist(t *testing.T) {
 		},
 	}
 
-	compare := func(out Blacklist, test Blacklist) error {
+	compare := func(out map[string]struct{}, test map[string]struct{}) error {
 		for hostOut := range out {
 			if _, exists := test[hostOut]; !exists {
 				return fmt.Errorf("%#v not in test set", hostOut)
@@ -49,8 +57,176 @@ func TestParseBlacklist(t *testing.T) {
 
 	for _, tcase := range tests {
 		o := NewBlacklist(strings.NewReader(tcase.in))
-		if err := compare(o, tcase.out); err != nil {
+		if err := compare(o.hosts, tcase.out); err != nil {
 			t.Errorf("tcase: %#v: %v", tcase.in, err)
 		}
 	}
 }
+
+func TestBlacklistWildcards(t *testing.T) {
+	b := NewBlacklist(strings.NewReader("bad.example:1916\n*.spam.example\nplain.example\n"))
+	tests := []struct {
+		actor string
+		want  bool
+	}{
+		{"https://bad.example:1916/ap/@a", true},
+		{"https://bad.example/ap/@a", false},
+		{"https://plain.example:8080/ap/@a", true},
+		{"https://spam.example/ap/@a", true},
+		{"https://deep.sub.spam.example/ap/@a", true},
+		{"https://notspam.example/ap/@a", false},
+		{"https://SPAM.example/ap/@a", true},
+		{"https://good.example/ap/@a", false},
+	}
+	for _, tcase := range tests {
+		got, err := b.actorBlacklisted(tcase.actor)
+		if err != nil {
+			t.Fatalf("actorBlacklisted(%#v): %v", tcase.actor, err)
+		}
+		if got != tcase.want {
+			t.Errorf("actorBlacklisted(%#v): expected %v, got %v", tcase.actor, tcase.want, got)
+		}
+	}
+}
+
+func writeTestBlacklist(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "blacklist")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	path := filepath.Join(dir, "instance_blacklist")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Could not write blacklist: %v", err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestBlacklistPersistsChanges(t *testing.T) {
+	path, cleanup := writeTestBlacklist(t, "# Our blacklist\nbad.example # spammers\n")
+	defer cleanup()
+
+	b, err := LoadBlacklist(path)
+	if err != nil {
+		t.Fatalf("LoadBlacklist: %v", err)
+	}
+	if err := b.Add("*.Spam.example"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := b.Remove("bad.example"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := b.Add("*"); err == nil {
+		t.Errorf("Expected error adding bare wildcard")
+	}
+
+	content, _ := ioutil.ReadFile(path)
+	if want := "# Our blacklist\n*.spam.example\n"; string(content) != want {
+		t.Errorf("Expected file %#v, got %#v", want, string(content))
+	}
+	if want := []string{"*.spam.example"}; !reflect.DeepEqual(b.List(), want) {
+		t.Errorf("Expected %v, got %v", want, b.List())
+	}
+}
+
+func TestBlacklistReload(t *testing.T) {
+	path, cleanup := writeTestBlacklist(t, "bad.example\n")
+	defer cleanup()
+
+	b, err := LoadBlacklist(path)
+	if err != nil {
+		t.Fatalf("LoadBlacklist: %v", err)
+	}
+	ioutil.WriteFile(path, []byte("worse.example\n"), 0644)
+	if err := b.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if b.blocked("bad.example") || !b.blocked("worse.example") {
+		t.Errorf("Expected reloaded blacklist, got %v", b.List())
+	}
+
+	os.Remove(path)
+	if err := b.Reload(); err == nil {
+		t.Errorf("Expected error reloading missing file")
+	}
+	if !b.blocked("worse.example") {
+		t.Errorf("Expected failed reload to keep old blacklist, got %v", b.List())
+	}
+}
+
+func TestBlacklistAdminEndpoints(t *testing.T) {
+	path, cleanup := writeTestBlacklist(t, "bad.example\n")
+	defer cleanup()
+
+	srv := newTestServerWrapper()
+	b, err := LoadBlacklist(path)
+	if err != nil {
+		t.Fatalf("LoadBlacklist: %v", err)
+	}
+	srv.blacklist = b
+
+	body, _ := json.Marshal(&blacklistEntryStruct{Host: "*.spam.example"})
+	req, _ := http.NewRequest("POST", "/c2s/admin/blacklist/add", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	addFakeSession(srv, res, req)
+	srv.handleBlacklistAdd()(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for non-admin, got %#v", res.Code)
+	}
+	if b.blocked("spam.example") {
+		t.Errorf("Expected non-admin to not modify blacklist")
+	}
+
+	srv.admins = parseAdmins("admin, jose")
+	req, _ = http.NewRequest("POST", "/c2s/admin/blacklist/add", bytes.NewReader(body))
+	res = httptest.NewRecorder()
+	addFakeSession(srv, res, req)
+	srv.handleBlacklistAdd()(res, req)
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", res.Code)
+	}
+	var r blacklistResp
+	json.Unmarshal(res.Body.Bytes(), &r)
+	if want := []string{"*.spam.example", "bad.example"}; !reflect.DeepEqual(r.Hosts, want) {
+		t.Errorf("Expected %v, got %#v", want, r)
+	}
+	if !b.blocked("www.spam.example") {
+		t.Errorf("Expected wildcard to be blocked after add")
+	}
+
+	req, _ = http.NewRequest("GET", "/c2s/admin/blacklist", nil)
+	res = httptest.NewRecorder()
+	addFakeSession(srv, res, req)
+	srv.handleBlacklist()(res, req)
+	if res.Code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", res.Code)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	path, cleanup := writeTestBlacklist(t, "friend.example\n*.partner.example\n")
+	defer cleanup()
+
+	b, err := LoadAllowlist(path, "skinny_1:1916")
+	if err != nil {
+		t.Fatalf("LoadAllowlist: %v", err)
+	}
+	tests := []struct {
+		actor string
+		want  bool
+	}{
+		{"https://friend.example/ap/@a", false},
+		{"https://social.partner.example/ap/@a", false},
+		{"http://skinny_1:1916/ap/@a", false},
+		{"https://stranger.example/ap/@a", true},
+		{"https://friend.example.evil/ap/@a", true},
+	}
+	for _, tcase := range tests {
+		got, err := b.actorBlacklisted(tcase.actor)
+		if err != nil {
+			t.Fatalf("actorBlacklisted(%#v): %v", tcase.actor, err)
+		}
+		if got != tcase.want {
+			t.Errorf("actorBlacklisted(%#v): expected %v, got %v", tcase.actor, tcase.want, got)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/gorilla/mux"
+)
+
+type blockActivity struct {
+	ID     string `json:"id"`
+	Actor  string `json:"actor"`
+	Object string `json:"object"`
+	Type   string `json:"type"`
+}
+
+type blockUndoActivity struct {
+	ID     string        `json:"id"`
+	Actor  string        `json:"actor"`
+	Object blockActivity `json:"object"`
+	Type   string        `json:"type"`
+}
+
+// blockErr is returned by resolveBlock along with the status to reply with.
+type blockErr struct {
+	status int
+	msg    string
+	err    error
+}
+
+func (e *blockErr) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+// resolveBlock finds the users in a block of a local user by a foreign
+// actor. If create is set, a foreign actor we haven't seen before is added
+// to the users table, otherwise a nil blocker is returned for them.
+func (s *serverWrapper) resolveBlock(ctx context.Context, t *blockActivity, create bool) (blocker, blocked *pb.UsersEntry, err error) {
+	handle, local := s.localHandleFromActorID(t.Object)
+	if !local {
+		return nil, nil, &blockErr{http.StatusBadRequest, "Can only block local users",
+			fmt.Errorf("%#v is not a local actor", t.Object)}
+	}
+	blocked, err = util.GetAuthorFromDb(ctx, handle, "", true, 0, s.database)
+	if err == util.UserNotFoundErr {
+		return nil, nil, &blockErr{http.StatusNotFound, "Blocked user does not exist", err}
+	} else if err != nil {
+		return nil, nil, &blockErr{http.StatusInternalServerError, "Could not get blocked user", err}
+	}
+
+	actor, err := s.remoteActors.FetchActor(ctx, t.Actor)
+	if err != nil {
+		return nil, nil, &blockErr{http.StatusBadGateway, "Could not fetch blocking actor", err}
+	}
+	blocker, err = util.GetAuthorFromDb(ctx, actor.PreferredUsername,
+		actor.Host(), false, 0, s.database)
+	if err == util.UserNotFoundErr && !create {
+		return nil, blocked, nil
+	} else if err == util.UserNotFoundErr {
+		blocker, err = s.addForeignUser(ctx, actor)
+	}
+	if err != nil {
+		return nil, nil, &blockErr{http.StatusInternalServerError, "Could not get blocking user", err}
+	}
+	return blocker, blocked, nil
+}
+
+// addForeignUser adds a foreign actor to the users table.
+func (s *serverWrapper) addForeignUser(ctx context.Context, actor *util.RemoteActor) (*pb.UsersEntry, error) {
+	ue := &pb.UsersEntry{
+		Handle:      actor.PreferredUsername,
+		Host:        actor.Host(),
+		DisplayName: actor.Name,
+		Bio:         actor.Summary,
+	}
+	resp, err := s.database.Users(ctx, &pb.UsersRequest{
+		RequestType: pb.RequestType_INSERT,
+		Entry:       ue,
+	})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not add user: %s", resp.Error)
+	}
+	ue.GlobalId = resp.GlobalId
+	return ue, nil
+}
+
+// removeFollows removes any follow between two users, in either direction.
+func (s *serverWrapper) removeFollows(ctx context.Context, a, b int64) error {
+	for _, f := range []*pb.Follow{{Follower: a, Followed: b}, {Follower: b, Followed: a}} {
+		resp, err := s.database.Follow(ctx, &pb.DbFollowRequest{
+			RequestType: pb.RequestType_DELETE,
+			Match:       f,
+		})
+		if err != nil {
+			return err
+		} else if resp.ResultType != pb.ResultType_OK {
+			return fmt.Errorf("could not remove follow: %s", resp.Error)
+		}
+	}
+	return nil
+}
+
+// handleBlockActivity records a foreign actor blocking a local user. While
+// the block stands nothing from the local user is sent to the blocker, and
+// neither can follow the other, so any follows between them are removed.
+func (s *serverWrapper) handleBlockActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received a block activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t blockActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Actor); bad {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		blocker, blocked, err := s.resolveBlock(ctx, &t, true)
+		if err != nil {
+			e := err.(*blockErr)
+			log.Printf("Could not receive block activity. Error: %v", e)
+			w.WriteHeader(e.status)
+			fmt.Fprintf(w, "%s.\n", e.msg)
+			return
+		}
+
+		b := &pb.BlockEntry{Blocker: blocker.GlobalId, Blocked: blocked.GlobalId}
+		resp, err := s.database.AddBlock(ctx, b)
+		if err != nil {
+			log.Printf("Could not add block. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving block activity.\n")
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not add block. Error: %v", resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving block activity.\n")
+			return
+		}
+
+		if err := s.removeFollows(ctx, b.Blocker, b.Blocked); err != nil {
+			log.Printf("Could not remove follows for block. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving block activity.\n")
+			return
+		}
+
+		log.Println("Block activity received successfully.")
+		fmt.Fprintf(w, "{}\n")
+	}
+}
+
+// handleBlockUndoActivity lifts a block. Follows removed by the block are
+// not restored.
+func (s *serverWrapper) handleBlockUndoActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received a block Undo activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t blockUndoActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Object.Actor); bad {
+			return
+		}
+		// Only the blocker can lift their block.
+		if t.Actor != "" && t.Actor != t.Object.Actor {
+			log.Printf("%#v tried to undo a block by %#v", t.Actor, t.Object.Actor)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Cannot undo another actor's block.\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		blocker, blocked, err := s.resolveBlock(ctx, &t.Object, false)
+		if err != nil {
+			e := err.(*blockErr)
+			log.Printf("Could not receive block undo activity. Error: %v", e)
+			w.WriteHeader(e.status)
+			fmt.Fprintf(w, "%s.\n", e.msg)
+			return
+		}
+		if blocker == nil {
+			// We never knew of the blocker, so there's no block to lift.
+			log.Printf("Ignoring Undo of block by unknown actor %#v", t.Object.Actor)
+			fmt.Fprintf(w, "{}\n")
+			return
+		}
+
+		resp, err := s.database.RemoveBlock(ctx, &pb.BlockEntry{
+			Blocker: blocker.GlobalId,
+			Blocked: blocked.GlobalId,
+		})
+		if err != nil {
+			log.Printf("Could not remove block. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving block undo activity.\n")
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not remove block. Error: %v", resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving block undo activity.\n")
+			return
+		}
+
+		log.Println("Block undo activity received successfully.")
+		fmt.Fprintf(w, "{}\n")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+func TestHandleBlockActivity(t *testing.T) {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+		},
+		// The remote sender isn't known yet, and will be user 3.
+		follows: []*pb.Follow{
+			{Follower: 1, Followed: 3},
+			{Follower: 3, Followed: 1},
+			{Follower: 2, Followed: 3},
+		},
+		blocks: map[[2]int64]bool{},
+	}
+	srv.database = db
+
+	deliver := func(body string) int {
+		req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+		signTestRequest(req, []byte(body))
+		req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+		res := httptest.NewRecorder()
+		srv.handleActorInbox()(res, req)
+		return res.Code
+	}
+
+	block := `{"id": "http://remote.test/block/1", "type": "Block",
+		"actor": "http://remote.test/ap/@sender",
+		"object": "http://SKINNYTESTS:191/ap/@alice"}`
+	if code := deliver(block); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	if !db.blocks[[2]int64{3, 1}] {
+		t.Errorf("Expected block of alice by sender, got %v", db.blocks)
+	}
+	if len(db.follows) != 1 || db.follows[0].Follower != 2 {
+		t.Errorf("Expected only bob's follow to remain, got %v", db.follows)
+	}
+
+	undo := `{"id": "http://remote.test/undo/1", "type": "Undo",
+		"actor": "http://remote.test/ap/@sender",
+		"object": {"id": "http://remote.test/block/1", "type": "Block",
+			"actor": "http://remote.test/ap/@sender",
+			"object": "http://SKINNYTESTS:191/ap/@alice"}}`
+	if code := deliver(undo); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	if len(db.blocks) != 0 {
+		t.Errorf("Expected block to be lifted, got %v", db.blocks)
+	}
+}
+
+func TestHandleBlockActivityErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		activity string
+		body     string
+		want     int
+	}{
+		{
+			name:     "foreign object",
+			activity: "block",
+			body: `{"type": "Block", "actor": "http://remote.test/ap/@sender",
+				"object": "http://remote.test/ap/@dave"}`,
+			want: http.StatusBadRequest,
+		},
+		{
+			name:     "unknown local user",
+			activity: "block",
+			body: `{"type": "Block", "actor": "http://remote.test/ap/@sender",
+				"object": "http://SKINNYTESTS:191/ap/@nobody"}`,
+			want: http.StatusNotFound,
+		},
+		{
+			name:     "unfetchable actor",
+			activity: "block",
+			body: `{"type": "Block", "actor": "http://remote.test/ap/@dave",
+				"object": "http://SKINNYTESTS:191/ap/@alice"}`,
+			want: http.StatusBadGateway,
+		},
+		{
+			name:     "undo by another actor",
+			activity: "undo",
+			body: `{"type": "Undo", "actor": "http://remote.test/ap/@dave",
+				"object": {"type": "Block", "actor": "http://remote.test/ap/@sender",
+					"object": "http://SKINNYTESTS:191/ap/@alice"}}`,
+			want: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tests {
+		srv := newTestServerWrapper()
+		db := &MemoryDatabaseFake{
+			users:  []*pb.UsersEntry{{GlobalId: 1, Handle: "alice"}},
+			blocks: map[[2]int64]bool{},
+		}
+		srv.database = db
+
+		req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(tc.body))
+		req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+		res := httptest.NewRecorder()
+		m, _ := srv.getInboxHandler(tc.activity)
+		m(res, req)
+
+		if res.Code != tc.want {
+			t.Errorf("%s: Expected %d, got %#v", tc.name, tc.want, res.Code)
+		}
+		if len(db.blocks) != 0 {
+			t.Errorf("%s: Expected no blocks, got %v", tc.name, db.blocks)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/golang/protobuf/ptypes"
+	tspb "github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// collectionPageSize is the number of items on each page of a paged
+	// OrderedCollection.
+	collectionPageSize = 20
+
+	// maxOutboxShares limits how many shares are read for an outbox, since
+	// the database service requires a limit for shared posts.
+	maxOutboxShares = 1000
+
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	activityStreamsPublic  = "https://www.w3.org/ns/activitystreams#Public"
+	activityJSONType       = "application/activity+json"
+)
+
+// OrderedCollectionStruct holds an ActivityPub OrderedCollection or one page
+// of it (an OrderedCollectionPage).
+// See https://www.w3.org/TR/activitystreams-core/#paging
+type OrderedCollectionStruct struct {
+	// The @context in the output JSON-LD
+	Context      []string      `json:"@context,omitempty"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	First        string        `json:"first,omitempty"`
+	Next         string        `json:"next,omitempty"`
+	PartOf       string        `json:"partOf,omitempty"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+// AnnounceObjectStruct is an outgoing Announce of an article.
+type AnnounceObjectStruct struct {
+	Context   []string `json:"@context,omitempty"`
+	Type      string   `json:"type"`
+	ID        string   `json:"id"`
+	Actor     string   `json:"actor"`
+	Object    string   `json:"object"`
+	Published string   `json:"published"`
+	To        []string `json:"to"`
+}
+
+// getCollectionPage parses the ?page= cursor of a collection request.
+// A page of 0 means the collection itself, rather than a page, was requested.
+func getCollectionPage(r *http.Request) (int, error) {
+	p := r.URL.Query().Get("page")
+	if p == "" {
+		return 0, nil
+	}
+	page, err := strconv.Atoi(p)
+	if err != nil || page < 1 {
+		return 0, fmt.Errorf("invalid page %#v", p)
+	}
+	return page, nil
+}
+
+// newCollectionPage builds either the root OrderedCollection with id, or the
+// requested page of items when page is non-zero.
+func newCollectionPage(id string, page int, items []interface{}) *OrderedCollectionStruct {
+	c := &OrderedCollectionStruct{
+		Context:    []string{activityStreamsContext},
+		TotalItems: len(items),
+	}
+	if page == 0 {
+		c.ID = id
+		c.Type = "OrderedCollection"
+		if len(items) > 0 {
+			c.First = id + "?page=1"
+		}
+		return c
+	}
+
+	c.ID = fmt.Sprintf("%s?page=%d", id, page)
+	c.Type = "OrderedCollectionPage"
+	c.PartOf = id
+	start := (page - 1) * collectionPageSize
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + collectionPageSize
+	if end < len(items) {
+		c.Next = fmt.Sprintf("%s?page=%d", id, page+1)
+	} else {
+		end = len(items)
+	}
+	c.OrderedItems = items[start:end]
+	return c
+}
+
+func writeActivityJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", activityJSONType)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// localActorID builds the ActivityPub id of a user on this instance.
+func (s *serverWrapper) localActorID(handle string) string {
+	return fmt.Sprintf("%s/ap/@%s", util.NormaliseHost(s.hostname), handle)
+}
+
+// articleAPID returns the ActivityPub id of a post. Foreign posts keep the id
+// they were received with, local posts are built from the author's handle.
+func (s *serverWrapper) articleAPID(author *pb.UsersEntry, apID string, globalID int64) string {
+	if apID != "" {
+		return apID
+	}
+	return fmt.Sprintf("%s/%d", s.localActorID(author.Handle), globalID)
+}
+
+// outboxItem is an entry in an outbox along with its time for sorting.
+type outboxItem struct {
+	time     time.Time
+	activity interface{}
+}
+
+func timestampOrZero(t *tspb.Timestamp) time.Time {
+	goTime, err := ptypes.Timestamp(t)
+	if err != nil {
+		return time.Time{}
+	}
+	return goTime
+}
+
+// getOutboxItems collects the Create and Announce activities of a user,
+// newest first.
+func (s *serverWrapper) getOutboxItems(ctx context.Context, user *pb.UsersEntry) ([]interface{}, error) {
+	actor := s.localActorID(user.Handle)
+
+	pr := &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{AuthorId: user.GlobalId},
+	}
+	posts, err := s.database.Posts(ctx, pr)
+	if err != nil {
+		return nil, err
+	} else if posts.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get posts: %s", posts.Error)
+	}
+
+	spr := &pb.SharedPostsRequest{
+		NumPosts: maxOutboxShares,
+		SharerId: user.GlobalId,
+	}
+	shares, err := s.database.SharedPosts(ctx, spr)
+	if err != nil {
+		return nil, err
+	} else if shares.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get shares: %s", shares.Error)
+	}
+
+	items := []outboxItem{}
+	for _, p := range posts.Results {
+		items = append(items, outboxItem{
+			time:     timestampOrZero(p.CreationDatetime),
+			activity: createActivity(s.articleObject(ctx, user, p)),
+		})
+	}
+
+	for _, sh := range shares.Results {
+		apID := sh.ApId
+		if apID == "" {
+			author, err := util.GetAuthorFromDb(ctx, "", "", false, sh.AuthorId, s.database)
+			if err != nil {
+				log.Printf("Skipping share of %d in outbox: %v", sh.GlobalId, err)
+				continue
+			}
+			apID = s.articleAPID(author, "", sh.GlobalId)
+		}
+		items = append(items, outboxItem{
+			time: timestampOrZero(sh.AnnounceDatetime),
+			activity: &AnnounceObjectStruct{
+				Type:      "Announce",
+				ID:        fmt.Sprintf("%s#announces/%d", actor, sh.GlobalId),
+				Actor:     actor,
+				Object:    apID,
+				Published: util.ConvertPbTimestamp(sh.AnnounceDatetime),
+				To:        []string{activityStreamsPublic},
+			},
+		})
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].time.After(items[j].time)
+	})
+	activities := make([]interface{}, len(items))
+	for i, item := range items {
+		activities[i] = item.activity
+	}
+	return activities, nil
+}
+
+// handleOutbox serves a user's outbox as a paged OrderedCollection.
+// See https://www.w3.org/TR/activitypub/#outbox
+//
+// Private users only expose the number of items in their outbox.
+func (s *serverWrapper) handleOutbox() http.HandlerFunc {
+	const outboxErr = "Could not create outbox.\n"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		username := v["username"]
+
+		page, err := getCollectionPage(r)
+		if err != nil {
+			log.Printf("Bad outbox request for %#v: %v", username, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		user, err := util.GetAuthorFromDb(ctx, username, "", true, 0, s.database)
+		if err == util.UserNotFoundErr {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Could not get user for outbox: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, outboxErr)
+			return
+		}
+
+		items, err := s.getOutboxItems(ctx, user)
+		if err != nil {
+			log.Printf("Could not get outbox items for %#v: %v", username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, outboxErr)
+			return
+		}
+
+		id := s.localActorID(user.Handle) + "/outbox"
+		var c *OrderedCollectionStruct
+		if user.Private != nil && user.Private.Value {
+			c = newCollectionPage(id, 0, nil)
+			c.TotalItems = len(items)
+		} else {
+			c = newCollectionPage(id, page, items)
+		}
+
+		if err := writeActivityJSON(w, c); err != nil {
+			log.Printf("Could not marshal outbox: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// fetcherGlobalID finds the user making a request: the logged in user, or
+// the user owning the key a request from another server is signed with.
+// It returns false for anonymous requests, and for signers we don't know.
+func (s *serverWrapper) fetcherGlobalID(ctx context.Context, r *http.Request) (int64, bool) {
+	if globalID, err := s.getSessionGlobalID(r); err == nil {
+		return globalID, true
+	}
+	if _, err := getSignatureParams(r); err != nil {
+		return 0, false
+	}
+	owner, err := s.sigVerifier.Verify(r, nil)
+	if err != nil {
+		log.Printf("Ignoring bad signature on %s: %v", r.URL.Path, err)
+		return 0, false
+	}
+	globalID, err := s.actorGlobalID(ctx, owner)
+	if err != nil {
+		log.Printf("Could not find user signing %s: %v", r.URL.Path, err)
+		return 0, false
+	}
+	return globalID, true
+}
+
+// actorGlobalID finds the global id of the user with the ActivityPub id
+// actor, local or foreign.
+func (s *serverWrapper) actorGlobalID(ctx context.Context, actor string) (int64, error) {
+	var u *pb.UsersEntry
+	var err error
+	if handle, local := s.localHandleFromActorID(actor); local {
+		u, err = util.GetAuthorFromDb(ctx, handle, "", true, 0, s.database)
+	} else {
+		var a *util.RemoteActor
+		a, err = s.remoteActors.FetchActor(ctx, actor)
+		if err == nil {
+			u, err = util.GetAuthorFromDb(ctx, a.PreferredUsername, a.Host(), false, 0, s.database)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.GlobalId, nil
+}
+
+// isFollowerFetch reports whether a request comes from user or one of
+// their accepted followers, who may see what a private user hides from
+// everyone else.
+func (s *serverWrapper) isFollowerFetch(ctx context.Context, r *http.Request, user *pb.UsersEntry) bool {
+	globalID, ok := s.fetcherGlobalID(ctx, r)
+	return ok && s.isFollowerOf(ctx, globalID, user)
+}
+
+// canSee reports whether the user with the given global id, if known, may
+// see the posts of author: anyone may see those of public users, while only
+// their followers may see those of private users.
+func (s *serverWrapper) canSee(ctx context.Context, globalID int64, known bool, author *pb.UsersEntry) bool {
+	if author.Private == nil || !author.Private.Value {
+		return true
+	}
+	return known && s.isFollowerOf(ctx, globalID, author)
+}
+
+// isFollowerOf reports whether the user with the given global id is user or
+// one of their accepted followers.
+func (s *serverWrapper) isFollowerOf(ctx context.Context, globalID int64, user *pb.UsersEntry) bool {
+	if globalID == user.GlobalId {
+		return true
+	}
+	// Only accepted follows are found.
+	resp, err := s.database.Follow(ctx, &pb.DbFollowRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.Follow{Follower: globalID, Followed: user.GlobalId},
+	})
+	if err != nil {
+		log.Printf("Could not check if %d follows %#v: %v", globalID, user.Handle, err)
+		return false
+	} else if resp.ResultType != pb.ResultType_OK {
+		log.Printf("Could not check if %d follows %#v: %s", globalID, user.Handle, resp.Error)
+		return false
+	}
+	return len(resp.Results) > 0
+}
+
+// followActorID finds the ActivityPub id of a user in a follows collection.
+func (s *serverWrapper) followActorID(ctx context.Context, globalID int64) (string, error) {
+	u, err := util.GetAuthorFromDb(ctx, "", "", false, globalID, s.database)
+	if err != nil {
+		return "", err
+	}
+	return s.actorIDOf(ctx, u)
+}
+
+// actorIDOf finds the ActivityPub id of a user from the database. As the ids
+// of foreign users aren't stored, they're resolved by handle.
+func (s *serverWrapper) actorIDOf(ctx context.Context, u *pb.UsersEntry) (string, error) {
+	if u.Host == "" {
+		return s.localActorID(u.Handle), nil
+	}
+	a, err := s.remoteActors.Resolve(ctx, u.Handle, u.Host)
+	if err != nil {
+		return "", err
+	}
+	return a.ID, nil
+}
+
+// handleFollowCollection serves the followers, or the following, of a user
+// as a paged OrderedCollection.
+//
+// Private users only expose the size of the collection, other than to
+// themselves and their followers, whether logged in or signing the request.
+func (s *serverWrapper) handleFollowCollection(name string, followers bool) http.HandlerFunc {
+	collectionErr := fmt.Sprintf("Could not create %s collection.\n", name)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		username := v["username"]
+
+		page, err := getCollectionPage(r)
+		if err != nil {
+			log.Printf("Bad %s request for %#v: %v", name, username, err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		user, err := util.GetAuthorFromDb(ctx, username, "", true, 0, s.database)
+		if err == util.UserNotFoundErr {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Could not get user for %s: %v", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, collectionErr)
+			return
+		}
+
+		match := &pb.Follow{Follower: user.GlobalId}
+		if followers {
+			match = &pb.Follow{Followed: user.GlobalId}
+		}
+		resp, err := s.database.Follow(ctx, &pb.DbFollowRequest{
+			RequestType: pb.RequestType_FIND,
+			Match:       match,
+		})
+		if err != nil {
+			log.Printf("Could not get %s of %#v: %v", name, username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, collectionErr)
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not get %s of %#v: %v", name, username, resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, collectionErr)
+			return
+		}
+
+		// The items are the global ids of the users until the page is known,
+		// so only the users on it need to be looked up.
+		ids := make([]interface{}, len(resp.Results))
+		for i, f := range resp.Results {
+			ids[i] = f.Follower
+			if !followers {
+				ids[i] = f.Followed
+			}
+		}
+
+		id := s.localActorID(user.Handle) + "/" + name
+		var c *OrderedCollectionStruct
+		if user.Private != nil && user.Private.Value && !s.isFollowerFetch(ctx, r, user) {
+			c = newCollectionPage(id, 0, nil)
+			c.TotalItems = len(ids)
+		} else {
+			c = newCollectionPage(id, page, ids)
+		}
+
+		actors := []interface{}{}
+		for _, globalID := range c.OrderedItems {
+			actor, err := s.followActorID(ctx, globalID.(int64))
+			if err != nil {
+				log.Printf("Skipping user %d in %s of %#v: %v", globalID, name, username, err)
+				continue
+			}
+			actors = append(actors, actor)
+		}
+		c.OrderedItems = actors
+
+		if err := writeActivityJSON(w, c); err != nil {
+			log.Printf("Could not marshal %s collection: %v", name, err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+func (s *serverWrapper) handleFollowersCollection() http.HandlerFunc {
+	return s.handleFollowCollection("followers", true)
+}
+
+func (s *serverWrapper) handleFollowingCollection() http.HandlerFunc {
+	return s.handleFollowCollection("following", false)
+}
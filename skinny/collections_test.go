@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+// testTime returns a time that is later for larger i.
+func testTime(i int) time.Time {
+	return time.Date(2019, 1, 1, 0, i, 0, 0, time.UTC)
+}
+
+func newOutboxTestServer(private bool, numPosts int) *serverWrapper {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{{
+			Handle:   "testuser",
+			GlobalId: 1,
+			Private:  &wrapperpb.BoolValue{Value: private},
+		}},
+	}
+	for i := 0; i < numPosts; i++ {
+		ts, _ := ptypes.TimestampProto(testTime(i))
+		db.posts = append(db.posts, &pb.PostsEntry{
+			GlobalId:         int64(i + 10),
+			AuthorId:         1,
+			Title:            fmt.Sprintf("post %d", i),
+			CreationDatetime: ts,
+		})
+	}
+	ts, _ := ptypes.TimestampProto(testTime(numPosts))
+	db.shares = []*pb.SharesEntry{{
+		GlobalId:         3,
+		ApId:             "http://remote.test/ap/@sender/3",
+		AnnounceDatetime: ts,
+	}}
+	srv.database = db
+	return srv
+}
+
+func getTestOutbox(t *testing.T, srv *serverWrapper, query string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest("GET", "/ap/@testuser/outbox"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "testuser"})
+	res := httptest.NewRecorder()
+	srv.handleOutbox()(res, req)
+
+	var c map[string]interface{}
+	if res.Code == http.StatusOK {
+		if err := json.Unmarshal(res.Body.Bytes(), &c); err != nil {
+			t.Fatalf("Could not decode outbox %#v: %v", res.Body.String(), err)
+		}
+	}
+	return res, c
+}
+
+func TestOutboxCollection(t *testing.T) {
+	srv := newOutboxTestServer(false, collectionPageSize)
+
+	res, c := getTestOutbox(t, srv, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	if c["type"] != "OrderedCollection" {
+		t.Errorf("Expected OrderedCollection, got %#v", c["type"])
+	}
+	if c["totalItems"] != float64(collectionPageSize+1) {
+		t.Errorf("Expected %d items, got %#v", collectionPageSize+1, c["totalItems"])
+	}
+	if c["first"] != "http://SKINNYTESTS:191/ap/@testuser/outbox?page=1" {
+		t.Errorf("Unexpected first page %#v", c["first"])
+	}
+	if _, ok := c["orderedItems"]; ok {
+		t.Errorf("Expected no items on the collection itself")
+	}
+}
+
+func TestOutboxPages(t *testing.T) {
+	srv := newOutboxTestServer(false, collectionPageSize)
+
+	_, c := getTestOutbox(t, srv, "?page=1")
+	if c["type"] != "OrderedCollectionPage" {
+		t.Errorf("Expected OrderedCollectionPage, got %#v", c["type"])
+	}
+	if c["next"] != "http://SKINNYTESTS:191/ap/@testuser/outbox?page=2" {
+		t.Errorf("Unexpected next page %#v", c["next"])
+	}
+	items := c["orderedItems"].([]interface{})
+	if len(items) != collectionPageSize {
+		t.Fatalf("Expected %d items on first page, got %d", collectionPageSize, len(items))
+	}
+	// The share is the newest item so it comes first.
+	first := items[0].(map[string]interface{})
+	if first["type"] != "Announce" || first["object"] != "http://remote.test/ap/@sender/3" {
+		t.Errorf("Expected Announce of shared post first, got %#v", first)
+	}
+	second := items[1].(map[string]interface{})
+	if second["type"] != "Create" {
+		t.Errorf("Expected Create second, got %#v", second["type"])
+	}
+	if second["id"] != "http://SKINNYTESTS:191/ap/@testuser/"+fmt.Sprint(collectionPageSize+9)+"/activity" {
+		t.Errorf("Unexpected Create id %#v", second["id"])
+	}
+
+	_, c = getTestOutbox(t, srv, "?page=2")
+	if _, ok := c["next"]; ok {
+		t.Errorf("Expected no next on last page, got %#v", c["next"])
+	}
+	if items := c["orderedItems"].([]interface{}); len(items) != 1 {
+		t.Errorf("Expected 1 item on last page, got %d", len(items))
+	}
+}
+
+func TestOutboxPrivateUser(t *testing.T) {
+	srv := newOutboxTestServer(true, 2)
+
+	res, c := getTestOutbox(t, srv, "?page=1")
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	if c["totalItems"] != float64(3) {
+		t.Errorf("Expected 3 items, got %#v", c["totalItems"])
+	}
+	for _, k := range []string{"first", "orderedItems"} {
+		if _, ok := c[k]; ok {
+			t.Errorf("Expected private outbox to not contain %#v", k)
+		}
+	}
+}
+
+func TestOutboxBadPage(t *testing.T) {
+	srv := newOutboxTestServer(false, 1)
+	res, _ := getTestOutbox(t, srv, "?page=zero")
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %#v", res.Code)
+	}
+}
+
+// newFollowCollectionTestServer sets up a server where testuser is followed
+// by the remote test sender and numLocal local users, and follows user 2.
+func newFollowCollectionTestServer(private bool, numLocal int) *serverWrapper {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{
+				GlobalId: 1,
+				Handle:   "testuser",
+				Private:  &wrapperpb.BoolValue{Value: private},
+			},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		follows: []*pb.Follow{
+			{Follower: 3, Followed: 1},
+			{Follower: 1, Followed: 4},
+		},
+	}
+	for i := 0; i < numLocal; i++ {
+		id := int64(i + 4)
+		db.users = append(db.users, &pb.UsersEntry{GlobalId: id, Handle: fmt.Sprintf("user%d", id)})
+		db.follows = append(db.follows, &pb.Follow{Follower: id, Followed: 1})
+	}
+	srv.database = db
+	return srv
+}
+
+func getTestFollowCollection(t *testing.T, srv *serverWrapper, h http.HandlerFunc, query string, prepare func(*http.Request)) map[string]interface{} {
+	req, _ := http.NewRequest("GET", "/ap/@testuser/followers"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "testuser"})
+	res := httptest.NewRecorder()
+	if prepare != nil {
+		prepare(req)
+	}
+	h(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &c); err != nil {
+		t.Fatalf("Could not decode collection %#v: %v", res.Body.String(), err)
+	}
+	return c
+}
+
+func TestFollowersCollectionPages(t *testing.T) {
+	srv := newFollowCollectionTestServer(false, collectionPageSize)
+
+	c := getTestFollowCollection(t, srv, srv.handleFollowersCollection(), "", nil)
+	if c["totalItems"] != float64(collectionPageSize+1) {
+		t.Errorf("Expected %d followers, got %#v", collectionPageSize+1, c["totalItems"])
+	}
+	if c["first"] != "http://SKINNYTESTS:191/ap/@testuser/followers?page=1" {
+		t.Errorf("Unexpected first page %#v", c["first"])
+	}
+
+	c = getTestFollowCollection(t, srv, srv.handleFollowersCollection(), "?page=1", nil)
+	items := c["orderedItems"].([]interface{})
+	if len(items) != collectionPageSize || items[0] != testKeyOwner ||
+		items[1] != "http://SKINNYTESTS:191/ap/@user4" {
+		t.Errorf("Unexpected first page of followers %#v", items)
+	}
+	if c["next"] != "http://SKINNYTESTS:191/ap/@testuser/followers?page=2" {
+		t.Errorf("Unexpected next page %#v", c["next"])
+	}
+
+	c = getTestFollowCollection(t, srv, srv.handleFollowingCollection(), "?page=1", nil)
+	if c["id"] != "http://SKINNYTESTS:191/ap/@testuser/following?page=1" {
+		t.Errorf("Unexpected following page id %#v", c["id"])
+	}
+	items = c["orderedItems"].([]interface{})
+	if len(items) != 1 || items[0] != "http://SKINNYTESTS:191/ap/@user4" {
+		t.Errorf("Unexpected following %#v", items)
+	}
+}
+
+func TestFollowersCollectionPrivateUser(t *testing.T) {
+	srv := newFollowCollectionTestServer(true, 1)
+
+	c := getTestFollowCollection(t, srv, srv.handleFollowersCollection(), "?page=1", nil)
+	if c["totalItems"] != float64(2) {
+		t.Errorf("Expected 2 followers, got %#v", c["totalItems"])
+	}
+	for _, k := range []string{"first", "orderedItems"} {
+		if _, ok := c[k]; ok {
+			t.Errorf("Expected private followers to not contain %#v", k)
+		}
+	}
+
+	logIn := func(globalID int64) func(*http.Request) {
+		return func(r *http.Request) {
+			session, _ := srv.store.Get(r, "rabble-session")
+			session.Values["global_id"] = globalID
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		prepare func(*http.Request)
+		want    int
+	}{
+		{"user", logIn(1), 2},
+		{"local follower", logIn(4), 2},
+		{"other user", logIn(2), 0},
+		{"signed by follower", func(r *http.Request) { signTestRequest(r, nil) }, 2},
+	} {
+		c := getTestFollowCollection(t, srv, srv.handleFollowersCollection(), "?page=1", tc.prepare)
+		if items, _ := c["orderedItems"].([]interface{}); len(items) != tc.want {
+			t.Errorf("%s: Expected %d followers, got %#v", tc.name, tc.want, c["orderedItems"])
+		}
+	}
+
+	// The signer must follow the user.
+	srv.database.(*MemoryDatabaseFake).follows[0].Followed = 2
+	c = getTestFollowCollection(t, srv, srv.handleFollowersCollection(), "?page=1",
+		func(r *http.Request) { signTestRequest(r, nil) })
+	if _, ok := c["orderedItems"]; ok {
+		t.Errorf("Expected no followers for a signer not following, got %#v", c["orderedItems"])
+	}
+}
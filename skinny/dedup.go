@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// seenActivitiesTTL is how long an activity id is remembered. Servers
+	// stop redelivering activities well within this.
+	seenActivitiesTTL = time.Hour * 72
+	// seenActivitiesMax bounds the number of ids remembered. The oldest are
+	// forgotten first.
+	seenActivitiesMax = 50000
+)
+
+// activityDedup remembers the ids of activities recently delivered to each
+// local user, so redelivered activities aren't handled twice.
+//
+// If it has a path, each id is appended to the file there, which is read
+// again on startup. The file is compacted once it has grown to twice the
+// number of ids kept. It is safe for concurrent use.
+type activityDedup struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	max int
+	now func() time.Time
+
+	// seen maps each key to when it expires.
+	seen map[string]time.Time
+	// order holds the keys in the order they were added, which is also the
+	// order they expire in.
+	order []string
+
+	path     string
+	f        *os.File
+	logLines int
+}
+
+// newActivityDedup creates a store, loading any ids saved at path. If path
+// is empty the ids are only kept in memory.
+func newActivityDedup(path string, ttl time.Duration, max int) (*activityDedup, error) {
+	d := &activityDedup{
+		ttl:  ttl,
+		max:  max,
+		now:  time.Now,
+		seen: map[string]time.Time{},
+		path: path,
+	}
+	if path == "" {
+		return d, nil
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// dedupKey is the key an activity is remembered under. The same activity is
+// legitimately delivered once to each of its recipients. Its actor, who
+// signed it, is part of the key, so nobody can keep another actor's
+// activity from being handled by sending one with the same id first.
+func dedupKey(recipient string, a *addressedActivity) string {
+	return recipient + " " + a.Actor + " " + a.ID
+}
+
+func (d *activityDedup) load() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Each line is the unix time the key expires, and the key. Later
+		// lines replace earlier ones, and forgotten keys expire at 0.
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		sec, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		d.seen[parts[1]] = time.Unix(sec, 0)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	now := d.now()
+	for k, expires := range d.seen {
+		if expires.After(now) {
+			d.order = append(d.order, k)
+		} else {
+			delete(d.seen, k)
+		}
+	}
+	sort.Slice(d.order, func(i, j int) bool {
+		return d.seen[d.order[i]].Before(d.seen[d.order[j]])
+	})
+	d.expire()
+	return nil
+}
+
+// compact rewrites the file with only the keys still remembered, and opens
+// it for appending. It must be called with d.mu held, or before d is used.
+func (d *activityDedup) compact() error {
+	if d.f != nil {
+		d.f.Close()
+		d.f = nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(d.path), ".seen")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	for _, k := range d.order {
+		fmt.Fprintf(w, "%d %s\n", d.seen[k].Unix(), k)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path); err != nil {
+		return err
+	}
+
+	d.f, err = os.OpenFile(d.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	d.logLines = len(d.order)
+	return nil
+}
+
+// expire forgets keys which have expired, and the oldest keys if there are
+// too many. It must be called with d.mu held.
+func (d *activityDedup) expire() {
+	now := d.now()
+	for len(d.order) > 0 {
+		k := d.order[0]
+		if len(d.order) <= d.max && d.seen[k].After(now) {
+			break
+		}
+		delete(d.seen, k)
+		d.order = d.order[1:]
+	}
+}
+
+// add remembers a key. It must be called with d.mu held.
+func (d *activityDedup) add(k string) error {
+	expires := d.now().Add(d.ttl)
+	d.seen[k] = expires
+	d.order = append(d.order, k)
+	d.expire()
+	if d.f == nil {
+		return nil
+	}
+
+	if d.logLines >= 2*d.max {
+		return d.compact()
+	}
+	d.logLines++
+	_, err := fmt.Fprintf(d.f, "%d %s\n", expires.Unix(), k)
+	return err
+}
+
+func (d *activityDedup) has(k string) bool {
+	d.expire()
+	_, exists := d.seen[k]
+	return exists
+}
+
+// CheckAndAdd remembers a key, and reports whether it had already been seen.
+func (d *activityDedup) CheckAndAdd(k string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.has(k) {
+		return true, nil
+	}
+	return false, d.add(k)
+}
+
+// Forget removes a key, so that the activity can be delivered again.
+func (d *activityDedup) Forget(k string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, exists := d.seen[k]; !exists {
+		return nil
+	}
+	delete(d.seen, k)
+	for i, o := range d.order {
+		if o == k {
+			d.order = append(d.order[:i:i], d.order[i+1:]...)
+			break
+		}
+	}
+	if d.f == nil {
+		return nil
+	}
+	d.logLines++
+	_, err := fmt.Fprintf(d.f, "0 %s\n", k)
+	return err
+}
+
+// Close closes the file the ids are saved to.
+func (d *activityDedup) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return nil
+	}
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
+
+// claimActivity checks whether an activity has already been delivered to
+// recipient, and if not remembers it. Activities without an id can't be
+// deduplicated, and are always claimed. If false is returned the activity
+// is a duplicate, and the delivery has been acknowledged on w.
+func (s *serverWrapper) claimActivity(w http.ResponseWriter, recipient string, a *addressedActivity) bool {
+	if s.seenActivities == nil || a.ID == "" {
+		return true
+	}
+	dup, err := s.seenActivities.CheckAndAdd(dedupKey(recipient, a))
+	if err != nil {
+		// Handling the activity matters more than remembering it.
+		log.Printf("Could not save activity id %#v: %v", a.ID, err)
+	}
+	if dup {
+		log.Printf("Ignoring duplicate delivery of %#v to %#v", a.ID, recipient)
+		w.WriteHeader(http.StatusOK)
+		return false
+	}
+	return true
+}
+
+// unclaimActivity forgets an activity claimed by claimActivity, after it
+// failed to be handled, so that the sender can deliver it again.
+func (s *serverWrapper) unclaimActivity(recipient string, a *addressedActivity) {
+	if s.seenActivities == nil || a.ID == "" {
+		return
+	}
+	if err := s.seenActivities.Forget(dedupKey(recipient, a)); err != nil {
+		log.Printf("Could not forget activity id %#v: %v", a.ID, err)
+	}
+}
+
+// statusWriter keeps the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestActivityDedupExpiresAndBounds(t *testing.T) {
+	d, _ := newActivityDedup("", time.Hour, 2)
+	now := testTime(10)
+	d.now = func() time.Time { return now }
+
+	for _, k := range []string{"a", "b"} {
+		if dup, _ := d.CheckAndAdd(k); dup {
+			t.Errorf("Expected %#v to be new", k)
+		}
+	}
+	if dup, _ := d.CheckAndAdd("a"); !dup {
+		t.Errorf("Expected \"a\" to be a duplicate")
+	}
+
+	// Adding a third key pushes out the oldest.
+	d.CheckAndAdd("c")
+	if dup, _ := d.CheckAndAdd("a"); dup {
+		t.Errorf("Expected \"a\" to be forgotten once over the limit")
+	}
+
+	now = now.Add(time.Hour * 2)
+	if dup, _ := d.CheckAndAdd("c"); dup {
+		t.Errorf("Expected \"c\" to have expired")
+	}
+}
+
+func TestActivityDedupPersists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seen_activities")
+
+	d, err := newActivityDedup(path, time.Hour, 10)
+	if err != nil {
+		t.Fatalf("newActivityDedup: %v", err)
+	}
+	d.CheckAndAdd("alice https://remote.test/1")
+	d.CheckAndAdd("alice https://remote.test/2")
+	d.Forget("alice https://remote.test/2")
+	d.Close()
+
+	d, err = newActivityDedup(path, time.Hour, 10)
+	if err != nil {
+		t.Fatalf("newActivityDedup: %v", err)
+	}
+	defer d.Close()
+	if dup, _ := d.CheckAndAdd("alice https://remote.test/1"); !dup {
+		t.Errorf("Expected id to be remembered after restart")
+	}
+	if dup, _ := d.CheckAndAdd("alice https://remote.test/2"); dup {
+		t.Errorf("Expected forgotten id to stay forgotten after restart")
+	}
+}
+
+func TestDedupKeyIncludesActor(t *testing.T) {
+	a := &addressedActivity{ID: "https://remote.test/1", Actor: "https://remote.test/ap/@sender"}
+	forged := &addressedActivity{ID: "https://remote.test/1", Actor: "https://evil.test/ap/@mallory"}
+	if dedupKey("alice", a) == dedupKey("alice", forged) {
+		t.Errorf("Expected activities of different actors to have different keys")
+	}
+}
+
+func TestActorInboxIgnoresDuplicates(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.seenActivities, _ = newActivityDedup("", time.Hour, 10)
+	handled := 0
+	status := http.StatusOK
+	srv.actorInboxRouter = map[string]http.HandlerFunc{
+		"like": func(w http.ResponseWriter, r *http.Request) {
+			handled++
+			w.WriteHeader(status)
+		},
+	}
+
+	deliver := func(recipient string) int {
+		body := `{"id": "http://remote.test/like/1", "type": "Like",
+			"actor": "http://remote.test/ap/@sender"}`
+		req, _ := http.NewRequest("POST", "/ap/@"+recipient+"/inbox", bytes.NewBufferString(body))
+		signTestRequest(req, []byte(body))
+		req = mux.SetURLVars(req, map[string]string{"username": recipient})
+		res := httptest.NewRecorder()
+		srv.handleActorInbox()(res, req)
+		return res.Code
+	}
+
+	// A failed delivery can be retried.
+	status = http.StatusInternalServerError
+	deliver("alice")
+	status = http.StatusOK
+	deliver("alice")
+	if code := deliver("alice"); code != http.StatusOK {
+		t.Errorf("Expected duplicate to be acknowledged with 200 OK, got %#v", code)
+	}
+	deliver("bob")
+	if handled != 3 {
+		t.Errorf("Expected 3 deliveries to be handled, got %d", handled)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
 	"github.com/golang/protobuf/ptypes"
 	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/gorilla/mux"
@@ -17,6 +18,8 @@ import (
 const (
 	pendingFollowsNotFound = "Issue with finding pending follows.\n"
 	modifyFollowFailed     = "Could not modify follow"
+	followedNotFound       = "Could not find the user to follow"
+	followedBlocked        = "Cannot follow users on that instance"
 )
 
 func (s *serverWrapper) handleFollow() http.HandlerFunc {
@@ -54,6 +57,34 @@ func (s *serverWrapper) handleFollow() http.HandlerFunc {
 
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
 		defer cancel()
+
+		// Foreign users we haven't seen yet aren't in our database, so check
+		// the handle exists on its server before sending the follow.
+		followedHandle, followedHost, err := util.ParseUsername(j.Followed)
+		if err != nil {
+			log.Printf("Could not parse followed user %#v: %v", j.Followed, err)
+			w.WriteHeader(http.StatusBadRequest)
+			errResp.Error = followedNotFound
+			enc.Encode(errResp)
+			return
+		}
+		if followedHost != "" && s.blacklist.blocked(followedHost) {
+			log.Printf("%#v tried to follow %#v on a blocked instance", handle, j.Followed)
+			w.WriteHeader(http.StatusForbidden)
+			errResp.Error = followedBlocked
+			enc.Encode(errResp)
+			return
+		}
+		if followedHost != "" {
+			if _, err := s.remoteActors.Resolve(ctx, followedHandle, followedHost); err != nil {
+				log.Printf("Could not resolve followed user %#v: %v", j.Followed, err)
+				w.WriteHeader(http.StatusNotFound)
+				errResp.Error = followedNotFound
+				enc.Encode(errResp)
+				return
+			}
+		}
+
 		resp, err := s.follows.SendFollowRequest(ctx, &j)
 		if err != nil {
 			log.Printf("Could not send follow request: %#v", err)
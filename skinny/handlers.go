@@ -383,6 +383,8 @@ type createArticleStruct struct {
 	CreationDatetime string   `json:"creation_datetime"`
 	Tags             []string `json:"tags"`
 	Summary          string   `json:"summary"`
+	// InReplyTo is the id of the article this is a comment on, if any.
+	InReplyTo int64 `json:"in_reply_to"`
 }
 
 func (s *serverWrapper) handleCreateArticle() http.HandlerFunc {
@@ -427,10 +429,23 @@ func (s *serverWrapper) handleCreateArticle() http.HandlerFunc {
 			Foreign:          false,
 			Tags:             t.Tags,
 			Summary:          t.Summary,
+			InReplyTo:        t.InReplyTo,
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
 		defer cancel()
 
+		if t.InReplyTo != 0 {
+			// Private users' posts can only be replied to by their followers,
+			// and to anyone else look like they don't exist.
+			if err := s.checkCanReply(ctx, globalID, t.InReplyTo); err != nil {
+				log.Printf("Could not find article %d to reply to: %v", t.InReplyTo, err)
+				w.WriteHeader(http.StatusNotFound)
+				cResp.Error = "Could not find the article to reply to"
+				enc.Encode(cResp)
+				return
+			}
+		}
+
 		resp, err := s.article.CreateNewArticle(ctx, na)
 		if err != nil {
 			log.Printf("Could not create new article: %v", err)
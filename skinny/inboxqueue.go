@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultInboxWorkers = 4
+	// defaultInboxMaxPending is how many activities may wait in the queue
+	// before new ones are turned away.
+	defaultInboxMaxPending = 1000
+	// inboxMaxAttempts is how many times an activity is tried before it is
+	// moved to the dead letter store.
+	inboxMaxAttempts  = 8
+	inboxBaseBackoff  = time.Second * 2
+	inboxMaxBackoff   = time.Minute * 10
+	inboxJobExtension = ".json"
+	// inboxRetryAfter is how many seconds senders are asked to wait when
+	// the queue is full.
+	inboxRetryAfter = "120"
+)
+
+// errInboxQueueFull is returned by Enqueue when too many activities are
+// waiting to be handled. Senders should try again later.
+var errInboxQueueFull = errors.New("inbox queue is full")
+
+// inboxJob is an activity accepted into the inbox of a local user, waiting
+// to be handled by the actorInboxRouter. Jobs with a Task are instead work
+// done in the background, such as repointTask, and Body holds its
+// arguments.
+type inboxJob struct {
+	ID          string    `json:"id"`
+	Task        string    `json:"task,omitempty"`
+	Recipient   string    `json:"recipient"`
+	Body        string    `json:"body"`
+	Received    time.Time `json:"received"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// inboxProcessor handles a job. If it fails, retry says whether trying
+// again later could succeed.
+type inboxProcessor func(j *inboxJob) (retry bool, err error)
+
+// inboxQueue is a durable queue of inbox activities, drained by a pool of
+// workers. Each job is stored as a file in dir until it is handled. Jobs
+// which fail are retried with exponential backoff, and moved to the dead
+// letter directory once they run out of attempts or can't be retried.
+// At most maxPending jobs are held at once, including those waiting to be
+// retried.
+type inboxQueue struct {
+	dir        string
+	deadDir    string
+	process    inboxProcessor
+	workers    int
+	maxPending int
+
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	// wake signals idle workers that a job is ready.
+	wake chan struct{}
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	mu  sync.Mutex
+	seq int64
+	// ready holds the jobs due to be handled, oldest first.
+	ready []*inboxJob
+	// pending counts the jobs not yet handled or dead lettered.
+	pending int
+}
+
+// newInboxQueue creates a queue stored in dir, creating the directory if
+// it doesn't exist. Call Start to begin processing.
+func newInboxQueue(dir string, workers int, process inboxProcessor) (*inboxQueue, error) {
+	q := &inboxQueue{
+		dir:         filepath.Join(dir, "pending"),
+		deadDir:     filepath.Join(dir, "dead"),
+		process:     process,
+		workers:     workers,
+		maxPending:  defaultInboxMaxPending,
+		maxAttempts: inboxMaxAttempts,
+		baseBackoff: inboxBaseBackoff,
+		maxBackoff:  inboxMaxBackoff,
+		wake:        make(chan struct{}, workers),
+		quit:        make(chan struct{}),
+	}
+	for _, d := range []string{q.dir, q.deadDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (q *inboxQueue) jobPath(dir, id string) string {
+	return filepath.Join(dir, id+inboxJobExtension)
+}
+
+// write stores a job in dir, replacing any older copy of it.
+func (q *inboxQueue) write(dir string, j *inboxJob) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".job")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.jobPath(dir, j.ID))
+}
+
+func (q *inboxQueue) read(dir string) ([]*inboxJob, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*inboxJob
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), inboxJobExtension) {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		j := &inboxJob{}
+		if err := json.Unmarshal(b, j); err != nil {
+			log.Printf("Skipping corrupt inbox job %s: %v", f.Name(), err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs, nil
+}
+
+// Enqueue stores an activity for recipient. Once it returns without error
+// the activity will be handled, even if skinny restarts. If the queue is
+// full it returns errInboxQueueFull.
+func (q *inboxQueue) Enqueue(recipient, body string) error {
+	return q.enqueue(&inboxJob{Recipient: recipient, Body: body})
+}
+
+// EnqueueTask stores a background task, to be handled like an activity.
+func (q *inboxQueue) EnqueueTask(task, body string) error {
+	return q.enqueue(&inboxJob{Task: task, Body: body})
+}
+
+func (q *inboxQueue) enqueue(j *inboxJob) error {
+	now := time.Now()
+	q.mu.Lock()
+	if q.pending >= q.maxPending {
+		q.mu.Unlock()
+		return errInboxQueueFull
+	}
+	q.pending++
+	q.seq++
+	// IDs sort in the order the jobs were received.
+	j.ID = fmt.Sprintf("%020d-%06d", now.UnixNano(), q.seq)
+	q.mu.Unlock()
+
+	j.Received = now
+	j.NextAttempt = now
+	if err := q.write(q.dir, j); err != nil {
+		q.done()
+		return err
+	}
+	q.submit(j)
+	return nil
+}
+
+// done records that a job has left the queue.
+func (q *inboxQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	q.mu.Unlock()
+}
+
+// submit hands a job to the workers.
+func (q *inboxQueue) submit(j *inboxJob) {
+	q.mu.Lock()
+	q.ready = append(q.ready, j)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+		// Enough workers are already being woken to find the job.
+	}
+}
+
+// next waits for a job to be ready, returning nil once the queue is
+// stopped.
+func (q *inboxQueue) next() *inboxJob {
+	for {
+		q.mu.Lock()
+		if len(q.ready) > 0 {
+			j := q.ready[0]
+			q.ready[0] = nil
+			q.ready = q.ready[1:]
+			q.mu.Unlock()
+			return j
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-q.quit:
+			return nil
+		}
+	}
+}
+
+// schedule submits a job once its next attempt is due.
+func (q *inboxQueue) schedule(j *inboxJob) {
+	delay := time.Until(j.NextAttempt)
+	if delay <= 0 {
+		q.submit(j)
+		return
+	}
+	time.AfterFunc(delay, func() { q.submit(j) })
+}
+
+// backoff returns how long to wait before trying a job again.
+func (q *inboxQueue) backoff(attempts int) time.Duration {
+	d := q.baseBackoff
+	for i := 1; i < attempts && d < q.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.maxBackoff {
+		d = q.maxBackoff
+	}
+	return d
+}
+
+func (q *inboxQueue) run(j *inboxJob) {
+	retry, err := q.process(j)
+	if err == nil {
+		q.done()
+		if err := os.Remove(q.jobPath(q.dir, j.ID)); err != nil {
+			log.Printf("Could not remove handled inbox job %s: %v", j.ID, err)
+		}
+		return
+	}
+
+	j.Attempts++
+	j.LastError = err.Error()
+	if !retry || j.Attempts >= q.maxAttempts {
+		log.Printf("Giving up on inbox job %s for %#v after %d attempts: %v",
+			j.ID, j.Recipient, j.Attempts, err)
+		q.done()
+		if err := q.write(q.deadDir, j); err != nil {
+			log.Printf("Could not move inbox job %s to dead letters: %v", j.ID, err)
+			return
+		}
+		os.Remove(q.jobPath(q.dir, j.ID))
+		return
+	}
+
+	j.NextAttempt = time.Now().Add(q.backoff(j.Attempts))
+	log.Printf("Inbox job %s for %#v failed, retrying at %v: %v",
+		j.ID, j.Recipient, j.NextAttempt, err)
+	if err := q.write(q.dir, j); err != nil {
+		log.Printf("Could not save inbox job %s: %v", j.ID, err)
+	}
+	q.schedule(j)
+}
+
+// Start loads any jobs left from a previous run and starts the workers.
+func (q *inboxQueue) Start() error {
+	pending, err := q.read(q.dir)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		log.Printf("Resuming %d queued inbox activities", len(pending))
+	}
+
+	// Jobs enqueued before starting are already waiting.
+	q.mu.Lock()
+	queued := map[string]bool{}
+	for _, j := range q.ready {
+		queued[j.ID] = true
+	}
+	for _, j := range pending {
+		if !queued[j.ID] {
+			q.pending++
+		}
+	}
+	q.mu.Unlock()
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for j := q.next(); j != nil; j = q.next() {
+				q.run(j)
+			}
+		}()
+	}
+
+	for _, j := range pending {
+		if !queued[j.ID] {
+			q.schedule(j)
+		}
+	}
+	return nil
+}
+
+// Stop waits for the jobs being handled to finish. Jobs still waiting stay
+// on disk, and are handled when the queue is next started.
+func (q *inboxQueue) Stop() {
+	close(q.quit)
+	q.wg.Wait()
+}
+
+// Dead returns the jobs in the dead letter store.
+func (q *inboxQueue) Dead() ([]*inboxJob, error) {
+	return q.read(q.deadDir)
+}
+
+// writeEnqueueError responds to an activity which couldn't be queued. A full
+// queue is reported as 503 Service Unavailable, so that senders try again
+// later.
+func writeEnqueueError(w http.ResponseWriter, err error) {
+	if err == errInboxQueueFull {
+		w.Header().Set("Retry-After", inboxRetryAfter)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	fmt.Fprintf(w, "Could not accept activity.")
+}
+
+// processInboxJob passes a queued activity to its actorInboxRouter handler,
+// as handleActorInbox would if it handled the activity directly. Tasks are
+// passed to their own handlers.
+func (s *serverWrapper) processInboxJob(j *inboxJob) (bool, error) {
+	switch j.Task {
+	case "":
+	case repointTask:
+		return s.processRepointJob(j)
+	default:
+		return false, fmt.Errorf("unknown task %#v", j.Task)
+	}
+
+	a, err := parseAddressedActivity([]byte(j.Body))
+	if err != nil {
+		return false, err
+	}
+	m, exists := s.getInboxHandler(a.Type)
+	if !exists {
+		return false, fmt.Errorf("unable to handle activity type %#v", a.Type)
+	}
+
+	r, err := http.NewRequest("POST", s.localActorID(j.Recipient)+"/inbox",
+		strings.NewReader(j.Body))
+	if err != nil {
+		return false, err
+	}
+	r = mux.SetURLVars(r, map[string]string{"username": j.Recipient})
+	rec := newStatusRecorder()
+	m(rec, r)
+
+	if rec.code >= 500 {
+		return true, fmt.Errorf("%s handler returned status %d", a.Type, rec.code)
+	} else if rec.code >= 300 {
+		return false, fmt.Errorf("%s handler returned status %d", a.Type, rec.code)
+	}
+	return false, nil
+}
+
+type deadLettersResp struct {
+	Error string      `json:"error"`
+	Jobs  []*inboxJob `json:"jobs"`
+}
+
+// handleInboxDeadLetters lists the inbox activities that could not be
+// handled, for admins.
+func (s *serverWrapper) handleInboxDeadLetters() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		if _, ok := s.requireAdmin(w, r); !ok {
+			enc.Encode(&deadLettersResp{Error: adminRequired})
+			return
+		}
+		if s.inboxQueue == nil {
+			enc.Encode(&deadLettersResp{Jobs: []*inboxJob{}})
+			return
+		}
+
+		jobs, err := s.inboxQueue.Dead()
+		if err != nil {
+			log.Printf("Could not read inbox dead letters: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&deadLettersResp{Error: "Could not read dead letters"})
+			return
+		}
+		enc.Encode(&deadLettersResp{Jobs: jobs})
+	}
+}
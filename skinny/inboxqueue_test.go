@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestInboxQueue(t *testing.T, process inboxProcessor) (*inboxQueue, string) {
+	dir, err := ioutil.TempDir("", "inboxqueue")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	q, err := newInboxQueue(dir, 2, process)
+	if err != nil {
+		t.Fatalf("newInboxQueue: %v", err)
+	}
+	q.baseBackoff = time.Millisecond
+	q.maxBackoff = time.Millisecond * 5
+	return q, dir
+}
+
+// waitFor polls cond until it is true or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestInboxQueueRetriesWithBackoff(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	q, dir := newTestInboxQueue(t, func(j *inboxJob) (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			return true, errors.New("create service unavailable")
+		}
+		return false, nil
+	})
+	defer os.RemoveAll(dir)
+	q.Start()
+	defer q.Stop()
+
+	if err := q.Enqueue("alice", `{"type": "Create"}`); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	waitFor(t, "job to be handled", func() bool {
+		pending, _ := q.read(q.dir)
+		return len(pending) == 0
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	if dead, _ := q.Dead(); len(dead) != 0 {
+		t.Errorf("Expected no dead letters, got %v", dead)
+	}
+}
+
+func TestInboxQueueDeadLetters(t *testing.T) {
+	q, dir := newTestInboxQueue(t, func(j *inboxJob) (bool, error) {
+		if j.Recipient == "bob" {
+			return false, errors.New("bad activity")
+		}
+		return true, errors.New("create service unavailable")
+	})
+	defer os.RemoveAll(dir)
+	q.maxAttempts = 3
+	q.Start()
+	defer q.Stop()
+
+	q.Enqueue("alice", `{"type": "Create"}`)
+	q.Enqueue("bob", `{"type": "Create"}`)
+	waitFor(t, "jobs to be dead lettered", func() bool {
+		dead, _ := q.Dead()
+		return len(dead) == 2
+	})
+
+	dead, _ := q.Dead()
+	attempts := map[string]int{}
+	for _, j := range dead {
+		attempts[j.Recipient] = j.Attempts
+	}
+	if attempts["alice"] != 3 || attempts["bob"] != 1 {
+		t.Errorf("Expected alice to be tried 3 times and bob once, got %v", attempts)
+	}
+	if pending, _ := q.read(q.dir); len(pending) != 0 {
+		t.Errorf("Expected no pending jobs, got %v", pending)
+	}
+}
+
+func TestInboxQueueResumesAfterRestart(t *testing.T) {
+	q, dir := newTestInboxQueue(t, nil)
+	defer os.RemoveAll(dir)
+	// The queue isn't started, as if skinny stopped before handling it.
+	q.Enqueue("alice", `{"type": "Create"}`)
+	q.Stop()
+
+	handled := make(chan string, 1)
+	q, err := newInboxQueue(dir, 1, func(j *inboxJob) (bool, error) {
+		handled <- j.Recipient
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("newInboxQueue: %v", err)
+	}
+	q.Start()
+	defer q.Stop()
+
+	select {
+	case r := <-handled:
+		if r != "alice" {
+			t.Errorf("Expected job for alice, got %#v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected queued job to be handled after restart")
+	}
+}
+
+func TestInboxQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	q, dir := newTestInboxQueue(t, func(j *inboxJob) (bool, error) {
+		<-release
+		return false, nil
+	})
+	defer os.RemoveAll(dir)
+	q.maxPending = 2
+	q.Start()
+	defer q.Stop()
+
+	for i := 0; i < 2; i++ {
+		if err := q.Enqueue("alice", `{"type": "Create"}`); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	if err := q.Enqueue("alice", `{"type": "Create"}`); err != errInboxQueueFull {
+		t.Errorf("Expected errInboxQueueFull, got %v", err)
+	}
+
+	close(release)
+	waitFor(t, "queue to drain", func() bool {
+		return q.Enqueue("alice", `{"type": "Create"}`) == nil
+	})
+}
+
+func TestActorInboxQueueFull(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.actorInboxRouter = map[string]http.HandlerFunc{
+		"create": func(w http.ResponseWriter, r *http.Request) {},
+	}
+	q, dir := newTestInboxQueue(t, srv.processInboxJob)
+	defer os.RemoveAll(dir)
+	q.maxPending = 0
+	srv.inboxQueue = q
+
+	body := `{"type": "Create", "id": "http://remote.test/1", "actor": "http://remote.test/ap/@sender"}`
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+	signTestRequest(req, []byte(body))
+	req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+	res := httptest.NewRecorder()
+	srv.handleActorInbox()(res, req)
+
+	if res.Code != http.StatusServiceUnavailable || res.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 Service Unavailable with Retry-After, got %#v", res.Code)
+	}
+}
+
+func TestActorInboxQueuesActivity(t *testing.T) {
+	srv := newTestServerWrapper()
+	handled := make(chan string, 1)
+	srv.actorInboxRouter = map[string]http.HandlerFunc{
+		"create": func(w http.ResponseWriter, r *http.Request) {
+			handled <- mux.Vars(r)["username"]
+		},
+	}
+	q, dir := newTestInboxQueue(t, srv.processInboxJob)
+	defer os.RemoveAll(dir)
+	srv.inboxQueue = q
+
+	body := `{"type": "Create", "actor": "http://remote.test/ap/@sender"}`
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+	signTestRequest(req, []byte(body))
+	req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+	res := httptest.NewRecorder()
+	srv.handleActorInbox()(res, req)
+
+	if res.Code != http.StatusAccepted {
+		t.Errorf("Expected 202 Accepted, got %#v", res.Code)
+	}
+	if len(handled) != 0 {
+		t.Errorf("Expected activity to not be handled before the queue starts")
+	}
+
+	q.Start()
+	defer q.Stop()
+	select {
+	case r := <-handled:
+		if r != "alice" {
+			t.Errorf("Expected activity for alice, got %#v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected queued activity to be handled")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+// ostatusSubscribeRel is the webfinger link relation other servers use to
+// find where to send a user who wants to follow someone from here.
+const ostatusSubscribeRel = "http://ostatus.org/schema/1.0/subscribe"
+
+var (
+	interactionNotFound = errors.New("could not find a profile or post at that address")
+	interactionBlocked  = errors.New("that instance is blocked")
+)
+
+// interactionTarget is what a profile or post URI pasted by a user refers
+// to.
+type interactionTarget struct {
+	// Handle is the user to follow, or the author of the post, in the form
+	// handleFollow takes, e.g. "alice" or "alice@remote.host".
+	Handle string `json:"handle"`
+	// ArticleID is the id of the post in our database, or 0 for a profile.
+	// It is also 0 for posts we don't have, as they can't be liked or
+	// announced until they are sent to us.
+	ArticleID int64 `json:"article_id,omitempty"`
+}
+
+// route is the web app route showing the target.
+func (t *interactionTarget) route() string {
+	if t.ArticleID != 0 {
+		return fmt.Sprintf("/@%s/%d", t.Handle, t.ArticleID)
+	}
+	return "/@" + t.Handle
+}
+
+type interactionStruct struct {
+	URI string `json:"uri"`
+	// Type is one of "follow", "like" or "announce".
+	Type string `json:"type"`
+}
+
+// parseLocalInteraction finds the target of a URL on this server, which may
+// be an actor or article id, or a page of the web app.
+func parseLocalInteraction(u *url.URL) (*interactionTarget, error) {
+	for _, p := range []string{u.Path, u.Fragment} {
+		var rest string
+		switch {
+		case strings.HasPrefix(p, "/ap/@"):
+			rest = strings.TrimPrefix(p, "/ap/@")
+		case strings.HasPrefix(p, "/@"):
+			rest = strings.TrimPrefix(p, "/@")
+		default:
+			continue
+		}
+		parts := strings.Split(rest, "/")
+		if parts[0] == "" {
+			return nil, interactionNotFound
+		}
+		t := &interactionTarget{Handle: parts[0]}
+		if len(parts) > 1 {
+			id, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, interactionNotFound
+			}
+			t.ArticleID = id
+		}
+		return t, nil
+	}
+	return nil, interactionNotFound
+}
+
+// remoteHandle returns the handle of a foreign actor in the form
+// handleFollow takes.
+func remoteHandle(a *util.RemoteActor) string {
+	u, err := url.Parse(a.ID)
+	if err != nil {
+		return a.PreferredUsername
+	}
+	return a.PreferredUsername + "@" + u.Host
+}
+
+// resolveRemoteInteraction fetches a foreign profile or post to find what it
+// is. Posts are looked up in our database by their ActivityPub id.
+func (s *serverWrapper) resolveRemoteInteraction(ctx context.Context, u *url.URL) (*interactionTarget, error) {
+	var raw json.RawMessage
+	if err := s.fetchObject(ctx, u.String(), &raw); err != nil {
+		log.Printf("Could not fetch interaction target %#v: %v", u.String(), err)
+		return nil, interactionNotFound
+	}
+	norm, err := s.normaliseActivity(ctx, raw)
+	if err != nil {
+		log.Printf("Could not normalise interaction target %#v: %v", u.String(), err)
+		return nil, interactionNotFound
+	}
+	var o struct {
+		ID           string `json:"id"`
+		Type         string `json:"type"`
+		AttributedTo string `json:"attributedTo"`
+	}
+	if err := json.Unmarshal(norm, &o); err != nil {
+		return nil, err
+	}
+	// Like actors, the object has to come from the host it claims to.
+	if id, err := url.Parse(o.ID); err != nil || id.Host != u.Host {
+		log.Printf("Interaction target %#v claims to be %#v", u.String(), o.ID)
+		return nil, interactionNotFound
+	}
+
+	if util.IsActorType(o.Type) {
+		a, err := s.remoteActors.FetchActor(ctx, o.ID)
+		if err != nil {
+			log.Printf("Could not fetch actor %#v: %v", o.ID, err)
+			return nil, interactionNotFound
+		}
+		return &interactionTarget{Handle: remoteHandle(a)}, nil
+	}
+
+	switch strings.ToLower(o.Type) {
+	case "article", "note":
+	default:
+		log.Printf("Cannot interact with %#v of type %#v", o.ID, o.Type)
+		return nil, interactionNotFound
+	}
+	author, err := s.remoteActors.FetchActor(ctx, o.AttributedTo)
+	if err != nil {
+		log.Printf("Could not fetch author %#v of %#v: %v", o.AttributedTo, o.ID, err)
+		return nil, interactionNotFound
+	}
+	t := &interactionTarget{Handle: remoteHandle(author)}
+
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{ApId: o.ID},
+	})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not find post %s: %s", o.ID, resp.Error)
+	}
+	if len(resp.Results) > 0 {
+		t.ArticleID = resp.Results[0].GlobalId
+	}
+	return t, nil
+}
+
+// resolveInteraction finds what a pasted URI refers to. It may be an account,
+// as in "acct:alice@remote.host", "@alice@remote.host" or "alice", or the URL
+// of a profile or post here or on another server.
+func (s *serverWrapper) resolveInteraction(ctx context.Context, uri string) (*interactionTarget, error) {
+	uri = strings.TrimPrefix(strings.TrimSpace(uri), "acct:")
+	if !strings.Contains(uri, "://") {
+		handle, host, err := util.ParseUsername(uri)
+		if err != nil {
+			return nil, interactionNotFound
+		}
+		if host == "" || s.isLocalHost(host) {
+			return &interactionTarget{Handle: handle}, nil
+		}
+		if s.blacklist.blocked(host) {
+			return nil, interactionBlocked
+		}
+		if _, err := s.remoteActors.Resolve(ctx, handle, host); err != nil {
+			log.Printf("Could not resolve %#v: %v", uri, err)
+			return nil, interactionNotFound
+		}
+		return &interactionTarget{Handle: handle + "@" + host}, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return nil, interactionNotFound
+	}
+	if s.isLocalHost(u.Host) {
+		return parseLocalInteraction(u)
+	}
+	if s.blacklist.blocked(u.Host) {
+		return nil, interactionBlocked
+	}
+	return s.resolveRemoteInteraction(ctx, u)
+}
+
+// handleAuthorizeInteraction is where other servers send users who want to
+// follow someone from here, see the OStatus subscribe link in webfinger.
+// The logged in user is shown the profile or post in the web app, from which
+// they can follow, like or announce it.
+func (s *serverWrapper) handleAuthorizeInteraction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uri := r.URL.Query().Get("uri")
+		if uri == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "No uri given to interact with.\n")
+			return
+		}
+		if _, err := s.getSessionHandle(r); err != nil {
+			// The login page sends the user back here with the uri.
+			http.Redirect(w, r, "/#/login?uri="+url.QueryEscape(uri), http.StatusSeeOther)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		t, err := s.resolveInteraction(ctx, uri)
+		if err == interactionNotFound || err == interactionBlocked {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Could not interact with %s: %v.\n", uri, err)
+			return
+		} else if err != nil {
+			log.Printf("Could not resolve interaction with %#v: %v", uri, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Could not interact with %s.\n", uri)
+			return
+		}
+		// Posts we don't have can't be interacted with, so the user is
+		// shown their author to follow instead.
+		http.Redirect(w, r, "/#"+t.route(), http.StatusSeeOther)
+	}
+}
+
+// handleInteract lets the logged in user follow, like or announce a pasted
+// profile or post URI. Once it is resolved, the request is passed on to the
+// usual handler for the interaction.
+func (s *serverWrapper) handleInteract() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var t interactionStruct
+		var cResp clientResp
+		enc := json.NewEncoder(w)
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			cResp.Error = invalidJSONError
+			enc.Encode(cResp)
+			return
+		}
+
+		if _, err := s.getSessionHandle(r); err != nil {
+			log.Printf("Interact call from user not logged in")
+			w.WriteHeader(http.StatusForbidden)
+			cResp.Error = loginRequired
+			enc.Encode(cResp)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		target, err := s.resolveInteraction(ctx, t.URI)
+		if err == interactionNotFound || err == interactionBlocked {
+			w.WriteHeader(http.StatusNotFound)
+			cResp.Error = err.Error()
+			enc.Encode(cResp)
+			return
+		} else if err != nil {
+			log.Printf("Could not resolve interaction with %#v: %v", t.URI, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			cResp.Error = "Issue with finding what to interact with"
+			enc.Encode(cResp)
+			return
+		}
+
+		var req interface{}
+		var h http.HandlerFunc
+		switch t.Type {
+		case "follow":
+			req = &pb.LocalToAnyFollow{Followed: target.Handle}
+			h = s.handleFollow()
+		case "like":
+			req = &likeStruct{ArticleID: target.ArticleID, IsLiked: true}
+			h = s.handleLike()
+		case "announce":
+			req = &pb.AnnounceDetails{ArticleId: target.ArticleID}
+			h = s.handleAnnounce()
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			cResp.Error = "Unknown interaction type"
+			enc.Encode(cResp)
+			return
+		}
+		if t.Type != "follow" && target.ArticleID == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			cResp.Error = "We don't have that post, follow its author to see it"
+			cResp.Message = target.Handle
+			enc.Encode(cResp)
+			return
+		}
+
+		body, err := json.Marshal(req)
+		if err != nil {
+			log.Printf("Could not marshal %s request: %v", t.Type, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			cResp.Error = "Issue with interacting"
+			enc.Encode(cResp)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h(w, r)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+const testRemotePost = "http://remote.test/notes/1"
+
+// fakeInteractionFetcher serves the remote sender's actor and posts, of
+// which we only have testRemotePost.
+func fakeInteractionFetcher(_ context.Context, id string, v interface{}) error {
+	switch id {
+	case testKeyOwner:
+		return json.Unmarshal([]byte(`{"id": "`+testKeyOwner+`", "type": "Person"}`), v)
+	case testRemotePost, "http://remote.test/notes/2":
+		return json.Unmarshal([]byte(`{
+			"id": "`+id+`",
+			"type": "Note",
+			"attributedTo": {"id": "`+testKeyOwner+`", "type": "Person"}
+		}`), v)
+	case "http://remote.test/notes/liar":
+		return json.Unmarshal([]byte(`{"id": "http://other.test/notes/1", "type": "Note"}`), v)
+	}
+	return errors.New("not found")
+}
+
+type interactionLikeFake struct {
+	pb.S2SLikeClient
+
+	rq *pb.LikeDetails
+}
+
+func (l *interactionLikeFake) SendLikeActivity(_ context.Context, r *pb.LikeDetails, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	l.rq = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func newInteractionTestServer() *serverWrapper {
+	srv := newTestServerWrapper()
+	srv.fetchObject = fakeInteractionFetcher
+	srv.database = &MemoryDatabaseFake{
+		posts: []*pb.PostsEntry{{GlobalId: 5, ApId: testRemotePost}},
+	}
+	return srv
+}
+
+func TestResolveInteraction(t *testing.T) {
+	srv := newInteractionTestServer()
+	for _, tc := range []struct {
+		uri  string
+		want *interactionTarget
+		err  error
+	}{
+		{"acct:sender@remote.test", &interactionTarget{Handle: "sender@remote.test"}, nil},
+		{"@jose", &interactionTarget{Handle: "jose"}, nil},
+		{"nobody@remote.test", nil, interactionNotFound},
+		{"http://SKINNYTESTS:191/#/@alice", &interactionTarget{Handle: "alice"}, nil},
+		{"http://SKINNYTESTS:191/ap/@alice/10", &interactionTarget{Handle: "alice", ArticleID: 10}, nil},
+		{testKeyOwner, &interactionTarget{Handle: "sender@remote.test"}, nil},
+		{testRemotePost, &interactionTarget{Handle: "sender@remote.test", ArticleID: 5}, nil},
+		{"http://remote.test/notes/2", &interactionTarget{Handle: "sender@remote.test"}, nil},
+		{"http://remote.test/notes/liar", nil, interactionNotFound},
+	} {
+		got, err := srv.resolveInteraction(context.Background(), tc.uri)
+		if err != tc.err {
+			t.Errorf("%s: expected error %v, got %v", tc.uri, tc.err, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %#v, got %#v", tc.uri, tc.want, got)
+		}
+	}
+}
+
+func TestHandleAuthorizeInteraction(t *testing.T) {
+	srv := newInteractionTestServer()
+	for _, tc := range []struct {
+		uri      string
+		loggedIn bool
+		location string
+	}{
+		{testRemotePost, false, "/#/login?uri=http%3A%2F%2Fremote.test%2Fnotes%2F1"},
+		{testRemotePost, true, "/#/@sender@remote.test/5"},
+		// Posts we don't have lead to their author.
+		{"http://remote.test/notes/2", true, "/#/@sender@remote.test"},
+	} {
+		req, _ := http.NewRequest("GET", "/authorize_interaction?uri="+url.QueryEscape(tc.uri), nil)
+		res := httptest.NewRecorder()
+		if tc.loggedIn {
+			addFakeSession(srv, res, req)
+		}
+		srv.handleAuthorizeInteraction()(res, req)
+		if res.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected 303 See Other, got %#v", tc.uri, res.Code)
+		} else if l := res.Header().Get("Location"); l != tc.location {
+			t.Errorf("%s: expected redirect to %#v, got %#v", tc.uri, tc.location, l)
+		}
+	}
+}
+
+func TestHandleInteract(t *testing.T) {
+	srv := newInteractionTestServer()
+	like := &interactionLikeFake{}
+	srv.s2sLike = like
+	interact := func(body string) int {
+		req, _ := http.NewRequest("POST", "/c2s/authorize_interaction", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		srv.handleInteract()(res, req)
+		return res.Code
+	}
+
+	if code := interact(`{"uri": "` + testRemotePost + `", "type": "like"}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	want := &pb.LikeDetails{ArticleId: 5, LikerHandle: "jose"}
+	if !reflect.DeepEqual(like.rq, want) {
+		t.Errorf("Expected like %v, got %v", want, like.rq)
+	}
+
+	if code := interact(`{"uri": "http://remote.test/notes/2", "type": "like"}`); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found liking a post we don't have, got %#v", code)
+	}
+
+	if code := interact(`{"uri": "` + testRemotePost + `", "type": "follow"}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	follows := srv.follows.(*FollowsFake)
+	if follows.rq == nil || follows.rq.Followed != "sender@remote.test" || follows.rq.Follower != "jose" {
+		t.Errorf("Expected jose to follow the author of the post, got %v", follows.rq)
+	}
+}
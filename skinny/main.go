@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -16,6 +17,15 @@ import (
 	"google.golang.org/grpc"
 )
 
+// actorResolver finds foreign actors, by webfinger handle or by actor id.
+// It is implemented by utils.ActorResolver.
+type actorResolver interface {
+	FetchActor(ctx context.Context, id string) (*utils.RemoteActor, error)
+	Resolve(ctx context.Context, handle, host string) (*utils.RemoteActor, error)
+	// Forget drops a cached actor, returning it if it was cached.
+	Forget(id string) *utils.RemoteActor
+}
+
 // serverWrapper encapsulates the dependencies and config values of the server
 // into one struct. Server endpoint handlers hang off of this struct and can
 // access their dependencies through it. See
@@ -47,8 +57,39 @@ type serverWrapper struct {
 	// database is the RPC client for talking to the database service.
 	database pb.DatabaseClient
 
-	// blacklist is a set of strings of hosts, that the instance has blocked.
-	blacklist Blacklist
+	// blacklist holds the hosts that the instance has blocked, or in
+	// allowlist mode the only hosts it federates with.
+	blacklist *Blacklist
+
+	// admins is the set of local handles allowed to use the admin endpoints.
+	// Set by ADMIN_USERS.
+	admins map[string]bool
+
+	// sigVerifier checks the HTTP Signatures of activities sent to inboxes.
+	sigVerifier *signatureVerifier
+
+	// webfingerDecoys enables fake webfinger responses for unknown users, so
+	// that webfinger can't be used to enumerate users. Set by WEBFINGER_DECOYS.
+	webfingerDecoys bool
+
+	// decoyKey is the secret webfinger decoys are derived with. It is kept
+	// in WEBFINGER_DECOY_KEY_FILE, so decoys look the same across restarts.
+	decoyKey []byte
+
+	// remoteActors looks up foreign actors by handle or id.
+	remoteActors actorResolver
+
+	// fetchObject dereferences objects which activities only give the IRI
+	// of. See normalise.go.
+	fetchObject objectFetcher
+
+	// seenActivities remembers the ids of activities delivered to inboxes,
+	// so duplicate deliveries are ignored.
+	seenActivities *activityDedup
+
+	// inboxQueue holds activities delivered to inboxes until they are
+	// handled. If it is nil, activities are handled during the request.
+	inboxQueue *inboxQueue
 
 	followsConn               *grpc.ClientConn
 	follows                   pb.FollowsClient
@@ -70,6 +111,10 @@ type serverWrapper struct {
 	s2sUpdate                 pb.S2SUpdateClient
 	s2sDeleteConn             *grpc.ClientConn
 	s2sDelete                 pb.S2SDeleteClient
+	s2sFlagConn               *grpc.ClientConn
+	s2sFlag                   pb.S2SFlagClient
+	s2sMoveConn               *grpc.ClientConn
+	s2sMove                   pb.S2SMoveClient
 	announceConn              *grpc.ClientConn
 	announce                  pb.AnnounceClient
 	approverConn              *grpc.ClientConn
@@ -94,6 +139,10 @@ func (s *serverWrapper) shutdown() {
 	defer cancel()
 	// Waits for active connections to terminate, or until it hits the timeout.
 	s.server.Shutdown(ctx)
+	if s.inboxQueue != nil {
+		s.inboxQueue.Stop()
+	}
+	s.seenActivities.Close()
 
 	s.databaseConn.Close()
 	s.articleConn.Close()
@@ -104,6 +153,8 @@ func (s *serverWrapper) shutdown() {
 	s.s2sUndoConn.Close()
 	s.s2sUpdateConn.Close()
 	s.s2sDeleteConn.Close()
+	s.s2sFlagConn.Close()
+	s.s2sMoveConn.Close()
 	s.s2sFollowConn.Close()
 	s.s2sLikeConn.Close()
 	s.rssConn.Close()
@@ -176,6 +227,16 @@ func createS2SDeleteClient() (*grpc.ClientConn, pb.S2SDeleteClient) {
 	return conn, pb.NewS2SDeleteClient(conn)
 }
 
+func createS2SFlagClient() (*grpc.ClientConn, pb.S2SFlagClient) {
+	conn := utils.GrpcConn("FLAG_SERVICE_HOST", "2051")
+	return conn, pb.NewS2SFlagClient(conn)
+}
+
+func createS2SMoveClient() (*grpc.ClientConn, pb.S2SMoveClient) {
+	conn := utils.GrpcConn("MOVE_SERVICE_HOST", "2058")
+	return conn, pb.NewS2SMoveClient(conn)
+}
+
 func createRSSClient() (*grpc.ClientConn, pb.RSSClient) {
 	conn := utils.GrpcConn("RSS_SERVICE_HOST", "1973")
 	return conn, pb.NewRSSClient(conn)
@@ -235,7 +296,14 @@ func buildServerWrapper() *serverWrapper {
 		Handler:      r,
 	}
 
-	generatedBlacklist := NewBlacklist(loadBlacklistFile())
+	generatedBlacklist, err := loadFederationPolicy(hostname)
+	if err != nil {
+		log.Fatalf("error reading blacklist file: %v", err)
+	}
+
+	// Development instances federate with each other on a private network.
+	remoteClient := utils.NewRemoteHTTPClient(os.Getenv("ALLOW_PRIVATE_FETCHES") == "true")
+	fetchObject := newActivityFetcher(remoteClient)
 
 	cookieStore := sessions.NewCookieStore([]byte("rabble_key"))
 	databaseConn, databaseClient := createDatabaseClient()
@@ -249,6 +317,8 @@ func buildServerWrapper() *serverWrapper {
 	s2sUndoConn, s2sUndoClient := createS2SUndoClient()
 	s2sUpdateConn, s2sUpdateClient := createS2SUpdateClient()
 	s2sDeleteConn, s2sDeleteClient := createS2SDeleteClient()
+	s2sFlagConn, s2sFlagClient := createS2SFlagClient()
+	s2sMoveConn, s2sMoveClient := createS2SMoveClient()
 	s2sFollowConn, s2sFollowClient := createS2SFollowClient()
 	s2sLikeConn, s2sLikeClient := createS2SLikeClient()
 	approverConn, approverClient := createApproverClient()
@@ -258,6 +328,16 @@ func buildServerWrapper() *serverWrapper {
 	searchConn, searchClient := createSearchClient()
 	announceConn, announceClient := createAnnounceClient()
 	postRecommendationsConn, postRecommendationsClient := createPostRecommendationsClient()
+
+	webfingerDecoys := os.Getenv("WEBFINGER_DECOYS") == "true"
+	var decoyKey []byte
+	if webfingerDecoys {
+		var err error
+		decoyKey, err = loadDecoyKey(os.Getenv("WEBFINGER_DECOY_KEY_FILE"))
+		if err != nil {
+			log.Fatalf("error loading webfinger decoy key: %v", err)
+		}
+	}
 	s := &serverWrapper{
 		router:                    r,
 		server:                    srv,
@@ -265,6 +345,12 @@ func buildServerWrapper() *serverWrapper {
 		shutdownWait:              20 * time.Second,
 		hostname:                  hostname,
 		blacklist:                 generatedBlacklist,
+		admins:                    parseAdmins(os.Getenv("ADMIN_USERS")),
+		sigVerifier:               newSignatureVerifier(newPublicKeyFetcher(fetchObject)),
+		fetchObject:               fetchObject,
+		remoteActors:              utils.NewActorResolver(remoteClient, utils.DefaultActorCacheTTL),
+		webfingerDecoys:           webfingerDecoys,
+		decoyKey:                  decoyKey,
 		databaseConn:              databaseConn,
 		database:                  databaseClient,
 		articleConn:               articleConn,
@@ -283,6 +369,10 @@ func buildServerWrapper() *serverWrapper {
 		s2sUpdate:                 s2sUpdateClient,
 		s2sDeleteConn:             s2sDeleteConn,
 		s2sDelete:                 s2sDeleteClient,
+		s2sFlagConn:               s2sFlagConn,
+		s2sFlag:                   s2sFlagClient,
+		s2sMoveConn:               s2sMoveConn,
+		s2sMove:                   s2sMoveClient,
 		s2sFollowConn:             s2sFollowConn,
 		s2sFollow:                 s2sFollowClient,
 		s2sLikeConn:               s2sLikeConn,
@@ -305,6 +395,29 @@ func buildServerWrapper() *serverWrapper {
 		postRecommendations:       postRecommendationsClient,
 	}
 	s.setupRoutes()
+
+	// SEEN_ACTIVITIES_FILE keeps the ids across restarts. If it isn't set
+	// they are only kept in memory.
+	seen, err := newActivityDedup(os.Getenv("SEEN_ACTIVITIES_FILE"),
+		seenActivitiesTTL, seenActivitiesMax)
+	if err != nil {
+		log.Fatalf("error loading seen activities: %v", err)
+	}
+	s.seenActivities = seen
+
+	if dir := os.Getenv("INBOX_QUEUE_DIR"); dir != "" {
+		workers := defaultInboxWorkers
+		if n, err := strconv.Atoi(os.Getenv("INBOX_WORKERS")); err == nil && n > 0 {
+			workers = n
+		}
+		q, err := newInboxQueue(dir, workers, s.processInboxJob)
+		if err != nil {
+			log.Fatalf("error creating inbox queue: %v", err)
+		}
+		s.inboxQueue = q
+	} else {
+		log.Printf("INBOX_QUEUE_DIR not set, handling inbox activities synchronously")
+	}
 	return s
 }
 
@@ -318,6 +431,14 @@ func main() {
 	// (Ctrl+C) or SIGTERM (kill) is received.
 	// See also: https://gobyexample.com/signals
 
+	go s.blacklist.Watch(blacklistPollInterval)
+
+	if s.inboxQueue != nil {
+		if err := s.inboxQueue.Start(); err != nil {
+			log.Fatalf("error starting inbox queue: %v", err)
+		}
+	}
+
 	go func() {
 		if err := s.server.ListenAndServe(); err != nil {
 			log.Println(err)
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,6 +53,18 @@ func (f *FollowsFake) RssFollowRequest(_ context.Context, r *pb.LocalToRss, _ ..
 	}, nil
 }
 
+type SearchFake struct {
+	pb.SearchClient
+
+	// The ids of all posts removed from the index.
+	removed []int64
+}
+
+func (f *SearchFake) Remove(_ context.Context, r *pb.RemoveRequest, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	f.removed = append(f.removed, r.GlobalIds...)
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
 type ArticleFake struct {
 	pb.ArticleClient
 
@@ -82,6 +95,261 @@ func (d *DatabaseFake) Posts(_ context.Context, r *pb.PostsRequest, _ ...grpc.Ca
 	}, nil
 }
 
+// ArticleMentions finds no mentions, as most tests don't need them.
+func (d *DatabaseFake) ArticleMentions(_ context.Context, r *pb.MentionsEntry, _ ...grpc.CallOption) (*pb.MentionsResponse, error) {
+	return &pb.MentionsResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+// MemoryDatabaseFake keeps the rows tests set up in memory and answers the
+// database requests made on them. A field of a FIND request matches anything
+// when it is left unset, except that users are found by handle and host
+// together.
+type MemoryDatabaseFake struct {
+	pb.DatabaseClient
+
+	users   []*pb.UsersEntry
+	posts   []*pb.PostsEntry
+	follows []*pb.Follow
+	shares  []*pb.SharesEntry
+	reports []*pb.ReportEntry
+	// blocks holds the blocker and blocked id of each block.
+	blocks  map[[2]int64]bool
+	aliases map[int64][]string
+	movedTo map[int64]string
+	// mentions maps article ids to the users mentioned in them.
+	mentions   map[int64][]int64
+	tombstoned []int64
+
+	// failDeletes makes removing follows fail.
+	failDeletes bool
+}
+
+func (d *MemoryDatabaseFake) Users(_ context.Context, r *pb.UsersRequest, _ ...grpc.CallOption) (*pb.UsersResponse, error) {
+	resp := &pb.UsersResponse{ResultType: pb.ResultType_OK}
+	switch r.RequestType {
+	case pb.RequestType_INSERT:
+		u := &pb.UsersEntry{
+			GlobalId: int64(len(d.users) + 1),
+			Handle:   r.Entry.Handle,
+			Host:     r.Entry.Host,
+		}
+		d.users = append(d.users, u)
+		resp.GlobalId = u.GlobalId
+	case pb.RequestType_UPDATE:
+		for _, u := range d.users {
+			if u.GlobalId == r.Match.GlobalId {
+				u.Handle = r.Entry.Handle
+				u.DisplayName = r.Entry.DisplayName
+				u.Bio = r.Entry.Bio
+			}
+		}
+	case pb.RequestType_FIND:
+		m := r.Match
+		for _, u := range d.users {
+			if (m.GlobalId == 0 || m.GlobalId == u.GlobalId) &&
+				(m.Handle == "" || (m.Handle == u.Handle && m.Host == u.Host)) {
+				resp.Results = append(resp.Results, u)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) Posts(_ context.Context, r *pb.PostsRequest, _ ...grpc.CallOption) (*pb.PostsResponse, error) {
+	resp := &pb.PostsResponse{ResultType: pb.ResultType_OK}
+	m := r.Match
+	for _, p := range d.posts {
+		if (m.GlobalId == 0 || m.GlobalId == p.GlobalId) &&
+			(m.AuthorId == 0 || m.AuthorId == p.AuthorId) &&
+			(m.InReplyTo == 0 || m.InReplyTo == p.InReplyTo) &&
+			(m.ApId == "" || m.ApId == p.ApId) {
+			resp.Results = append(resp.Results, p)
+		}
+	}
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) Follow(_ context.Context, r *pb.DbFollowRequest, _ ...grpc.CallOption) (*pb.DbFollowResponse, error) {
+	resp := &pb.DbFollowResponse{ResultType: pb.ResultType_OK}
+	if d.failDeletes && r.RequestType == pb.RequestType_DELETE {
+		return &pb.DbFollowResponse{ResultType: pb.ResultType_ERROR, Error: "read only"}, nil
+	}
+	var kept []*pb.Follow
+	for _, f := range d.follows {
+		match := (r.Match.Followed == 0 || f.Followed == r.Match.Followed) &&
+			(r.Match.Follower == 0 || f.Follower == r.Match.Follower)
+		if match && r.RequestType == pb.RequestType_FIND {
+			resp.Results = append(resp.Results, f)
+		}
+		if !match || r.RequestType != pb.RequestType_DELETE {
+			kept = append(kept, f)
+		}
+	}
+	d.follows = kept
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) SharedPosts(_ context.Context, r *pb.SharedPostsRequest, _ ...grpc.CallOption) (*pb.SharesResponse, error) {
+	return &pb.SharesResponse{ResultType: pb.ResultType_OK, Results: d.shares}, nil
+}
+
+// LocalUsage counts the local users and the posts they wrote.
+func (d *MemoryDatabaseFake) LocalUsage(_ context.Context, r *pb.LocalUsageRequest, _ ...grpc.CallOption) (*pb.LocalUsageResponse, error) {
+	resp := &pb.LocalUsageResponse{ResultType: pb.ResultType_OK}
+	local := map[int64]bool{}
+	for _, u := range d.users {
+		if u.Host == "" {
+			local[u.GlobalId] = true
+			resp.Users++
+		}
+	}
+	for _, p := range d.posts {
+		if local[p.AuthorId] {
+			resp.Posts++
+		}
+	}
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) TombstoneUser(_ context.Context, r *pb.TombstoneUserRequest, _ ...grpc.CallOption) (*pb.TombstoneUserResponse, error) {
+	d.tombstoned = append(d.tombstoned, r.GlobalId)
+	resp := &pb.TombstoneUserResponse{ResultType: pb.ResultType_OK}
+	posts := []*pb.PostsEntry{}
+	for _, p := range d.posts {
+		if p.AuthorId == r.GlobalId {
+			resp.PostIds = append(resp.PostIds, p.GlobalId)
+		} else {
+			posts = append(posts, p)
+		}
+	}
+	d.posts = posts
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) AddBlock(_ context.Context, r *pb.BlockEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	if d.blocks == nil {
+		d.blocks = map[[2]int64]bool{}
+	}
+	d.blocks[[2]int64{r.Blocker, r.Blocked}] = true
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func (d *MemoryDatabaseFake) RemoveBlock(_ context.Context, r *pb.BlockEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	delete(d.blocks, [2]int64{r.Blocker, r.Blocked})
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func (d *MemoryDatabaseFake) setPin(r *pb.PinEntry, pinned bool) (*pb.GeneralResponse, error) {
+	for _, p := range d.posts {
+		if p.GlobalId == r.ArticleId && p.AuthorId == r.UserId {
+			p.Pinned = pinned
+			return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+		}
+	}
+	return &pb.GeneralResponse{ResultType: pb.ResultType_ERROR_400}, nil
+}
+
+func (d *MemoryDatabaseFake) AddPin(_ context.Context, r *pb.PinEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	return d.setPin(r, true)
+}
+
+func (d *MemoryDatabaseFake) RemovePin(_ context.Context, r *pb.PinEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	return d.setPin(r, false)
+}
+
+func (d *MemoryDatabaseFake) Aliases(_ context.Context, r *pb.AliasEntry, _ ...grpc.CallOption) (*pb.AliasesResponse, error) {
+	return &pb.AliasesResponse{
+		ResultType: pb.ResultType_OK,
+		Aliases:    d.aliases[r.UserId],
+		MovedTo:    d.movedTo[r.UserId],
+	}, nil
+}
+
+func (d *MemoryDatabaseFake) AddAlias(_ context.Context, r *pb.AliasEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	if d.aliases == nil {
+		d.aliases = map[int64][]string{}
+	}
+	d.aliases[r.UserId] = append(d.aliases[r.UserId], r.Alias)
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func (d *MemoryDatabaseFake) RemoveAlias(_ context.Context, r *pb.AliasEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	var kept []string
+	for _, a := range d.aliases[r.UserId] {
+		if a != r.Alias {
+			kept = append(kept, a)
+		}
+	}
+	if d.aliases != nil {
+		d.aliases[r.UserId] = kept
+	}
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func (d *MemoryDatabaseFake) SetMovedTo(_ context.Context, r *pb.AliasEntry, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	if d.movedTo == nil {
+		d.movedTo = map[int64]string{}
+	}
+	d.movedTo[r.UserId] = r.Alias
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func (d *MemoryDatabaseFake) ArticleMentions(_ context.Context, r *pb.MentionsEntry, _ ...grpc.CallOption) (*pb.MentionsResponse, error) {
+	resp := &pb.MentionsResponse{
+		ResultType: pb.ResultType_OK,
+		UserIds:    d.mentions[r.ArticleId],
+	}
+	for _, id := range resp.UserIds {
+		for _, u := range d.users {
+			if u.GlobalId == id {
+				resp.Users = append(resp.Users, u)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) UserMentions(_ context.Context, r *pb.UserMentionsRequest, _ ...grpc.CallOption) (*pb.PostsResponse, error) {
+	resp := &pb.PostsResponse{ResultType: pb.ResultType_OK}
+	for _, p := range d.posts {
+		for _, id := range d.mentions[p.GlobalId] {
+			if id == r.UserId {
+				resp.Results = append(resp.Results, p)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (d *MemoryDatabaseFake) Reports(_ context.Context, r *pb.ReportsRequest, _ ...grpc.CallOption) (*pb.ReportsResponse, error) {
+	resp := &pb.ReportsResponse{ResultType: pb.ResultType_OK}
+	switch r.RequestType {
+	case pb.RequestType_INSERT:
+		e := &pb.ReportEntry{
+			GlobalId:         int64(len(d.reports) + 1),
+			Reporter:         r.Entry.Reporter,
+			Objects:          r.Entry.Objects,
+			Comment:          r.Entry.Comment,
+			CreationDatetime: r.Entry.CreationDatetime,
+			ApId:             r.Entry.ApId,
+		}
+		d.reports = append(d.reports, e)
+		resp.GlobalId = e.GlobalId
+	case pb.RequestType_FIND:
+		for i := len(d.reports) - 1; i >= 0; i-- {
+			resp.Results = append(resp.Results, d.reports[i])
+		}
+	case pb.RequestType_UPDATE:
+		if r.Match.GlobalId < 1 || r.Match.GlobalId > int64(len(d.reports)) {
+			resp.ResultType = pb.ResultType_ERROR_400
+			resp.Error = "No such report"
+			break
+		}
+		d.reports[r.Match.GlobalId-1].State = r.Entry.State
+	}
+	return resp, nil
+}
+
 func (f *FollowsFake) SendFollowRequest(_ context.Context, r *pb.LocalToAnyFollow, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
 	f.rq = r
 	return &pb.GeneralResponse{
@@ -114,9 +382,13 @@ func newTestServerWrapper() *serverWrapper {
 		article:      &ArticleFake{},
 		feed:         &FeedFake{},
 		follows:      &FollowsFake{},
+		search:       &SearchFake{},
 		s2sLike:      &LikeFake{},
 		ldNorm:       &LDNormFake{},
 		hostname:     "SKINNYTESTS:191",
+		sigVerifier:  newSignatureVerifier(fakeKeyFetcher),
+		blacklist:    NewBlacklist(strings.NewReader("")),
+		remoteActors: &fakeActorResolver{},
 	}
 	s.setupRoutes()
 	return s
@@ -198,6 +470,59 @@ func TestHandleFollowNotLoggedIn(t *testing.T) {
 	}
 }
 
+func TestHandleFollowForeignUser(t *testing.T) {
+	tests := []struct {
+		followed string
+		code     int
+	}{
+		{"sender@remote.test", http.StatusOK},
+		{"nobody@remote.test", http.StatusNotFound},
+	}
+	for _, tcase := range tests {
+		jsonString := `{ "followed": "` + tcase.followed + `" }`
+		req, _ := http.NewRequest("GET", "/c2s/follow", bytes.NewBufferString(jsonString))
+		res := httptest.NewRecorder()
+		srv := newTestServerWrapper()
+
+		addFakeSession(srv, res, req)
+		srv.handleFollow()(res, req)
+		if res.Code != tcase.code {
+			t.Errorf("Following %#v: expected %d, got %d", tcase.followed, tcase.code, res.Code)
+		}
+		rq := srv.follows.(*FollowsFake).rq
+		if sent := rq != nil; sent != (tcase.code == http.StatusOK) {
+			t.Errorf("Following %#v: expected follow to be sent only on success", tcase.followed)
+		}
+	}
+}
+
+func TestHandleFollowBlockedInstance(t *testing.T) {
+	allowlist := NewBlacklist(strings.NewReader("friend.test\n"))
+	allowlist.allowlist = true
+	tests := []struct {
+		blacklist *Blacklist
+		followed  string
+		code      int
+	}{
+		{NewBlacklist(strings.NewReader("remote.test\n")), "sender@remote.test", http.StatusForbidden},
+		{allowlist, "sender@remote.test", http.StatusForbidden},
+		{allowlist, "jose", http.StatusOK},
+	}
+	for _, tcase := range tests {
+		jsonString := `{ "followed": "` + tcase.followed + `" }`
+		req, _ := http.NewRequest("GET", "/c2s/follow", bytes.NewBufferString(jsonString))
+		res := httptest.NewRecorder()
+		srv := newTestServerWrapper()
+		srv.blacklist = tcase.blacklist
+
+		addFakeSession(srv, res, req)
+		srv.handleFollow()(res, req)
+		if res.Code != tcase.code {
+			t.Errorf("Following %#v: expected %d, got %d", tcase.followed, tcase.code, res.Code)
+		}
+	}
+}
+
 func TestHandleRssFollow(t *testing.T) {
 	jsonString := `{ "follower": "testuser", "feed_url": "jose" }`
 	jsonBuffer := bytes.NewBuffer([]byte(jsonString))
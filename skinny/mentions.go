@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+// mentionName is how a user is named in a Mention tag, "@alice@host".
+func (s *serverWrapper) mentionName(u *pb.UsersEntry) string {
+	host := u.Host
+	if host == "" {
+		host = s.hostname
+	}
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+len("://"):]
+	}
+	return "@" + u.Handle + "@" + host
+}
+
+// mentionTags builds the Mention tags of the users mentioned in a post.
+// Users whose actor can't be found are skipped.
+func (s *serverWrapper) mentionTags(ctx context.Context, globalID int64) ([]ArticleTagStruct, error) {
+	resp, err := s.database.ArticleMentions(ctx, &pb.MentionsEntry{ArticleId: globalID})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get mentions: %s", resp.Error)
+	}
+
+	// The mentioned users come with the response, so only the ids of foreign
+	// actors need resolving, and those are cached.
+	tags := []ArticleTagStruct{}
+	for _, u := range resp.Users {
+		actor, err := s.actorIDOf(ctx, u)
+		if err != nil {
+			log.Printf("Could not get actor of user %d mentioned in %d: %v", u.GlobalId, globalID, err)
+			continue
+		}
+		tags = append(tags, ArticleTagStruct{
+			Type: "Mention",
+			Href: actor,
+			Name: s.mentionName(u),
+		})
+	}
+	return tags, nil
+}
+
+// localMentions returns the handles of the local users mentioned in the tags
+// of a foreign post, so that they can be notified.
+func (s *serverWrapper) localMentions(tags []ArticleTagStruct) []string {
+	handles := []string{}
+	for _, t := range tags {
+		if t.Type != "Mention" {
+			continue
+		}
+		u, err := url.Parse(t.Href)
+		if err != nil || !s.isLocalHost(u.Host) {
+			continue
+		}
+		target, err := parseLocalInteraction(u)
+		if err != nil || target.ArticleID != 0 {
+			continue
+		}
+		handles = append(handles, target.Handle)
+	}
+	return handles
+}
+
+// handleMentions returns the most recent posts mentioning the logged in user.
+func (s *serverWrapper) handleMentions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Mentions call from user not logged in")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.database.UserMentions(ctx, &pb.UserMentionsRequest{UserId: globalID})
+		if err != nil {
+			log.Printf("Could not get mentions of %d: %v", globalID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not get mentions of %d: %s", globalID, resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		fr := &pb.FeedResponse{Results: util.ConvertDBToFeed(ctx, resp, s.database)}
+		if err := enc.Encode(fr); err != nil {
+			log.Printf("could not marshal mentions: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+type createFake struct {
+	pb.CreateClient
+
+	nfa *pb.NewForeignArticle
+}
+
+func (c *createFake) ReceiveCreate(_ context.Context, r *pb.NewForeignArticle, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	c.nfa = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+// newMentionsTestServer sets up a server where alice's article 10 mentions
+// bob and the remote sender.
+func newMentionsTestServer() *serverWrapper {
+	srv := newTestServerWrapper()
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		posts: []*pb.PostsEntry{
+			{GlobalId: 10, AuthorId: 1, Title: "Hello", Body: "Hi @bob and @sender@remote.test"},
+		},
+		mentions: map[int64][]int64{10: {2, 3}},
+	}
+	return srv
+}
+
+func TestArticleMentions(t *testing.T) {
+	srv := newMentionsTestServer()
+	req, _ := http.NewRequest("GET", "/ap/@alice/10", nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "alice", "article_id": "10"})
+	res := httptest.NewRecorder()
+	srv.handleAPArticle()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var a ArticleContentStruct
+	json.Unmarshal(res.Body.Bytes(), &a)
+
+	wantTags := []ArticleTagStruct{
+		{Type: "Mention", Href: "http://SKINNYTESTS:191/ap/@bob", Name: "@bob@SKINNYTESTS:191"},
+		{Type: "Mention", Href: testKeyOwner, Name: "@sender@remote.test"},
+	}
+	if !reflect.DeepEqual(a.Tag, wantTags) {
+		t.Errorf("Expected tags %#v, got %#v", wantTags, a.Tag)
+	}
+	wantCc := []string{
+		"http://SKINNYTESTS:191/ap/@alice/followers",
+		"http://SKINNYTESTS:191/ap/@bob",
+		testKeyOwner,
+	}
+	if !reflect.DeepEqual(a.Cc, wantCc) {
+		t.Errorf("Expected cc %v, got %v", wantCc, a.Cc)
+	}
+}
+
+func TestLocalMentions(t *testing.T) {
+	srv := newTestServerWrapper()
+	tags := []ArticleTagStruct{
+		{Type: "Mention", Href: "http://SKINNYTESTS:191/ap/@alice", Name: "@alice"},
+		{Type: "Mention", Href: testKeyOwner, Name: "@sender@remote.test"},
+		{Type: "Hashtag", Href: "http://SKINNYTESTS:191/#/@bob", Name: "#bob"},
+		{Type: "Mention", Href: "http://SKINNYTESTS:191/#/@carol", Name: "@carol"},
+		{Type: "Mention", Href: "http://SKINNYTESTS:191/ap/@alice/10", Name: "@alice"},
+	}
+	want := []string{"alice", "carol"}
+	if got := srv.localMentions(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected mentions of %v, got %v", want, got)
+	}
+
+	// The hostname may be configured with its scheme.
+	srv.hostname = "http://SKINNYTESTS:191"
+	if got := srv.localMentions(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected mentions of %v with scheme in hostname, got %v", want, got)
+	}
+}
+
+func TestHandleCreateActivityMentions(t *testing.T) {
+	srv := newTestServerWrapper()
+	create := &createFake{}
+	srv.create = create
+	body := `{
+		"type": "Create",
+		"actor": "` + testKeyOwner + `",
+		"object": {
+			"type": "Note",
+			"id": "` + testRemotePost + `",
+			"attributedTo": "` + testKeyOwner + `",
+			"content": "hi @alice",
+			"published": "2019-01-01T00:00:00.000Z",
+			"tag": [{"type": "Mention", "href": "http://SKINNYTESTS:191/ap/@alice", "name": "@alice"}]
+		}
+	}`
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+	res := httptest.NewRecorder()
+	srv.handleCreateActivity()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	if want := []string{"alice"}; create.nfa == nil || !reflect.DeepEqual(create.nfa.Mentions, want) {
+		t.Errorf("Expected mentions of %v, got %v", want, create.nfa)
+	}
+}
+
+func TestHandleMentions(t *testing.T) {
+	srv := newMentionsTestServer()
+	req, _ := http.NewRequest("GET", "/c2s/mentions", nil)
+	res := httptest.NewRecorder()
+	srv.handleMentions()(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden when not logged in, got %#v", res.Code)
+	}
+
+	// The session of jose has global id 0, so mention him in article 10.
+	srv.database.(*MemoryDatabaseFake).mentions[10] = []int64{0}
+	res = httptest.NewRecorder()
+	addFakeSession(srv, res, req)
+	srv.handleMentions()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var fr pb.FeedResponse
+	json.Unmarshal(res.Body.Bytes(), &fr)
+	if len(fr.Results) != 1 || fr.Results[0].GlobalId != 10 {
+		t.Errorf("Expected article 10, got %v", fr.Results)
+	}
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	aliasNotFound   = "Could not find the account to alias"
+	moveNotAlias    = "The account to move to must list you as an alias first"
+	moveNotFound    = "Could not find the account to move to"
+	moveCheckFailed = "Could not check the account to move to"
+)
+
+const (
+	// repointTask is the inbox queue task moving the local followers of a
+	// user to the account they moved to.
+	repointTask = "repoint_followers"
+
+	// repointTimeout bounds how long moving the followers of a user takes.
+	repointTimeout = time.Minute
+)
+
+// errNotAlias is returned by moveTarget if the target of a move hasn't
+// agreed to it.
+var errNotAlias = errors.New("target does not list the account as an alias")
+
+type moveActivity struct {
+	ID     string `json:"id"`
+	Actor  string `json:"actor"`
+	Object string `json:"object"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+}
+
+// aliasesOf gets the aliases of a local user, and the account they moved
+// to, if any.
+func (s *serverWrapper) aliasesOf(ctx context.Context, globalID int64) (*pb.AliasesResponse, error) {
+	resp, err := s.database.Aliases(ctx, &pb.AliasEntry{UserId: globalID})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get aliases: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// moveTarget checks that the account target lists the account from as an
+// alias, as an account can only be moved to one which agreed to it. It
+// returns the username the target is followed by.
+func (s *serverWrapper) moveTarget(ctx context.Context, from, target string) (string, error) {
+	var name string
+	var aliases []string
+	if handle, local := s.localHandleFromActorID(target); local {
+		u, err := util.GetAuthorFromDb(ctx, handle, "", true, 0, s.database)
+		if err != nil {
+			return "", err
+		}
+		resp, err := s.aliasesOf(ctx, u.GlobalId)
+		if err != nil {
+			return "", err
+		}
+		name, aliases = handle, resp.Aliases
+	} else {
+		// The alias may have only just been added.
+		s.remoteActors.Forget(target)
+		a, err := s.remoteActors.FetchActor(ctx, target)
+		if err != nil {
+			return "", err
+		}
+		name, aliases = a.PreferredUsername+"@"+a.Host(), a.AlsoKnownAs
+	}
+	for _, a := range aliases {
+		if a == from {
+			return name, nil
+		}
+	}
+	return "", errNotAlias
+}
+
+type repointJob struct {
+	Followed int64  `json:"followed"`
+	Target   string `json:"target"`
+}
+
+// repointFollowersLater moves the local followers of a user to the account
+// they moved to in the background, as there may be many of them. It is
+// queued in the inbox queue if there is one, so that it is retried until
+// every follower is moved.
+func (s *serverWrapper) repointFollowersLater(globalID int64, target string) {
+	if s.inboxQueue != nil {
+		b, err := json.Marshal(&repointJob{Followed: globalID, Target: target})
+		if err == nil {
+			err = s.inboxQueue.EnqueueTask(repointTask, string(b))
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("Could not queue moving followers of %d: %v", globalID, err)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), repointTimeout)
+		defer cancel()
+		n, err := s.repointFollowers(ctx, globalID, target)
+		if err != nil {
+			log.Printf("Could not move all followers of %d to %#v: %v", globalID, target, err)
+		}
+		log.Printf("Moved %d followers of %d to %#v", n, globalID, target)
+	}()
+}
+
+// processRepointJob handles a queued repointTask. Followers which couldn't
+// be moved are tried again when the job is retried.
+func (s *serverWrapper) processRepointJob(j *inboxJob) (bool, error) {
+	var t repointJob
+	if err := json.Unmarshal([]byte(j.Body), &t); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), repointTimeout)
+	defer cancel()
+	n, err := s.repointFollowers(ctx, t.Followed, t.Target)
+	log.Printf("Moved %d followers of %d to %#v", n, t.Followed, t.Target)
+	return err != nil, err
+}
+
+// repointFollowers moves the local followers of a user to the account they
+// moved to, which is followed by the given username. Followers are only
+// counted as moved once they no longer follow the old account. The number
+// moved is returned, with an error if any of them couldn't be.
+func (s *serverWrapper) repointFollowers(ctx context.Context, globalID int64, target string) (int, error) {
+	resp, err := s.database.Follow(ctx, &pb.DbFollowRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.Follow{Followed: globalID},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not get followers of %d: %v", globalID, err)
+	} else if resp.ResultType != pb.ResultType_OK {
+		return 0, fmt.Errorf("could not get followers of %d: %s", globalID, resp.Error)
+	}
+
+	moved, failed := 0, 0
+	for _, f := range resp.Results {
+		u, err := util.GetAuthorFromDb(ctx, "", "", false, f.Follower, s.database)
+		if err != nil {
+			log.Printf("Could not get follower %d: %v", f.Follower, err)
+			failed++
+			continue
+		}
+		if u.Host != "" || u.Handle == target {
+			// Foreign followers are told of the move by their own instance.
+			continue
+		}
+
+		fResp, err := s.follows.SendFollowRequest(ctx, &pb.LocalToAnyFollow{
+			Follower: u.Handle,
+			Followed: target,
+			Datetime: ptypes.TimestampNow(),
+		})
+		if err != nil || fResp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", fResp.Error)
+			}
+			log.Printf("Could not move follow of %#v to %#v: %v", u.Handle, target, err)
+			failed++
+			continue
+		}
+
+		dResp, err := s.database.Follow(ctx, &pb.DbFollowRequest{
+			RequestType: pb.RequestType_DELETE,
+			Match:       &pb.Follow{Follower: f.Follower, Followed: globalID},
+		})
+		if err != nil || dResp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", dResp.Error)
+			}
+			log.Printf("Could not remove old follow of %#v: %v", u.Handle, err)
+			failed++
+			continue
+		}
+		moved++
+	}
+	if failed > 0 {
+		return moved, fmt.Errorf("could not move %d followers", failed)
+	}
+	return moved, nil
+}
+
+// handleMoveActivity moves the local followers of a foreign actor to the
+// account they moved to. The move must be confirmed by both accounts: the
+// target must list the actor as an alias, and the actor must say it moved
+// to the target.
+func (s *serverWrapper) handleMoveActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received a move activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t moveActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Actor, t.Target); bad {
+			return
+		}
+		if t.Actor == "" || t.Object != t.Actor {
+			log.Printf("%#v tried to move %#v", t.Actor, t.Object)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "Actors can only move themselves.\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		target, err := s.moveTarget(ctx, t.Actor, t.Target)
+		if err == errNotAlias {
+			log.Printf("Move of %#v to %#v which doesn't alias it", t.Actor, t.Target)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Target does not list actor as an alias.\n")
+			return
+		} else if err != nil {
+			log.Printf("Could not check move target %#v. Error: %v", t.Target, err)
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "Could not check move target.\n")
+			return
+		}
+
+		old := s.remoteActors.Forget(t.Actor)
+		a, err := s.remoteActors.FetchActor(ctx, t.Actor)
+		if err != nil {
+			log.Printf("Could not fetch moved actor %#v. Error: %v", t.Actor, err)
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "Could not fetch moved actor.\n")
+			return
+		}
+		if a.MovedTo != t.Target {
+			log.Printf("Move of %#v to %#v, but it moved to %#v", t.Actor, t.Target, a.MovedTo)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Actor has not moved to target.\n")
+			return
+		}
+
+		u, err := s.foreignUserOf(ctx, t.Actor, old)
+		if err == util.UserNotFoundErr {
+			// Nobody here follows them.
+			log.Printf("Ignoring move of unknown actor %#v", t.Actor)
+			fmt.Fprintf(w, "{}\n")
+			return
+		} else if err != nil {
+			log.Printf("Could not get moved user. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving move activity.\n")
+			return
+		}
+
+		s.repointFollowersLater(u.GlobalId, target)
+		log.Printf("Moving followers of %#v to %#v\n", t.Actor, t.Target)
+		fmt.Fprintf(w, "{}\n")
+	}
+}
+
+type aliasStruct struct {
+	Alias string `json:"alias"`
+}
+
+type aliasesResp struct {
+	Error   string   `json:"error"`
+	Aliases []string `json:"aliases"`
+	MovedTo string   `json:"moved_to,omitempty"`
+}
+
+// aliasID finds the ActivityPub id of an account given as a handle or
+// handle@host. An id is returned as it is.
+func (s *serverWrapper) aliasID(ctx context.Context, alias string) (string, error) {
+	if strings.HasPrefix(alias, "http://") || strings.HasPrefix(alias, "https://") {
+		return alias, nil
+	}
+	id, _, err := s.userActorID(ctx, alias)
+	return id, err
+}
+
+// handleAliases lists the aliases of the logged in user, and the account
+// they moved to, if any.
+func (s *serverWrapper) handleAliases() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Call to aliases by not logged in user")
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&aliasesResp{Error: loginRequired})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.aliasesOf(ctx, globalID)
+		if err != nil {
+			log.Printf("Could not get aliases of %d: %v", globalID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&aliasesResp{Error: "Could not get aliases"})
+			return
+		}
+		aliases := resp.Aliases
+		if aliases == nil {
+			aliases = []string{}
+		}
+		enc.Encode(&aliasesResp{Aliases: aliases, MovedTo: resp.MovedTo})
+	}
+}
+
+// handleAliasModify adds or removes an alias of the logged in user. Other
+// accounts of theirs can only move to them once they are aliased.
+func (s *serverWrapper) handleAliasModify(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Call to modify aliases by not logged in user")
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&aliasesResp{Error: loginRequired})
+			return
+		}
+
+		var t aliasStruct
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Alias == "" {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&aliasesResp{Error: invalidJSONError})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		id, err := s.aliasID(ctx, t.Alias)
+		if err != nil {
+			log.Printf("Could not find alias %#v: %v", t.Alias, err)
+			w.WriteHeader(http.StatusNotFound)
+			enc.Encode(&aliasesResp{Error: aliasNotFound})
+			return
+		}
+
+		e := &pb.AliasEntry{UserId: globalID, Alias: id}
+		modify := s.database.RemoveAlias
+		if add {
+			modify = s.database.AddAlias
+		}
+		resp, err := modify(ctx, e)
+		if err != nil || resp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", resp.Error)
+			}
+			log.Printf("Could not modify alias %#v of %d: %v", id, globalID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&aliasesResp{Error: "Could not modify alias"})
+			return
+		}
+		s.handleAliases()(w, r)
+	}
+}
+
+func (s *serverWrapper) handleAliasAdd() http.HandlerFunc {
+	return s.handleAliasModify(true)
+}
+
+func (s *serverWrapper) handleAliasRemove() http.HandlerFunc {
+	return s.handleAliasModify(false)
+}
+
+type moveStruct struct {
+	Target string `json:"target"`
+}
+
+// handleMove moves the logged in user to another account, which must list
+// them as an alias. Their followers are sent a Move activity so that they
+// follow the new account instead, and local followers are moved in the
+// background.
+func (s *serverWrapper) handleMove() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		handle, err := s.getSessionHandle(r)
+		if err != nil {
+			log.Printf("Call to move by not logged in user")
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&aliasesResp{Error: loginRequired})
+			return
+		}
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Could not get global id of %#v: %v", handle, err)
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&aliasesResp{Error: loginRequired})
+			return
+		}
+
+		var t moveStruct
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil || t.Target == "" {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&aliasesResp{Error: invalidJSONError})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		from := s.localActorID(handle)
+		targetID, _, err := s.userActorID(ctx, t.Target)
+		if err != nil || targetID == from {
+			log.Printf("Could not find move target %#v: %v", t.Target, err)
+			w.WriteHeader(http.StatusNotFound)
+			enc.Encode(&aliasesResp{Error: moveNotFound})
+			return
+		}
+		target, err := s.moveTarget(ctx, from, targetID)
+		if err == errNotAlias {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&aliasesResp{Error: moveNotAlias})
+			return
+		} else if err != nil {
+			log.Printf("Could not check move target %#v: %v", targetID, err)
+			w.WriteHeader(http.StatusBadGateway)
+			enc.Encode(&aliasesResp{Error: moveCheckFailed})
+			return
+		}
+
+		// Record the move first, so that our actor says where they moved
+		// to when other instances check.
+		resp, err := s.database.SetMovedTo(ctx, &pb.AliasEntry{UserId: globalID, Alias: targetID})
+		if err != nil || resp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", resp.Error)
+			}
+			log.Printf("Could not record move of %#v: %v", handle, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&aliasesResp{Error: "Could not move account"})
+			return
+		}
+
+		mResp, err := s.s2sMove.SendMoveActivity(ctx, &pb.MoveDetails{
+			MoverId: globalID,
+			Target:  targetID,
+		})
+		if err != nil || mResp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", mResp.Error)
+			}
+			log.Printf("Could not send move of %#v: %v", handle, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&aliasesResp{Error: "Could not tell followers of the move"})
+			return
+		}
+
+		s.repointFollowersLater(globalID, target)
+		log.Printf("User %#v moved to %#v", handle, targetID)
+		s.handleAliases()(w, r)
+	}
+}
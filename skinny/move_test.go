@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+type moveFollowsFake struct {
+	pb.FollowsClient
+
+	sent []string
+}
+
+func (f *moveFollowsFake) SendFollowRequest(_ context.Context, r *pb.LocalToAnyFollow, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	f.sent = append(f.sent, r.Follower+" -> "+r.Followed)
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+type MoveFake struct {
+	pb.S2SMoveClient
+
+	rq *pb.MoveDetails
+}
+
+func (m *MoveFake) SendMoveActivity(_ context.Context, r *pb.MoveDetails, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	m.rq = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+const aliceActorID = "http://SKINNYTESTS:191/ap/@alice"
+
+func newMoveTestServer(sender *util.RemoteActor) (*serverWrapper, *MemoryDatabaseFake, *moveFollowsFake) {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+			{GlobalId: 4, Handle: "carol", Host: "https://other.test"},
+		},
+		aliases: map[int64][]string{},
+		movedTo: map[int64]string{},
+	}
+	follows := &moveFollowsFake{}
+	srv.database = db
+	srv.follows = follows
+	srv.s2sMove = &MoveFake{}
+	srv.remoteActors = &profileActorResolver{
+		actors: map[string]*util.RemoteActor{sender.ID: sender},
+		cached: map[string]*util.RemoteActor{},
+	}
+	return srv, db, follows
+}
+
+// runQueuedJobs handles the jobs in the inbox queue of srv, and those they
+// queue in turn, without starting the queue.
+func runQueuedJobs(t *testing.T, srv *serverWrapper) {
+	q := srv.inboxQueue
+	for {
+		jobs, err := q.read(q.dir)
+		if err != nil {
+			t.Fatalf("Could not read queued jobs: %v", err)
+		} else if len(jobs) == 0 {
+			return
+		}
+		for _, j := range jobs {
+			if _, err := srv.processInboxJob(j); err != nil {
+				t.Fatalf("Job %#v failed: %v", j, err)
+			}
+			os.Remove(q.jobPath(q.dir, j.ID))
+		}
+	}
+}
+
+func TestHandleMoveActivity(t *testing.T) {
+	moved := &util.RemoteActor{
+		ID:                testKeyOwner,
+		Type:              "Person",
+		PreferredUsername: "sender",
+		Inbox:             testKeyOwner + "/inbox",
+		MovedTo:           aliceActorID,
+	}
+	move := `{"id": "http://remote.test/move/1", "type": "Move",
+		"actor": "http://remote.test/ap/@sender",
+		"object": "http://remote.test/ap/@sender",
+		"target": "http://SKINNYTESTS:191/ap/@alice"}`
+
+	srv, db, follows := newMoveTestServer(moved)
+	q, dir := newTestInboxQueue(t, srv.processInboxJob)
+	defer os.RemoveAll(dir)
+	srv.inboxQueue = q
+	db.aliases[1] = []string{testKeyOwner}
+	db.follows = []*pb.Follow{
+		{Follower: 2, Followed: 3},
+		{Follower: 4, Followed: 3},
+	}
+	if code := deliverToAlice(srv, move); code != http.StatusAccepted {
+		t.Fatalf("Expected 202 Accepted, got %#v", code)
+	}
+	runQueuedJobs(t, srv)
+	if want := []string{"bob -> alice"}; !reflect.DeepEqual(follows.sent, want) {
+		t.Errorf("Expected follows %v, got %v", want, follows.sent)
+	}
+	if len(db.follows) != 1 || db.follows[0].Follower != 4 {
+		t.Errorf("Expected only the foreign follow to remain, got %v", db.follows)
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		aliased bool
+		movedTo string
+		want    int
+	}{
+		{
+			name:    "target without alias",
+			body:    move,
+			movedTo: aliceActorID,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name:    "actor not moved",
+			body:    move,
+			aliased: true,
+			want:    http.StatusBadRequest,
+		},
+		{
+			name: "move of another actor",
+			body: `{"type": "Move", "actor": "http://remote.test/ap/@sender",
+				"object": "http://remote.test/ap/@dave",
+				"target": "http://SKINNYTESTS:191/ap/@alice"}`,
+			aliased: true,
+			movedTo: aliceActorID,
+			want:    http.StatusForbidden,
+		},
+	}
+	for _, tc := range tests {
+		sender := *moved
+		sender.MovedTo = tc.movedTo
+		srv, db, follows := newMoveTestServer(&sender)
+		if tc.aliased {
+			db.aliases[1] = []string{testKeyOwner}
+		}
+		db.follows = []*pb.Follow{{Follower: 2, Followed: 3}}
+
+		if code := deliverToAlice(srv, tc.body); code != tc.want {
+			t.Errorf("%s: Expected %d, got %#v", tc.name, tc.want, code)
+		}
+		if len(follows.sent) != 0 || len(db.follows) != 1 {
+			t.Errorf("%s: Expected follows to be unchanged, got %v", tc.name, follows.sent)
+		}
+	}
+}
+
+func TestHandleMove(t *testing.T) {
+	target := &util.RemoteActor{
+		ID:                testKeyOwner,
+		Type:              "Person",
+		PreferredUsername: "sender",
+		Inbox:             testKeyOwner + "/inbox",
+	}
+	move := func(srv *serverWrapper) (int, *aliasesResp) {
+		req, _ := http.NewRequest("POST", "/c2s/move",
+			bytes.NewBufferString(`{"target": "sender@remote.test"}`))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		srv.handleMove()(res, req)
+		var r aliasesResp
+		json.Unmarshal(res.Body.Bytes(), &r)
+		return res.Code, &r
+	}
+
+	// The session of jose has global id 0.
+	srv, db, _ := newMoveTestServer(target)
+	if code, _ := move(srv); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request without alias, got %#v", code)
+	}
+	if len(db.movedTo) != 0 {
+		t.Errorf("Expected no move to be recorded, got %v", db.movedTo)
+	}
+
+	target.AlsoKnownAs = util.IDList{"http://SKINNYTESTS:191/ap/@jose"}
+	srv, db, follows := newMoveTestServer(target)
+	q, dir := newTestInboxQueue(t, srv.processInboxJob)
+	defer os.RemoveAll(dir)
+	srv.inboxQueue = q
+	db.follows = []*pb.Follow{{Follower: 2, Followed: 0}, {Follower: 4, Followed: 0}}
+	code, r := move(srv)
+	if code != http.StatusOK || r.MovedTo != testKeyOwner {
+		t.Fatalf("Expected 200 OK and move to sender, got %#v %#v", code, r)
+	}
+	if m := srv.s2sMove.(*MoveFake).rq; m == nil || m.Target != testKeyOwner {
+		t.Errorf("Expected Move to be sent to followers, got %v", m)
+	}
+	if len(follows.sent) != 0 {
+		t.Errorf("Expected followers to be moved in the background, got %v", follows.sent)
+	}
+	runQueuedJobs(t, srv)
+	if want := []string{"bob -> sender@https://remote.test"}; !reflect.DeepEqual(follows.sent, want) {
+		t.Errorf("Expected follows %v, got %v", want, follows.sent)
+	}
+}
+
+func TestRepointFollowers(t *testing.T) {
+	srv, db, follows := newMoveTestServer(testRemoteActor)
+	db.follows = []*pb.Follow{{Follower: 2, Followed: 3}, {Follower: 4, Followed: 3}}
+	db.failDeletes = true
+
+	n, err := srv.repointFollowers(context.Background(), 3, "alice")
+	if n != 0 || err == nil {
+		t.Errorf("Expected no followers moved and an error, got %d, %v", n, err)
+	}
+	if want := []string{"bob -> alice"}; !reflect.DeepEqual(follows.sent, want) {
+		t.Errorf("Expected follows %v, got %v", want, follows.sent)
+	}
+
+	// The job is retried until the old follows are gone.
+	db.failDeletes = false
+	b, _ := json.Marshal(&repointJob{Followed: 3, Target: "alice"})
+	if retry, err := srv.processRepointJob(&inboxJob{Task: repointTask, Body: string(b)}); retry || err != nil {
+		t.Errorf("Expected retried job to succeed, got %v, %v", retry, err)
+	}
+	if len(db.follows) != 1 || db.follows[0].Follower != 4 {
+		t.Errorf("Expected only the foreign follow to remain, got %v", db.follows)
+	}
+}
+
+func TestHandleAliasModify(t *testing.T) {
+	srv, db, _ := newMoveTestServer(testRemoteActor)
+	modify := func(h http.HandlerFunc, alias string) (int, []string) {
+		req, _ := http.NewRequest("POST", "/c2s/aliases/add",
+			bytes.NewBufferString(`{"alias": "`+alias+`"}`))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		h(res, req)
+		var r aliasesResp
+		json.Unmarshal(res.Body.Bytes(), &r)
+		return res.Code, r.Aliases
+	}
+
+	code, aliases := modify(srv.handleAliasAdd(), "sender@remote.test")
+	if code != http.StatusOK || !reflect.DeepEqual(aliases, []string{testKeyOwner}) {
+		t.Errorf("Expected alias of sender, got %#v %v", code, aliases)
+	}
+	if code, _ := modify(srv.handleAliasAdd(), "nobody@remote.test"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found, got %#v", code)
+	}
+	code, aliases = modify(srv.handleAliasRemove(), testKeyOwner)
+	if code != http.StatusOK || len(aliases) != 0 || len(db.aliases[0]) != 0 {
+		t.Errorf("Expected alias to be removed, got %#v %v", code, aliases)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// activityMediaTypes are the types ActivityPub servers ask for when
+// dereferencing objects. application/ld+json is matched with any profile.
+var activityMediaTypes = map[string]bool{
+	"application/activity+json": true,
+	"application/ld+json":       true,
+	"application/json":          true,
+}
+
+// htmlMediaTypes are the types browsers ask for.
+var htmlMediaTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// wantsActivityJSON decides from the Accept header whether a request should
+// get an ActivityStreams object or the web app.
+//
+// Requests without an Accept header, or which only accept wildcards, get
+// ActivityStreams, since browsers always ask for HTML explicitly.
+func wantsActivityJSON(r *http.Request) bool {
+	var htmlQ, activityQ float64
+	for _, accept := range r.Header["Accept"] {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			params := strings.Split(mediaRange, ";")
+			mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+			q := 1.0
+			for _, p := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+				if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+					if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+						q = v
+					}
+				}
+			}
+
+			if activityMediaTypes[mediaType] && q > activityQ {
+				activityQ = q
+			} else if htmlMediaTypes[mediaType] && q > htmlQ {
+				htmlQ = q
+			}
+		}
+	}
+	return activityQ >= htmlQ
+}
+
+// negotiate serves ActivityStreams objects from apHandler to servers, and
+// redirects browsers to the matching route in the web app. route builds the
+// web app route from the mux variables of the request.
+func negotiate(apHandler http.HandlerFunc, route func(map[string]string) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if wantsActivityJSON(r) {
+			apHandler(w, r)
+			return
+		}
+		// The web app routes after the fragment, so the browser has to be
+		// sent to the index page.
+		http.Redirect(w, r, "/#"+route(mux.Vars(r)), http.StatusSeeOther)
+	}
+}
+
+func profileRoute(v map[string]string) string {
+	return "/@" + v["username"]
+}
+
+func articleRoute(v map[string]string) string {
+	return "/@" + v["username"] + "/" + v["article_id"]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestWantsActivityJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", true},
+		{"*/*", true},
+		{"application/activity+json", true},
+		{`application/ld+json; profile="https://www.w3.org/ns/activitystreams"`, true},
+		{"application/activity+json, application/ld+json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"text/html;q=0.5, application/activity+json", true},
+		{"application/json;q=0.2, text/html", false},
+	}
+	for _, tcase := range tests {
+		req, _ := http.NewRequest("GET", "/ap/@testuser", nil)
+		if tcase.accept != "" {
+			req.Header.Set("Accept", tcase.accept)
+		}
+		if got := wantsActivityJSON(req); got != tcase.want {
+			t.Errorf("wantsActivityJSON(%#v): expected %v, got %v", tcase.accept, tcase.want, got)
+		}
+	}
+}
+
+func TestNegotiateRedirectsBrowsers(t *testing.T) {
+	called := false
+	h := negotiate(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}, articleRoute)
+
+	req, _ := http.NewRequest("GET", "/ap/@testuser/12", nil)
+	req.Header.Set("Accept", "text/html")
+	req = mux.SetURLVars(req, map[string]string{"username": "testuser", "article_id": "12"})
+	res := httptest.NewRecorder()
+	h(res, req)
+
+	if called {
+		t.Errorf("Expected browser request to not reach the ActivityPub handler")
+	}
+	if res.Code != http.StatusSeeOther {
+		t.Errorf("Expected 303 See Other, got %#v", res.Code)
+	}
+	if loc := res.Header().Get("Location"); loc != "/#/@testuser/12" {
+		t.Errorf("Expected redirect to article page, got %#v", loc)
+	}
+
+	req, _ = http.NewRequest("GET", "/ap/@testuser/12", nil)
+	req.Header.Set("Accept", "application/activity+json")
+	res = httptest.NewRecorder()
+	h(res, req)
+	if !called {
+		t.Errorf("Expected ActivityPub request to reach the ActivityPub handler")
+	}
+	if res.Header().Get("Vary") != "Accept" {
+		t.Errorf("Expected Vary: Accept, got %#v", res.Header().Get("Vary"))
+	}
+}
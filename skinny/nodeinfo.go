@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+const (
+	nodeInfoPath     = "/.well-known/nodeinfo"
+	nodeInfoSchema   = "http://nodeinfo.diaspora.software/ns/schema/"
+	softwareName     = "rabble"
+	softwareVersion  = "0.0.1"
+	softwareRepo     = "https://github.com/cpssd/rabble"
+	nodeInfoErr      = "Could not create nodeinfo.\n"
+	nodeInfoUsageErr = "Could not count users and posts for nodeinfo: %v"
+)
+
+// noOpServices maps the env vars read by getNoOpServiceHandler to the
+// service they disable, for reporting in the NodeInfo metadata.
+var noOpServices = map[string]string{
+	postServiceLocationEnv:   "post_recommendations",
+	followServiceLocationEnv: "follow_recommendations",
+}
+
+// nodeInfoLink is an entry in the /.well-known/nodeinfo discovery document.
+type nodeInfoLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+}
+
+type nodeInfoSoftware struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+type nodeInfoServices struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+type nodeInfoUsage struct {
+	Users struct {
+		Total int `json:"total"`
+	} `json:"users"`
+	LocalPosts int `json:"localPosts"`
+}
+
+type nodeInfoMetadata struct {
+	NodeName         string   `json:"nodeName"`
+	DisabledServices []string `json:"disabledServices"`
+}
+
+// NodeInfo is the document describing this instance to crawlers and other
+// fediverse software.
+// See https://github.com/jhass/nodeinfo/blob/master/PROTOCOL.md
+type NodeInfo struct {
+	Version           string           `json:"version"`
+	Software          nodeInfoSoftware `json:"software"`
+	Protocols         []string         `json:"protocols"`
+	Services          nodeInfoServices `json:"services"`
+	OpenRegistrations bool             `json:"openRegistrations"`
+	Usage             nodeInfoUsage    `json:"usage"`
+	Metadata          nodeInfoMetadata `json:"metadata"`
+}
+
+// handleNodeInfoDiscovery serves the list of NodeInfo schema versions we
+// support and where to find them.
+func (s *serverWrapper) handleNodeInfoDiscovery() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := util.NormaliseHost(s.hostname)
+		links := struct {
+			Links []nodeInfoLink `json:"links"`
+		}{}
+		for _, v := range []string{"2.0", "2.1"} {
+			links.Links = append(links.Links, nodeInfoLink{
+				Rel:  nodeInfoSchema + v,
+				Href: host + "/nodeinfo/" + v,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(links); err != nil {
+			log.Printf("Could not marshal nodeinfo links: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// countLocalUsage returns the number of local users and the number of
+// posts they have written.
+func (s *serverWrapper) countLocalUsage(ctx context.Context) (int, int, error) {
+	resp, err := s.database.LocalUsage(ctx, &pb.LocalUsageRequest{})
+	if err != nil {
+		return 0, 0, fmt.Errorf(nodeInfoUsageErr, err)
+	} else if resp.ResultType != pb.ResultType_OK {
+		return 0, 0, fmt.Errorf(nodeInfoUsageErr, resp.Error)
+	}
+	return int(resp.Users), int(resp.Posts), nil
+}
+
+// handleNodeInfo serves the NodeInfo document for the given schema version.
+func (s *serverWrapper) handleNodeInfo(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		numUsers, numPosts, err := s.countLocalUsage(ctx)
+		if err != nil {
+			log.Print(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, nodeInfoErr)
+			return
+		}
+
+		info := &NodeInfo{
+			Version: version,
+			Software: nodeInfoSoftware{
+				Name:    softwareName,
+				Version: softwareVersion,
+			},
+			// RSS is not a federation protocol in the NodeInfo schema, so it
+			// is reported as a service we can import from and export to.
+			Protocols: []string{"activitypub"},
+			Services: nodeInfoServices{
+				Inbound:  []string{"rss2.0"},
+				Outbound: []string{"rss2.0"},
+			},
+			OpenRegistrations: true,
+			Metadata: nodeInfoMetadata{
+				NodeName:         s.hostname,
+				DisabledServices: []string{},
+			},
+		}
+		if version != "2.0" {
+			info.Software.Repository = softwareRepo
+			info.Software.Homepage = softwareRepo
+		}
+		info.Usage.Users.Total = numUsers
+		info.Usage.LocalPosts = numPosts
+
+		for env, name := range noOpServices {
+			if os.Getenv(env) == noOpLocation {
+				info.Metadata.DisabledServices = append(info.Metadata.DisabledServices, name)
+			}
+		}
+		sort.Strings(info.Metadata.DisabledServices)
+
+		w.Header().Set("Content-Type", fmt.Sprintf(
+			`application/json; profile="%s%s#"`, nodeInfoSchema, version))
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(info); err != nil {
+			log.Printf("Could not marshal nodeinfo: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+func TestNodeInfoDiscovery(t *testing.T) {
+	srv := newTestServerWrapper()
+	req, _ := http.NewRequest("GET", nodeInfoPath, nil)
+	res := httptest.NewRecorder()
+	srv.handleNodeInfoDiscovery()(res, req)
+
+	var d struct {
+		Links []nodeInfoLink `json:"links"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &d); err != nil {
+		t.Fatalf("Could not decode discovery document: %v", err)
+	}
+	want := []nodeInfoLink{
+		{nodeInfoSchema + "2.0", "http://SKINNYTESTS:191/nodeinfo/2.0"},
+		{nodeInfoSchema + "2.1", "http://SKINNYTESTS:191/nodeinfo/2.1"},
+	}
+	if !reflect.DeepEqual(d.Links, want) {
+		t.Errorf("Expected links %#v, got %#v", want, d.Links)
+	}
+}
+
+func TestNodeInfo(t *testing.T) {
+	os.Setenv(postServiceLocationEnv, noOpLocation)
+	defer os.Unsetenv(postServiceLocationEnv)
+
+	srv := newTestServerWrapper()
+	// Alice and bob have written three posts between them.
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		posts: []*pb.PostsEntry{
+			{GlobalId: 10, AuthorId: 1},
+			{GlobalId: 11, AuthorId: 2},
+			{GlobalId: 12, AuthorId: 2},
+			{GlobalId: 13, AuthorId: 3},
+		},
+	}
+	req, _ := http.NewRequest("GET", "/nodeinfo/2.1", nil)
+	res := httptest.NewRecorder()
+	srv.handleNodeInfo("2.1")(res, req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var n NodeInfo
+	if err := json.Unmarshal(res.Body.Bytes(), &n); err != nil {
+		t.Fatalf("Could not decode nodeinfo: %v", err)
+	}
+	if n.Version != "2.1" || n.Software.Name != softwareName {
+		t.Errorf("Unexpected version or software: %#v", n)
+	}
+	if n.Usage.Users.Total != 2 {
+		t.Errorf("Expected 2 local users, got %d", n.Usage.Users.Total)
+	}
+	if n.Usage.LocalPosts != 3 {
+		t.Errorf("Expected 3 local posts, got %d", n.Usage.LocalPosts)
+	}
+	want := []string{"post_recommendations"}
+	if !reflect.DeepEqual(n.Metadata.DisabledServices, want) {
+		t.Errorf("Expected disabled services %v, got %v", want, n.Metadata.DisabledServices)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const activityStreamsNamespace = "https://www.w3.org/ns/activitystreams#"
+
+// linkFields are properties which the inbox handlers expect as a single IRI.
+var linkFields = []string{"actor", "attributedTo", "target", "inReplyTo"}
+
+// addressFields are properties which the inbox handlers expect as an array
+// of IRIs.
+var addressFields = []string{"to", "cc", "bto", "bcc", "audience"}
+
+// embeddedObjectTypes are the activities whose handlers expect the object to
+// be embedded. The object of every other type is reduced to its IRI.
+var embeddedObjectTypes = map[string]bool{
+	"create":   true,
+	"update":   true,
+	"announce": true,
+	"undo":     true,
+	"accept":   true,
+	"reject":   true,
+}
+
+// objectListTypes are the activities whose handlers expect the object to be
+// an array of IRIs, as they may act on several objects at once.
+var objectListTypes = map[string]bool{
+	"flag": true,
+}
+
+// dereferenceErr is returned when normalising an activity failed because a
+// referenced object couldn't be fetched, which may work if tried again.
+type dereferenceErr struct {
+	id  string
+	err error
+}
+
+func (e *dereferenceErr) Error() string {
+	return fmt.Sprintf("could not fetch %#v: %v", e.id, e.err)
+}
+
+// ldContext holds the prefixes defined in an @context, used to expand
+// compact IRIs like "as:Public".
+type ldContext map[string]string
+
+func newLDContext(c interface{}) ldContext {
+	ctx := ldContext{"as": activityStreamsNamespace}
+	var add func(c interface{})
+	add = func(c interface{}) {
+		switch v := c.(type) {
+		case []interface{}:
+			for _, e := range v {
+				add(e)
+			}
+		case map[string]interface{}:
+			for term, def := range v {
+				if iri, ok := def.(string); ok && (strings.HasSuffix(iri, "#") || strings.HasSuffix(iri, "/")) {
+					ctx[term] = iri
+				}
+			}
+		}
+	}
+	add(c)
+	return ctx
+}
+
+// expand turns a compact IRI into a full one. Terms from the ActivityStreams
+// namespace are given as plain terms, as the handlers use them.
+func (c ldContext) expand(s string) string {
+	if i := strings.Index(s, ":"); i > 0 && !strings.HasPrefix(s[i:], "://") {
+		if iri, ok := c[s[:i]]; ok {
+			s = iri + s[i+1:]
+		}
+	}
+	if strings.HasPrefix(s, "http://www.w3.org/ns/activitystreams#") {
+		s = activityStreamsNamespace + strings.TrimPrefix(s, "http://www.w3.org/ns/activitystreams#")
+	}
+	return s
+}
+
+func (c ldContext) term(s string) string {
+	switch s {
+	case "@id":
+		return "id"
+	case "@type":
+		return "type"
+	}
+	return strings.TrimPrefix(c.expand(s), activityStreamsNamespace)
+}
+
+// iri expands a value used as an IRI. The public collection is always given
+// in full, as it is addressed in many different ways.
+func (c ldContext) iri(s string) string {
+	if s == "Public" || s == "as:Public" {
+		return activityStreamsPublic
+	}
+	s = c.expand(s)
+	if s == activityStreamsNamespace+"Public" {
+		return activityStreamsPublic
+	}
+	return s
+}
+
+// linkID returns the IRI of a value given in object-or-link form: either an
+// IRI, an object or link with an id or href, or an array of these, in which
+// case the first is used.
+func (c ldContext) linkID(v interface{}) string {
+	switch l := v.(type) {
+	case string:
+		return c.iri(l)
+	case []interface{}:
+		if len(l) > 0 {
+			return c.linkID(l[0])
+		}
+	case map[string]interface{}:
+		for _, k := range []string{"id", "@id", "href"} {
+			if id, ok := l[k].(string); ok {
+				return c.iri(id)
+			}
+		}
+	}
+	return ""
+}
+
+// linkIDs returns the IRIs of a value which may be a single value in
+// object-or-link form, or an array of them.
+func (c ldContext) linkIDs(v interface{}) []string {
+	l, ok := v.([]interface{})
+	if !ok {
+		l = []interface{}{v}
+	}
+	ids := []string{}
+	for _, e := range l {
+		if id := c.linkID(e); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// tags returns the tags of an object, which may be a single tag or an array,
+// as an array of tags with their type and href expanded.
+func (c ldContext) tags(v interface{}) []interface{} {
+	l, ok := v.([]interface{})
+	if !ok {
+		l = []interface{}{v}
+	}
+	tags := []interface{}{}
+	for _, e := range l {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tag := map[string]interface{}{}
+		for k, v := range m {
+			tag[c.term(k)] = v
+		}
+		if t, ok := tag["type"].(string); ok {
+			tag["type"] = c.term(t)
+		}
+		if href, ok := tag["href"]; ok {
+			tag["href"] = c.linkID(href)
+		}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// normaliser turns an activity in any of the shapes JSON-LD allows into the
+// shape the inbox handlers decode, fetching referenced objects as needed.
+type normaliser struct {
+	ctx   context.Context
+	ld    ldContext
+	fetch func(ctx context.Context, id string, v interface{}) error
+	// local reports whether an IRI is one of ours.
+	local func(id string) bool
+}
+
+// object normalises the properties of an object or activity.
+func (n *normaliser) object(in map[string]interface{}, depth int) (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	for k, v := range in {
+		if k == "@context" {
+			out[k] = v
+			continue
+		}
+		out[n.ld.term(k)] = v
+	}
+
+	switch t := out["type"].(type) {
+	case string:
+		out["type"] = n.ld.term(t)
+	case []interface{}:
+		// Use the first type we know, which is the ActivityStreams one.
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				out["type"] = n.ld.term(s)
+				break
+			}
+		}
+	}
+	if id, ok := out["id"].(string); ok {
+		out["id"] = n.ld.iri(id)
+	}
+
+	for _, k := range linkFields {
+		if v, ok := out[k]; ok {
+			out[k] = n.ld.linkID(v)
+		}
+	}
+	for _, k := range addressFields {
+		if v, ok := out[k]; ok {
+			out[k] = n.ld.linkIDs(v)
+		}
+	}
+	if url, ok := out["url"]; ok {
+		out["url"] = n.ld.linkID(url)
+	}
+	if tags, ok := out["tag"]; ok {
+		out["tag"] = n.ld.tags(tags)
+	}
+
+	o, ok := out["object"]
+	if !ok {
+		return out, nil
+	}
+	t, _ := out["type"].(string)
+	if objectListTypes[strings.ToLower(t)] {
+		out["object"] = n.ld.linkIDs(o)
+		return out, nil
+	}
+	if !embeddedObjectTypes[strings.ToLower(t)] {
+		out["object"] = n.ld.linkID(o)
+		return out, nil
+	}
+
+	if l, ok := o.([]interface{}); ok && len(l) > 0 {
+		o = l[0]
+	}
+	embedded, ok := o.(map[string]interface{})
+	if ok {
+		// A link, rather than the object itself.
+		if _, hasType := embedded["type"]; !hasType {
+			o = n.ld.linkID(embedded)
+		} else if href, isLink := embedded["href"]; isLink && embedded["type"] == "Link" {
+			o = n.ld.linkID(href)
+		}
+	}
+	if obj, isObject := o.(map[string]interface{}); isObject && depth == 0 {
+		// An embedded object is only taken as it is from its own server,
+		// or if it's one of ours. Others are fetched again from theirs, so
+		// nobody can put words in another actor's mouth.
+		id, _ := obj["id"].(string)
+		actor, _ := out["actor"].(string)
+		if id != "" && !sameHost(n.ld.iri(id), actor) && !n.local(n.ld.iri(id)) {
+			o = id
+		}
+	}
+	if id, isIRI := o.(string); isIRI && depth > 0 {
+		// Only the object of the activity itself is fetched. The object of
+		// an activity being undone may well be gone already.
+		embedded, ok = map[string]interface{}{"id": n.ld.iri(id)}, true
+	} else if isIRI {
+		fetched := map[string]interface{}{}
+		if err := n.fetch(n.ctx, n.ld.iri(id), &fetched); err != nil {
+			return nil, &dereferenceErr{id: id, err: err}
+		}
+		if got := n.ld.linkID(fetched); got != n.ld.iri(id) {
+			return nil, fmt.Errorf("fetched object %#v has id %#v", id, got)
+		}
+		embedded = fetched
+	} else if !ok {
+		return nil, fmt.Errorf("%s has an invalid object", t)
+	}
+
+	// Objects fetched on their own carry their own context.
+	ld := n.ld
+	if c, ok := embedded["@context"]; ok {
+		ld = newLDContext(c)
+	}
+	sub := &normaliser{ctx: n.ctx, ld: ld, fetch: n.fetch, local: n.local}
+	norm, err := sub.object(embedded, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	delete(norm, "@context")
+	out["object"] = norm
+	return out, nil
+}
+
+// normaliseActivity rewrites an activity so that:
+//   - compact IRIs and ActivityStreams terms are expanded, and @id and @type
+//     are given as id and type;
+//   - actor, attributedTo and the like are single IRIs, even if they were
+//     given as embedded objects or links;
+//   - to, cc and the other address fields are arrays of IRIs;
+//   - tag is an array of tags, such as Mentions and Hashtags;
+//   - the object is embedded for activities that act on its contents, like
+//     Create and Announce, fetching it if only its IRI was given or if it
+//     was embedded by an actor on another server, is an array of IRIs for
+//     Flag, and is an IRI for all others, like Follow and Like. The objects
+//     of nested activities, as in Undo{Announce}, are not fetched, but are
+//     given as an object with only an id.
+//
+// The inbox handlers can then decode every activity into their fixed structs.
+func (s *serverWrapper) normaliseActivity(ctx context.Context, body []byte) ([]byte, error) {
+	var a map[string]interface{}
+	if err := json.Unmarshal(body, &a); err != nil {
+		return nil, err
+	}
+	n := &normaliser{
+		ctx:   ctx,
+		ld:    newLDContext(a["@context"]),
+		fetch: s.fetchObject,
+		local: func(id string) bool {
+			u, err := url.Parse(id)
+			return err == nil && s.isLocalHost(u.Host)
+		},
+	}
+	if n.fetch == nil {
+		n.fetch = func(context.Context, string, interface{}) error {
+			return fmt.Errorf("fetching objects is disabled")
+		}
+	}
+	norm, err := n.object(a, 0)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(norm)
+}
+
+// normalisedInboxHandler wraps an actorInboxRouter handler, so that it is
+// passed the activity in normalised form. See normaliseActivity.
+func (s *serverWrapper) normalisedInboxHandler(m http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			log.Printf("Could not read activity: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+		norm, err := s.normaliseActivity(ctx, body)
+		if _, ok := err.(*dereferenceErr); ok {
+			log.Printf("Could not normalise activity: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprintf(w, "Could not fetch object of activity.\n")
+			return
+		} else if err != nil {
+			log.Printf("Could not normalise activity: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON-LD\n")
+			return
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(norm))
+		m(w, r)
+	}
+}
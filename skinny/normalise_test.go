@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const testNoteID = "https://remote.test/users/sender/statuses/1"
+
+func fakeObjectFetcher(_ context.Context, id string, v interface{}) error {
+	switch id {
+	case testNoteID:
+		return json.Unmarshal([]byte(`{
+			"@context": ["https://www.w3.org/ns/activitystreams"],
+			"id": "`+testNoteID+`",
+			"type": "Note",
+			"attributedTo": {"id": "https://remote.test/users/sender", "type": "Person"},
+			"content": "hello",
+			"to": "as:Public"
+		}`), v)
+	case "https://remote.test/liar":
+		return json.Unmarshal([]byte(`{"id": "https://other.test/1", "type": "Note"}`), v)
+	}
+	return errors.New("not found")
+}
+
+func normaliseForTest(t *testing.T, body string, v interface{}) error {
+	srv := newTestServerWrapper()
+	srv.fetchObject = fakeObjectFetcher
+	norm, err := srv.normaliseActivity(context.Background(), []byte(body))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(norm, v); err != nil {
+		t.Fatalf("Could not decode normalised activity %s: %v", norm, err)
+	}
+	return nil
+}
+
+func TestNormaliseCreate(t *testing.T) {
+	body := `{
+		"@context": ["https://www.w3.org/ns/activitystreams", {"toot": "http://joinmastodon.org/ns#"}],
+		"@id": "https://remote.test/activities/1",
+		"as:type": "Create",
+		"actor": {"type": "Person", "id": "https://remote.test/users/sender"},
+		"to": "as:Public",
+		"object": {
+			"id": "` + testNoteID + `",
+			"type": ["Note", "toot:Status"],
+			"attributedTo": [{"type": "Link", "href": "https://remote.test/users/sender"}],
+			"url": {"type": "Link", "href": "https://remote.test/@sender/1"},
+			"content": "hello"
+		}
+	}`
+	var got createActivityStruct
+	if err := normaliseForTest(t, body, &got); err != nil {
+		t.Fatalf("normaliseActivity: %v", err)
+	}
+	want := createActivityStruct{
+		ID:        "https://remote.test/activities/1",
+		Type:      "Create",
+		Actor:     "https://remote.test/users/sender",
+		Recipient: []string{activityStreamsPublic},
+		Object: articleObjectStruct{
+			ID:           testNoteID,
+			Type:         "Note",
+			AttributedTo: "https://remote.test/users/sender",
+			URL:          "https://remote.test/@sender/1",
+			Content:      "hello",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %#v, got %#v", want, got)
+	}
+}
+
+func TestNormaliseDereferencesObject(t *testing.T) {
+	body := `{
+		"type": "Announce",
+		"actor": "https://remote.test/users/booster",
+		"object": "` + testNoteID + `"
+	}`
+	var got announceActivityStruct
+	if err := normaliseForTest(t, body, &got); err != nil {
+		t.Fatalf("normaliseActivity: %v", err)
+	}
+	if got.Object.ID != testNoteID || got.Object.Content != "hello" ||
+		got.Object.AttributedTo != "https://remote.test/users/sender" {
+		t.Errorf("Expected fetched note, got %#v", got.Object)
+	}
+
+	for _, id := range []string{"https://remote.test/missing", "https://remote.test/liar"} {
+		body = fmt.Sprintf(`{"type": "Announce", "object": %q}`, id)
+		if err := normaliseForTest(t, body, &got); err == nil {
+			t.Errorf("Expected error dereferencing %#v", id)
+		}
+	}
+}
+
+func TestNormaliseRefetchesForeignObject(t *testing.T) {
+	// Objects embedded by an actor on another server are fetched again.
+	body := `{
+		"type": "Announce",
+		"actor": "https://booster.test/users/booster",
+		"object": {"id": "` + testNoteID + `", "type": "Note", "content": "forged"}
+	}`
+	var got announceActivityStruct
+	if err := normaliseForTest(t, body, &got); err != nil {
+		t.Fatalf("normaliseActivity: %v", err)
+	}
+	if got.Object.Content != "hello" {
+		t.Errorf("Expected fetched note, got %#v", got.Object)
+	}
+
+	body = `{
+		"type": "Announce",
+		"actor": "https://booster.test/users/booster",
+		"object": {"id": "https://remote.test/liar", "type": "Note"}
+	}`
+	if err := normaliseForTest(t, body, &got); err == nil {
+		t.Errorf("Expected error when the fetched object has another id")
+	}
+
+	// Our own objects and those of the actor's server are taken as they are.
+	for _, id := range []string{"http://SKINNYTESTS:191/ap/@alice/1", "https://booster.test/notes/1"} {
+		body = `{
+			"type": "Announce",
+			"actor": "https://booster.test/users/booster",
+			"object": {"id": "` + id + `", "type": "Note", "content": "as is"}
+		}`
+		if err := normaliseForTest(t, body, &got); err != nil {
+			t.Errorf("normaliseActivity of %#v: %v", id, err)
+		} else if got.Object.Content != "as is" {
+			t.Errorf("Expected embedded %#v to be kept, got %#v", id, got.Object)
+		}
+	}
+}
+
+func TestNormaliseLinksInNestedActivities(t *testing.T) {
+	body := `{
+		"type": "Undo",
+		"actor": "https://remote.test/users/sender",
+		"object": {
+			"type": "Like",
+			"actor": {"id": "https://remote.test/users/sender"},
+			"object": {"id": "http://SKINNYTESTS:191/ap/@alice/1", "type": "Article"}
+		}
+	}`
+	var got likeUndoActivity
+	if err := normaliseForTest(t, body, &got); err != nil {
+		t.Fatalf("normaliseActivity: %v", err)
+	}
+	if got.Object.Actor != "https://remote.test/users/sender" ||
+		got.Object.Object != "http://SKINNYTESTS:191/ap/@alice/1" {
+		t.Errorf("Expected like to be reduced to IRIs, got %#v", got.Object)
+	}
+}
+
+func TestNormalisedInboxHandlerFetchFailure(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.fetchObject = fakeObjectFetcher
+	called := false
+	h := srv.normalisedInboxHandler(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	body := `{"type": "Announce", "object": "https://remote.test/missing"}`
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+	res := httptest.NewRecorder()
+	h(res, req)
+	if res.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 Bad Gateway, got %#v", res.Code)
+	}
+	if called {
+		t.Errorf("Expected handler to not be called")
+	}
+
+	req, _ = http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString("{"))
+	res = httptest.NewRecorder()
+	h(res, req)
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %#v", res.Code)
+	}
+}
+
+func TestNormaliseTags(t *testing.T) {
+	body := `{
+		"@context": ["https://www.w3.org/ns/activitystreams"],
+		"type": "Create",
+		"actor": "https://remote.test/users/sender",
+		"object": {
+			"id": "` + testNoteID + `",
+			"type": "Note",
+			"attributedTo": "https://remote.test/users/sender",
+			"tag": {"type": "as:Mention", "href": {"id": "http://SKINNYTESTS:191/ap/@alice"}, "name": "@alice"}
+		}
+	}`
+	var got createActivityStruct
+	if err := normaliseForTest(t, body, &got); err != nil {
+		t.Fatalf("normaliseActivity: %v", err)
+	}
+	want := []ArticleTagStruct{
+		{Type: "Mention", Href: "http://SKINNYTESTS:191/ap/@alice", Name: "@alice"},
+	}
+	if !reflect.DeepEqual(got.Object.Tag, want) {
+		t.Errorf("Expected tags %#v, got %#v", want, got.Object.Tag)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/gorilla/mux"
+)
+
+type pinStruct struct {
+	ArticleID int64 `json:"article_id"`
+}
+
+// handlePinModify pins, or unpins, one of the logged in user's articles to
+// their profile.
+func (s *serverWrapper) handlePinModify(pin bool) http.HandlerFunc {
+	const pinErr = "Issue with pinning article"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var t pinStruct
+		var cResp clientResp
+		enc := json.NewEncoder(w)
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			cResp.Error = invalidJSONError
+			enc.Encode(cResp)
+			return
+		}
+
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Pin call from user not logged in")
+			w.WriteHeader(http.StatusForbidden)
+			cResp.Error = loginRequired
+			enc.Encode(cResp)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		p := &pb.PinEntry{UserId: globalID, ArticleId: t.ArticleID}
+		var resp *pb.GeneralResponse
+		if pin {
+			resp, err = s.database.AddPin(ctx, p)
+		} else {
+			resp, err = s.database.RemovePin(ctx, p)
+		}
+		if err != nil {
+			log.Printf("Could not modify pin: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			cResp.Error = pinErr
+			enc.Encode(cResp)
+			return
+		} else if resp.ResultType == pb.ResultType_ERROR_400 {
+			log.Printf("User %d tried to pin article %d: %v", globalID, t.ArticleID, resp.Error)
+			w.WriteHeader(http.StatusNotFound)
+			cResp.Error = "No such article of yours"
+			enc.Encode(cResp)
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not modify pin: %v", resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			cResp.Error = pinErr
+			enc.Encode(cResp)
+			return
+		}
+
+		cResp.Message = "Article unpinned"
+		if pin {
+			cResp.Message = "Article pinned"
+		}
+		enc.Encode(cResp)
+	}
+}
+
+func (s *serverWrapper) handlePin() http.HandlerFunc {
+	return s.handlePinModify(true)
+}
+
+func (s *serverWrapper) handleUnpin() http.HandlerFunc {
+	return s.handlePinModify(false)
+}
+
+// getPinnedArticles finds the articles a user pinned, newest first.
+func (s *serverWrapper) getPinnedArticles(ctx context.Context, user *pb.UsersEntry) ([]interface{}, error) {
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{AuthorId: user.GlobalId},
+	})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get posts: %s", resp.Error)
+	}
+
+	articles := []interface{}{}
+	for _, p := range resp.Results {
+		if p.Pinned {
+			articles = append(articles, s.articleObject(ctx, user, p))
+		}
+	}
+	return articles, nil
+}
+
+// handleFeaturedCollection serves the articles a user pinned as an
+// OrderedCollection, which Mastodon shows at the top of their profile.
+// There are few pins, so the collection isn't paged.
+//
+// Private users only expose the number of pinned articles.
+func (s *serverWrapper) handleFeaturedCollection() http.HandlerFunc {
+	const featuredErr = "Could not create featured collection.\n"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		username := v["username"]
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		user, err := util.GetAuthorFromDb(ctx, username, "", true, 0, s.database)
+		if err == util.UserNotFoundErr {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Could not get user for featured: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, featuredErr)
+			return
+		}
+
+		articles, err := s.getPinnedArticles(ctx, user)
+		if err != nil {
+			log.Printf("Could not get pinned articles of %#v: %v", username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, featuredErr)
+			return
+		}
+
+		c := &OrderedCollectionStruct{
+			Context:    []string{activityStreamsContext},
+			ID:         s.localActorID(user.Handle) + "/featured",
+			Type:       "OrderedCollection",
+			TotalItems: len(articles),
+		}
+		if user.Private == nil || !user.Private.Value {
+			c.OrderedItems = articles
+		}
+
+		if err := writeActivityJSON(w, c); err != nil {
+			log.Printf("Could not marshal featured collection: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+// newPinsTestServer sets up a server where jose, whose session has global
+// id 0, wrote articles 10 and 11, and someone else wrote article 12.
+func newPinsTestServer(private bool) (*serverWrapper, *MemoryDatabaseFake) {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{{
+			Handle:  "jose",
+			Private: &wrapperpb.BoolValue{Value: private},
+		}},
+		posts: []*pb.PostsEntry{
+			{GlobalId: 11, Title: "second"},
+			{GlobalId: 10, Title: "first"},
+			{GlobalId: 12, AuthorId: 1, Title: "other"},
+		},
+	}
+	srv.database = db
+	return srv, db
+}
+
+func getTestFeatured(t *testing.T, srv *serverWrapper) *OrderedCollectionStruct {
+	req, _ := http.NewRequest("GET", "/ap/@jose/featured", nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "jose"})
+	res := httptest.NewRecorder()
+	srv.handleFeaturedCollection()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var c OrderedCollectionStruct
+	if err := json.Unmarshal(res.Body.Bytes(), &c); err != nil {
+		t.Fatalf("Could not decode featured %#v: %v", res.Body.String(), err)
+	}
+	return &c
+}
+
+func TestHandlePin(t *testing.T) {
+	srv, db := newPinsTestServer(false)
+	pin := func(h http.HandlerFunc, body string) int {
+		req, _ := http.NewRequest("POST", "/c2s/pin", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		h(res, req)
+		return res.Code
+	}
+
+	if code := pin(srv.handlePin(), `{"article_id": 10}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	if code := pin(srv.handlePin(), `{"article_id": 12}`); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found pinning another user's article, got %#v", code)
+	}
+	if !db.posts[1].Pinned || db.posts[2].Pinned {
+		t.Errorf("Expected only article 10 to be pinned, got %v", db.posts)
+	}
+
+	c := getTestFeatured(t, srv)
+	if c.TotalItems != 1 || len(c.OrderedItems) != 1 {
+		t.Fatalf("Expected 1 featured article, got %#v", c)
+	}
+	a := c.OrderedItems[0].(map[string]interface{})
+	if a["type"] != "Article" || a["id"] != "http://SKINNYTESTS:191/ap/@jose/10" {
+		t.Errorf("Expected article 10 to be featured, got %#v", a)
+	}
+
+	if code := pin(srv.handleUnpin(), `{"article_id": 10}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	if c := getTestFeatured(t, srv); c.TotalItems != 0 || len(c.OrderedItems) != 0 {
+		t.Errorf("Expected no featured articles, got %#v", c)
+	}
+}
+
+func TestFeaturedCollectionPrivateUser(t *testing.T) {
+	srv, db := newPinsTestServer(true)
+	db.posts[0].Pinned = true
+	db.posts[1].Pinned = true
+
+	c := getTestFeatured(t, srv)
+	if c.TotalItems != 2 || len(c.OrderedItems) != 0 {
+		t.Errorf("Expected only the count of private pins, got %#v", c)
+	}
+}
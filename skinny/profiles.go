@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+// handleFromActorID guesses the handle of a foreign actor from the last
+// segment of its id, as in "https://m.example/users/alice" or
+// "https://r.example/ap/@alice". It's only used when the actor document
+// can't be fetched any more.
+func handleFromActorID(id string) string {
+	u, err := url.Parse(id)
+	if err != nil {
+		return ""
+	}
+	p := strings.Split(strings.TrimRight(u.Path, "/"), "/")
+	return strings.TrimPrefix(p[len(p)-1], "@")
+}
+
+// foreignUserOf finds the foreign user for an actor. old is the actor as we
+// last saw it, if we have it, which is used as the handle may have changed.
+func (s *serverWrapper) foreignUserOf(ctx context.Context, id string, old *util.RemoteActor) (*pb.UsersEntry, error) {
+	handle := handleFromActorID(id)
+	if old != nil {
+		handle = old.PreferredUsername
+	}
+	host := (&util.RemoteActor{ID: id}).Host()
+	return util.GetAuthorFromDb(ctx, handle, host, false, 0, s.database)
+}
+
+// receiveActorUpdate refreshes our copy of a foreign user's profile when
+// they send an Update of themselves. The actor is fetched again rather than
+// trusting the object in the activity.
+//
+// As empty fields are ignored by the database, a cleared name or summary is
+// not copied over.
+func (s *serverWrapper) receiveActorUpdate(w http.ResponseWriter, actor, object string) {
+	if actor == "" || actor != object {
+		log.Printf("%#v tried to update actor %#v", actor, object)
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, "Actors can only update themselves.\n")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+	defer cancel()
+
+	old := s.remoteActors.Forget(actor)
+	a, err := s.remoteActors.FetchActor(ctx, actor)
+	if err != nil {
+		log.Printf("Could not fetch updated actor %#v. Error: %v", actor, err)
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "Could not fetch updated actor.\n")
+		return
+	}
+
+	u, err := s.foreignUserOf(ctx, actor, old)
+	if err == util.UserNotFoundErr {
+		// We don't have a copy of them to update.
+		log.Printf("Ignoring update of unknown actor %#v", actor)
+		fmt.Fprintf(w, "{}\n")
+		return
+	} else if err != nil {
+		log.Printf("Could not get updated user. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving update activity\n")
+		return
+	}
+
+	resp, err := s.database.Users(ctx, &pb.UsersRequest{
+		RequestType: pb.RequestType_UPDATE,
+		Match:       &pb.UsersEntry{GlobalId: u.GlobalId},
+		Entry: &pb.UsersEntry{
+			Handle:      a.PreferredUsername,
+			DisplayName: a.Name,
+			Bio:         a.Summary,
+		},
+	})
+	if err != nil {
+		log.Printf("Could not update user. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving update activity\n")
+		return
+	} else if resp.ResultType != pb.ResultType_OK {
+		log.Printf("Could not update user. Error: %v", resp.Error)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving update activity\n")
+		return
+	}
+
+	log.Printf("Updated profile of %#v\n", actor)
+	fmt.Fprintf(w, "{}\n")
+}
+
+// receiveActorDelete tombstones a foreign user who deleted their account,
+// removing their posts, likes, shares and follows. As the signature on the
+// activity needn't be the actor's own, the actor must be gone from its
+// server too.
+func (s *serverWrapper) receiveActorDelete(w http.ResponseWriter, actor string) {
+	if _, local := s.localHandleFromActorID(actor); local {
+		log.Printf("Received delete of local actor %#v", actor)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Cannot delete local users.\n")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+	defer cancel()
+
+	old := s.remoteActors.Forget(actor)
+	if _, err := s.remoteActors.FetchActor(ctx, actor); err == nil {
+		log.Printf("Received delete of actor %#v, which still exists", actor)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Actor has not been deleted.\n")
+		return
+	} else if err != util.ActorNotFoundErr {
+		log.Printf("Could not check deleted actor %#v. Error: %v", actor, err)
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintf(w, "Could not check deleted actor.\n")
+		return
+	}
+
+	u, err := s.foreignUserOf(ctx, actor, old)
+	if err == util.UserNotFoundErr {
+		log.Printf("Ignoring delete of unknown actor %#v", actor)
+		fmt.Fprintf(w, "{}\n")
+		return
+	} else if err != nil {
+		log.Printf("Could not get deleted user. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving delete activity.\n")
+		return
+	}
+
+	resp, err := s.database.TombstoneUser(ctx, &pb.TombstoneUserRequest{
+		GlobalId: u.GlobalId,
+		ActorId:  actor,
+	})
+	if err != nil {
+		log.Printf("Could not tombstone user. Error: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving delete activity.\n")
+		return
+	} else if resp.ResultType != pb.ResultType_OK {
+		log.Printf("Could not tombstone user. Error: %v", resp.Error)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Issue with receiving delete activity.\n")
+		return
+	}
+
+	if len(resp.PostIds) > 0 {
+		// The posts are already gone, so a stale search index is only logged.
+		sResp, err := s.search.Remove(ctx, &pb.RemoveRequest{GlobalIds: resp.PostIds})
+		if err != nil {
+			log.Printf("Could not remove posts of %#v from search. Error: %v", actor, err)
+		} else if sResp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not remove posts of %#v from search. Error: %v", actor, sResp.Error)
+		}
+	}
+
+	log.Printf("Tombstoned deleted actor %#v\n", actor)
+	fmt.Fprintf(w, "{}\n")
+}
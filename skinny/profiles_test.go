@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+// profileActorResolver serves actors as they are now, and remembers them as
+// they were cached before.
+type profileActorResolver struct {
+	actors map[string]*util.RemoteActor
+	cached map[string]*util.RemoteActor
+}
+
+func (r *profileActorResolver) FetchActor(_ context.Context, id string) (*util.RemoteActor, error) {
+	if a, ok := r.actors[id]; ok {
+		return a, nil
+	}
+	return nil, util.ActorNotFoundErr
+}
+
+func (r *profileActorResolver) Resolve(_ context.Context, handle, host string) (*util.RemoteActor, error) {
+	for _, a := range r.actors {
+		if a.PreferredUsername == handle && a.Host() == util.NormaliseHost(host) {
+			return a, nil
+		}
+	}
+	return nil, util.ActorNotFoundErr
+}
+
+func (r *profileActorResolver) Forget(id string) *util.RemoteActor {
+	a := r.cached[id]
+	delete(r.cached, id)
+	return a
+}
+
+func newProfilesTestServer(actor *util.RemoteActor) (*serverWrapper, *MemoryDatabaseFake) {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "oldname", Host: "https://remote.test", DisplayName: "Old"},
+		},
+	}
+	resolver := &profileActorResolver{
+		actors: map[string]*util.RemoteActor{},
+		cached: map[string]*util.RemoteActor{
+			testKeyOwner: {ID: testKeyOwner, PreferredUsername: "oldname"},
+		},
+	}
+	if actor != nil {
+		resolver.actors[actor.ID] = actor
+	}
+	srv.database = db
+	srv.remoteActors = resolver
+	return srv, db
+}
+
+func deliverToAlice(srv *serverWrapper, body string) int {
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+	signTestRequest(req, []byte(body))
+	req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+	res := httptest.NewRecorder()
+	srv.handleActorInbox()(res, req)
+	return res.Code
+}
+
+func TestHandleActorUpdate(t *testing.T) {
+	srv, db := newProfilesTestServer(&util.RemoteActor{
+		ID:                testKeyOwner,
+		Type:              "Person",
+		PreferredUsername: "sender",
+		Name:              "Remote Sender",
+		Summary:           "A new bio",
+		Inbox:             testKeyOwner + "/inbox",
+	})
+
+	// The object in the activity isn't trusted, the actor is fetched again.
+	body := `{"id": "http://remote.test/update/1", "type": "Update",
+		"actor": "http://remote.test/ap/@sender",
+		"object": {"id": "http://remote.test/ap/@sender", "type": "Person",
+			"preferredUsername": "sender", "name": "Not This"}}`
+	if code := deliverToAlice(srv, body); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	u := db.users[1]
+	if u.Handle != "sender" || u.DisplayName != "Remote Sender" || u.Bio != "A new bio" {
+		t.Errorf("Expected profile of sender to be refreshed, got %v", u)
+	}
+
+	body = `{"id": "http://remote.test/update/2", "type": "Update",
+		"actor": "http://remote.test/ap/@sender",
+		"object": {"id": "http://remote.test/ap/@dave", "type": "Person"}}`
+	if code := deliverToAlice(srv, body); code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden updating another actor, got %#v", code)
+	}
+}
+
+func TestHandleActorDelete(t *testing.T) {
+	body := `{"id": "http://remote.test/delete/1", "type": "Delete",
+		"actor": "http://remote.test/ap/@sender",
+		"object": "http://remote.test/ap/@sender"}`
+
+	srv, db := newProfilesTestServer(nil)
+	db.posts = []*pb.PostsEntry{
+		{GlobalId: 1, AuthorId: 1},
+		{GlobalId: 2, AuthorId: 2},
+	}
+	if code := deliverToAlice(srv, body); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	if len(db.tombstoned) != 1 || db.tombstoned[0] != 2 {
+		t.Errorf("Expected user 2 to be tombstoned, got %v", db.tombstoned)
+	}
+	if removed := srv.search.(*SearchFake).removed; len(removed) != 1 || removed[0] != 2 {
+		t.Errorf("Expected post 2 to be removed from search, got %v", removed)
+	}
+
+	// An actor which still exists hasn't been deleted.
+	srv, db = newProfilesTestServer(testRemoteActor)
+	if code := deliverToAlice(srv, body); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %#v", code)
+	}
+	if len(db.tombstoned) != 0 {
+		t.Errorf("Expected nobody to be tombstoned, got %v", db.tombstoned)
+	}
+}
+
+// goneActorTransport serves the test sender's actor document until gone is
+// set, and 410 Gone after that.
+type goneActorTransport struct {
+	gone bool
+}
+
+func (t *goneActorTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	res := httptest.NewRecorder()
+	if t.gone || r.URL.String() != testKeyOwner {
+		res.WriteHeader(http.StatusGone)
+		return res.Result(), nil
+	}
+	b, _ := x509.MarshalPKIXPublicKey(&testSigningKey.PublicKey)
+	p := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b})
+	fmt.Fprintf(res, `{"id": %q, "type": "Person",
+		"publicKey": {"id": %q, "owner": %q, "publicKeyPem": %q}}`,
+		testKeyOwner, testKeyID, testKeyOwner, p)
+	return res.Result(), nil
+}
+
+func TestHandleActorDeleteWithGoneKey(t *testing.T) {
+	srv, db := newProfilesTestServer(nil)
+	delete(srv.remoteActors.(*profileActorResolver).cached, testKeyOwner)
+	db.users[1].Handle = "sender"
+	db.follows = []*pb.Follow{{Follower: 1, Followed: 2}}
+	transport := &goneActorTransport{}
+	v := newSignatureVerifier(newPublicKeyFetcher(newActivityFetcher(&http.Client{Transport: transport})))
+	srv.sigVerifier = v
+
+	// We last fetched the sender's key while they still existed.
+	req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString("{}"))
+	signTestRequest(req, []byte("{}"))
+	if _, err := v.Verify(req, []byte("{}")); err != nil {
+		t.Fatalf("Could not verify request of existing actor: %v", err)
+	}
+	transport.gone = true
+	v.now = func() time.Time { return time.Now().Add(2 * publicKeyCacheTTL) }
+
+	// Only their Delete of themselves is accepted on that key now.
+	body := `{"id": "http://remote.test/notes/1/activity", "type": "Create",
+		"actor": "http://remote.test/ap/@sender",
+		"object": {"id": "http://remote.test/notes/1", "type": "Note"}}`
+	if code := deliverToAlice(srv, body); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized for a create, got %#v", code)
+	}
+
+	body = `{"id": "http://remote.test/delete/1", "type": "Delete",
+		"actor": "http://remote.test/ap/@sender",
+		"object": "http://remote.test/ap/@sender",
+		"to": "https://www.w3.org/ns/activitystreams#Public"}`
+	req, _ = http.NewRequest("POST", "/ap/inbox", bytes.NewBufferString(body))
+	signTestRequest(req, []byte(body))
+	res := httptest.NewRecorder()
+	srv.handleSharedInbox()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	if len(db.tombstoned) != 1 || db.tombstoned[0] != 2 {
+		t.Errorf("Expected user 2 to be tombstoned, got %v", db.tombstoned)
+	}
+}
+
+func TestHandleFromActorID(t *testing.T) {
+	for id, want := range map[string]string{
+		"https://m.example/users/alice": "alice",
+		"https://r.example/ap/@alice":   "alice",
+		"https://r.example/ap/@alice/":  "alice",
+		"https://m.example/":            "",
+	} {
+		if got := handleFromActorID(id); got != want {
+			t.Errorf("handleFromActorID(%#v) = %#v, want %#v", id, got, want)
+		}
+	}
+}
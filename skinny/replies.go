@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+// postAPID returns the ActivityPub id of a post, which for local posts is
+// built from the handle of their author.
+func (s *serverWrapper) postAPID(ctx context.Context, p *pb.PostsEntry) (string, error) {
+	if p.ApId != "" {
+		return p.ApId, nil
+	}
+	author, err := util.GetAuthorFromDb(ctx, "", "", false, p.AuthorId, s.database)
+	if err != nil {
+		return "", err
+	}
+	return s.articleAPID(author, "", p.GlobalId), nil
+}
+
+// postAPIDByGlobalID returns the ActivityPub id of the post with the given
+// global id.
+func (s *serverWrapper) postAPIDByGlobalID(ctx context.Context, globalID int64) (string, error) {
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{GlobalId: globalID},
+	})
+	if err != nil {
+		return "", err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return "", fmt.Errorf("could not find post %d: %s", globalID, resp.Error)
+	} else if len(resp.Results) == 0 {
+		return "", fmt.Errorf("no post %d", globalID)
+	}
+	return s.postAPID(ctx, resp.Results[0])
+}
+
+// checkCanReply returns an error if the user with the given global id can't
+// reply to the post with the global id parentID, because it doesn't exist or
+// its author is private and not followed by the user.
+func (s *serverWrapper) checkCanReply(ctx context.Context, globalID, parentID int64) error {
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{GlobalId: parentID},
+	})
+	if err != nil {
+		return err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return fmt.Errorf("could not find post %d: %s", parentID, resp.Error)
+	} else if len(resp.Results) == 0 {
+		return fmt.Errorf("no post %d", parentID)
+	}
+	author, err := util.GetAuthorFromDb(ctx, "", "", false, resp.Results[0].AuthorId, s.database)
+	if err != nil {
+		return err
+	}
+	if !s.canSee(ctx, globalID, true, author) {
+		return fmt.Errorf("user %d doesn't follow private user %#v", globalID, author.Handle)
+	}
+	return nil
+}
+
+// replyParentID finds the global id of the post with the ActivityPub id
+// inReplyTo, or 0 if we don't have it. Our own posts may not have their id
+// stored, so it is read from their URL instead, and they are only taken as
+// the parent if the URL names their author and actor, who is replying, may
+// see them.
+func (s *serverWrapper) replyParentID(ctx context.Context, actor, inReplyTo string) (int64, error) {
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{ApId: inReplyTo},
+	})
+	if err != nil {
+		return 0, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return 0, fmt.Errorf("could not find post %s: %s", inReplyTo, resp.Error)
+	} else if len(resp.Results) > 0 {
+		return resp.Results[0].GlobalId, nil
+	}
+
+	u, err := url.Parse(inReplyTo)
+	if err != nil || !s.isLocalHost(u.Host) {
+		return 0, nil
+	}
+	t, err := parseLocalInteraction(u)
+	if err != nil || t.ArticleID == 0 {
+		return 0, nil
+	}
+
+	resp, err = s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{GlobalId: t.ArticleID},
+	})
+	if err != nil {
+		return 0, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return 0, fmt.Errorf("could not find post %d: %s", t.ArticleID, resp.Error)
+	} else if len(resp.Results) == 0 {
+		return 0, nil
+	}
+	author, err := util.GetAuthorFromDb(ctx, "", "", false, resp.Results[0].AuthorId, s.database)
+	if err != nil {
+		return 0, err
+	}
+	if author.Handle != t.Handle || author.Host != "" {
+		log.Printf("%#v is not by %#v", inReplyTo, author.Handle)
+		return 0, nil
+	}
+	replier, err := s.actorGlobalID(ctx, actor)
+	if !s.canSee(ctx, replier, err == nil, author) {
+		log.Printf("%#v can't reply to %#v of private user %#v", actor, inReplyTo, author.Handle)
+		return 0, nil
+	}
+	return t.ArticleID, nil
+}
+
+// getReplies finds the replies to a post, oldest first.
+func (s *serverWrapper) getReplies(ctx context.Context, globalID int64) ([]*pb.PostsEntry, error) {
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{InReplyTo: globalID},
+	})
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get replies: %s", resp.Error)
+	}
+	sort.SliceStable(resp.Results, func(i, j int) bool {
+		return resp.Results[i].GlobalId < resp.Results[j].GlobalId
+	})
+	return resp.Results, nil
+}
+
+// visibleReplies drops the replies the user with the given global id, if
+// known, can't see because their authors are private.
+func (s *serverWrapper) visibleReplies(ctx context.Context, replies []*pb.PostsEntry, globalID int64, known bool) []*pb.PostsEntry {
+	visible := map[int64]bool{}
+	shown := []*pb.PostsEntry{}
+	for _, reply := range replies {
+		ok, checked := visible[reply.AuthorId]
+		if !checked {
+			author, err := util.GetAuthorFromDb(ctx, "", "", false, reply.AuthorId, s.database)
+			if err != nil {
+				log.Printf("Skipping reply %d: %v", reply.GlobalId, err)
+				continue
+			}
+			ok = s.canSee(ctx, globalID, known, author)
+			visible[reply.AuthorId] = ok
+		}
+		if ok {
+			shown = append(shown, reply)
+		}
+	}
+	return shown
+}
+
+// handleRepliesCollection serves the ids of the direct replies to a local
+// post as an OrderedCollection, oldest first. For private authors only the
+// number of replies is shown, unless it's fetched by one of their followers,
+// and replies from private users are only listed for their followers.
+func (s *serverWrapper) handleRepliesCollection() http.HandlerFunc {
+	const repliesErr = "Could not create replies collection.\n"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := getCollectionPage(r)
+		if err != nil {
+			log.Printf("Bad replies request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		author, p, ok := s.getLocalPost(ctx, w, r)
+		if !ok {
+			return
+		}
+
+		replies, err := s.getReplies(ctx, p.GlobalId)
+		if err != nil {
+			log.Printf("Could not get replies to %d: %v", p.GlobalId, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, repliesErr)
+			return
+		}
+
+		id := s.articleAPID(author, p.ApId, p.GlobalId) + "/replies"
+		fetcher, known := s.fetcherGlobalID(ctx, r)
+		var c *OrderedCollectionStruct
+		if !s.canSee(ctx, fetcher, known, author) {
+			c = newCollectionPage(id, 0, nil)
+			c.TotalItems = len(replies)
+		} else {
+			replies = s.visibleReplies(ctx, replies, fetcher, known)
+			items := make([]interface{}, len(replies))
+			for i, reply := range replies {
+				items[i] = reply
+			}
+			c = newCollectionPage(id, page, items)
+		}
+
+		// Only the replies on the page need their ids built.
+		ids := []interface{}{}
+		for _, item := range c.OrderedItems {
+			reply := item.(*pb.PostsEntry)
+			apID, err := s.postAPID(ctx, reply)
+			if err != nil {
+				log.Printf("Skipping reply %d to %d: %v", reply.GlobalId, p.GlobalId, err)
+				continue
+			}
+			ids = append(ids, apID)
+		}
+		c.OrderedItems = ids
+
+		if err := writeActivityJSON(w, c); err != nil {
+			log.Printf("Could not marshal replies collection: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
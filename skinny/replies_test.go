@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	wrapperpb "github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+// newRepliesTestServer sets up a server where alice wrote article 10, which
+// has a reply from bob and, before that, one from a remote user.
+func newRepliesTestServer() *serverWrapper {
+	srv := newTestServerWrapper()
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		posts: []*pb.PostsEntry{
+			{GlobalId: 10, AuthorId: 1, Title: "Hello"},
+			{GlobalId: 12, AuthorId: 2, Body: "Hi alice", InReplyTo: 10},
+			{GlobalId: 11, AuthorId: 3, ApId: testRemotePost, InReplyTo: 10},
+		},
+	}
+	return srv
+}
+
+func getTestReplies(t *testing.T, srv *serverWrapper, id, query string) *OrderedCollectionStruct {
+	req, _ := http.NewRequest("GET", "/ap/@alice/"+id+"/replies"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "alice", "article_id": id})
+	res := httptest.NewRecorder()
+	srv.handleRepliesCollection()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var c OrderedCollectionStruct
+	if err := json.Unmarshal(res.Body.Bytes(), &c); err != nil {
+		t.Fatalf("Could not decode replies %#v: %v", res.Body.String(), err)
+	}
+	return &c
+}
+
+func TestHandleRepliesCollection(t *testing.T) {
+	srv := newRepliesTestServer()
+	const id = "http://SKINNYTESTS:191/ap/@alice/10/replies"
+
+	c := getTestReplies(t, srv, "10", "")
+	if c.ID != id || c.TotalItems != 2 || c.First != id+"?page=1" {
+		t.Errorf("Expected collection of 2 replies, got %#v", c)
+	}
+
+	c = getTestReplies(t, srv, "10", "?page=1")
+	want := []interface{}{testRemotePost, "http://SKINNYTESTS:191/ap/@bob/12"}
+	if !reflect.DeepEqual(c.OrderedItems, want) {
+		t.Errorf("Expected replies %v, got %v", want, c.OrderedItems)
+	}
+}
+
+func TestHandleRepliesCollectionPrivate(t *testing.T) {
+	srv := newRepliesTestServer()
+	db := srv.database.(*MemoryDatabaseFake)
+
+	// Replies from private users are only listed for their followers.
+	db.users[1].Private = &wrapperpb.BoolValue{Value: true}
+	c := getTestReplies(t, srv, "10", "?page=1")
+	if want := []interface{}{testRemotePost}; !reflect.DeepEqual(c.OrderedItems, want) {
+		t.Errorf("Expected replies %v, got %v", want, c.OrderedItems)
+	}
+
+	// Only the number of replies to a private user's article is shown.
+	db.users[0].Private = &wrapperpb.BoolValue{Value: true}
+	c = getTestReplies(t, srv, "10", "?page=1")
+	if c.TotalItems != 2 || len(c.OrderedItems) != 0 {
+		t.Errorf("Expected only the number of replies, got %#v", c)
+	}
+}
+
+func TestReplyArticleObject(t *testing.T) {
+	srv := newRepliesTestServer()
+	req, _ := http.NewRequest("GET", "/ap/@bob/12", nil)
+	req = mux.SetURLVars(req, map[string]string{"username": "bob", "article_id": "12"})
+	res := httptest.NewRecorder()
+	srv.handleAPArticle()(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", res.Code)
+	}
+	var a ArticleContentStruct
+	json.Unmarshal(res.Body.Bytes(), &a)
+	if a.Type != "Note" || a.InReplyTo != "http://SKINNYTESTS:191/ap/@alice/10" {
+		t.Errorf("Expected a Note in reply to alice's article, got %#v", a)
+	}
+}
+
+func TestReplyParentID(t *testing.T) {
+	srv := newRepliesTestServer()
+	check := func(actor, inReplyTo string, want int64) {
+		t.Helper()
+		got, err := srv.replyParentID(context.Background(), actor, inReplyTo)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", inReplyTo, err)
+		} else if got != want {
+			t.Errorf("%s: expected parent %d, got %d", inReplyTo, want, got)
+		}
+	}
+	check(testKeyOwner, testRemotePost, 11)
+	check(testKeyOwner, "http://SKINNYTESTS:191/ap/@alice/10", 10)
+	check(testKeyOwner, "http://remote.test/notes/2", 0)
+	check(testKeyOwner, "http://SKINNYTESTS:191/about", 0)
+	// Local posts must exist and be by the user their URL names.
+	check(testKeyOwner, "http://SKINNYTESTS:191/ap/@alice/99", 0)
+	check(testKeyOwner, "http://SKINNYTESTS:191/ap/@bob/10", 0)
+
+	// Only followers of a private user may reply to their posts.
+	db := srv.database.(*MemoryDatabaseFake)
+	db.users[0].Private = &wrapperpb.BoolValue{Value: true}
+	check(testKeyOwner, "http://SKINNYTESTS:191/ap/@alice/10", 0)
+	check("http://remote.test/ap/@stranger", "http://SKINNYTESTS:191/ap/@alice/10", 0)
+	db.follows = []*pb.Follow{{Follower: 3, Followed: 1}}
+	check(testKeyOwner, "http://SKINNYTESTS:191/ap/@alice/10", 10)
+}
+
+func TestHandleCreateReply(t *testing.T) {
+	srv := newRepliesTestServer()
+	article := &ArticleFake{}
+	srv.article = article
+	create := func(inReplyTo string) int {
+		body := `{"body": "Hi", "creation_datetime": "2019-01-01T00:00:00.000Z", "in_reply_to": ` + inReplyTo + `}`
+		req, _ := http.NewRequest("POST", "/c2s/create_article", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		srv.handleCreateArticle()(res, req)
+		return res.Code
+	}
+
+	if code := create("10"); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	if article.na.InReplyTo != 10 {
+		t.Errorf("Expected a reply to article 10, got %v", article.na)
+	}
+
+	if code := create("99"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found replying to a missing article, got %#v", code)
+	}
+
+	// Only followers can reply to private users.
+	db := srv.database.(*MemoryDatabaseFake)
+	db.users[0].Private = &wrapperpb.BoolValue{Value: true}
+	if code := create("10"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found replying to a private user, got %#v", code)
+	}
+	db.follows = []*pb.Follow{{Follower: 0, Followed: 1}}
+	if code := create("10"); code != http.StatusOK {
+		t.Errorf("Expected 200 OK replying to a followed private user, got %#v", code)
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/gorilla/mux"
+)
+
+const (
+	reportTargetRequired = "Must give exactly one of article_id or user"
+	reportTargetNotFound = "Could not find what is being reported"
+)
+
+// reportStates are the names of report states used by the c2s endpoints.
+var reportStates = map[pb.ReportEntry_State]string{
+	pb.ReportEntry_OPEN:      "open",
+	pb.ReportEntry_RESOLVED:  "resolved",
+	pb.ReportEntry_DISMISSED: "dismissed",
+}
+
+type flagActivity struct {
+	ID      string   `json:"id"`
+	Actor   string   `json:"actor"`
+	Object  []string `json:"object"`
+	Content string   `json:"content"`
+	Type    string   `json:"type"`
+}
+
+// isLocalObject checks if an ActivityPub id is of a local user or post.
+func (s *serverWrapper) isLocalObject(id string) bool {
+	return strings.HasPrefix(id, s.localActorID(""))
+}
+
+// addReport stores a new open report, returning its id.
+func (s *serverWrapper) addReport(ctx context.Context, e *pb.ReportEntry) (int64, error) {
+	e.CreationDatetime = ptypes.TimestampNow()
+	resp, err := s.database.Reports(ctx, &pb.ReportsRequest{
+		RequestType: pb.RequestType_INSERT,
+		Entry:       e,
+	})
+	if err != nil {
+		return 0, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return 0, fmt.Errorf("could not add report: %s", resp.Error)
+	}
+	return resp.GlobalId, nil
+}
+
+// handleFlagActivity puts a report from another instance about local users
+// or posts in the moderation queue. Anything else it reports is left out, as
+// it isn't ours to moderate.
+func (s *serverWrapper) handleFlagActivity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := mux.Vars(r)
+		recipient := v["username"]
+		log.Printf("User %v received a flag activity.\n", recipient)
+
+		decoder := json.NewDecoder(r.Body)
+		var t flagActivity
+		if err := decoder.Decode(&t); err != nil {
+			log.Printf("Invalid JSON\n")
+			log.Printf("Error: %s\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON\n")
+			return
+		}
+
+		if bad := s.blacklist.Actors(w, t.Actor); bad {
+			return
+		}
+
+		var objects []string
+		for _, o := range t.Object {
+			if s.isLocalObject(o) {
+				objects = append(objects, o)
+			}
+		}
+		if len(objects) == 0 {
+			log.Printf("Flag from %#v reports nothing local: %v", t.Actor, t.Object)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Flag must report local users or articles.\n")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		id, err := s.addReport(ctx, &pb.ReportEntry{
+			Reporter: t.Actor,
+			Objects:  objects,
+			Comment:  t.Content,
+			ApId:     t.ID,
+		})
+		if err != nil {
+			log.Printf("Could not receive flag activity. Error: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Issue with receiving flag activity.\n")
+			return
+		}
+
+		log.Printf("Flag activity received successfully as report %d.", id)
+		fmt.Fprintf(w, "{}\n")
+	}
+}
+
+type reportStruct struct {
+	ArticleID int64  `json:"article_id"`
+	User      string `json:"user"`
+	Comment   string `json:"comment"`
+}
+
+type reportResp struct {
+	Error string `json:"error"`
+	ID    int64  `json:"id"`
+}
+
+// userActorID finds the ActivityPub id of a user given as a handle or
+// handle@host. For foreign users their actor is also returned.
+func (s *serverWrapper) userActorID(ctx context.Context, user string) (string, *util.RemoteActor, error) {
+	handle, host, err := util.ParseUsername(user)
+	if err != nil {
+		return "", nil, err
+	}
+	if host == "" {
+		if _, err := util.GetAuthorFromDb(ctx, handle, "", true, 0, s.database); err != nil {
+			return "", nil, err
+		}
+		return s.localActorID(handle), nil, nil
+	}
+	actor, err := s.remoteActors.Resolve(ctx, handle, host)
+	if err != nil {
+		return "", nil, err
+	}
+	return actor.ID, actor, nil
+}
+
+// reportTarget finds the ActivityPub ids of what a report is about. A
+// reported article is reported along with its author.
+func (s *serverWrapper) reportTarget(ctx context.Context, t *reportStruct) ([]string, *util.RemoteActor, error) {
+	if t.ArticleID == 0 {
+		id, actor, err := s.userActorID(ctx, t.User)
+		return []string{id}, actor, err
+	}
+
+	resp, err := s.database.Posts(ctx, &pb.PostsRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.PostsEntry{GlobalId: t.ArticleID},
+	})
+	if err != nil {
+		return nil, nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, nil, fmt.Errorf("could not get article: %s", resp.Error)
+	} else if len(resp.Results) != 1 {
+		return nil, nil, fmt.Errorf("expected 1 article, got %d", len(resp.Results))
+	}
+	p := resp.Results[0]
+	author, err := util.GetAuthorFromDb(ctx, "", "", false, p.AuthorId, s.database)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := author.Handle
+	if author.Host != "" {
+		user = author.Handle + "@" + author.Host
+	}
+	authorID, actor, err := s.userActorID(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{authorID, s.articleAPID(author, p.ApId, p.GlobalId)}, actor, nil
+}
+
+// handleReport lets a local user report a user or article to the admins of
+// this instance. If it is from another instance the report is also sent to
+// that instance as a Flag activity.
+func (s *serverWrapper) handleReport() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+
+		handle, err := s.getSessionHandle(r)
+		if err != nil {
+			log.Printf("Call to report by not logged in user")
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&reportResp{Error: loginRequired})
+			return
+		}
+		globalID, err := s.getSessionGlobalID(r)
+		if err != nil {
+			log.Printf("Could not get global id of %#v: %v", handle, err)
+			w.WriteHeader(http.StatusForbidden)
+			enc.Encode(&reportResp{Error: loginRequired})
+			return
+		}
+
+		var t reportStruct
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&reportResp{Error: invalidJSONError})
+			return
+		}
+		if (t.ArticleID == 0) == (t.User == "") {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&reportResp{Error: reportTargetRequired})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		objects, actor, err := s.reportTarget(ctx, &t)
+		if err != nil {
+			log.Printf("Could not find target of report by %#v: %v", handle, err)
+			w.WriteHeader(http.StatusNotFound)
+			enc.Encode(&reportResp{Error: reportTargetNotFound})
+			return
+		}
+
+		if actor != nil {
+			resp, err := s.s2sFlag.SendFlagActivity(ctx, &pb.FlagDetails{
+				ReporterId: globalID,
+				Objects:    objects,
+				Comment:    t.Comment,
+				Inbox:      actor.Inbox,
+			})
+			if err != nil || resp.ResultType != pb.ResultType_OK {
+				if err == nil {
+					err = fmt.Errorf("%s", resp.Error)
+				}
+				log.Printf("Could not send flag to %#v: %v", actor.Inbox, err)
+				w.WriteHeader(http.StatusBadGateway)
+				enc.Encode(&reportResp{Error: "Could not send report to " + actor.Host()})
+				return
+			}
+		}
+
+		id, err := s.addReport(ctx, &pb.ReportEntry{
+			Reporter: s.localActorID(handle),
+			Objects:  objects,
+			Comment:  t.Comment,
+		})
+		if err != nil {
+			log.Printf("Could not add report by %#v: %v", handle, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&reportResp{Error: "Could not save report"})
+			return
+		}
+		log.Printf("User %#v filed report %d about %v", handle, id, objects)
+		enc.Encode(&reportResp{ID: id})
+	}
+}
+
+type reportJSON struct {
+	ID       int64    `json:"id"`
+	Reporter string   `json:"reporter"`
+	Objects  []string `json:"objects"`
+	Comment  string   `json:"comment"`
+	State    string   `json:"state"`
+	Created  string   `json:"created"`
+	ApID     string   `json:"ap_id,omitempty"`
+}
+
+type reportsResp struct {
+	Error   string        `json:"error"`
+	Reports []*reportJSON `json:"reports"`
+}
+
+// handleReports lists reports for admins, newest first. The state query
+// parameter picks which are listed: open (the default), resolved, dismissed
+// or all.
+func (s *serverWrapper) handleReports() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		if _, ok := s.requireAdmin(w, r); !ok {
+			enc.Encode(&reportsResp{Error: adminRequired})
+			return
+		}
+
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = reportStates[pb.ReportEntry_OPEN]
+		}
+		known := state == "all"
+		for _, name := range reportStates {
+			known = known || state == name
+		}
+		if !known {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&reportsResp{Error: "Unknown report state " + state})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.database.Reports(ctx, &pb.ReportsRequest{
+			RequestType: pb.RequestType_FIND,
+		})
+		if err != nil || resp.ResultType != pb.ResultType_OK {
+			if err == nil {
+				err = fmt.Errorf("%s", resp.Error)
+			}
+			log.Printf("Could not get reports: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&reportsResp{Error: "Could not get reports"})
+			return
+		}
+
+		reports := []*reportJSON{}
+		for _, e := range resp.Results {
+			if state != "all" && reportStates[e.State] != state {
+				continue
+			}
+			reports = append(reports, &reportJSON{
+				ID:       e.GlobalId,
+				Reporter: e.Reporter,
+				Objects:  e.Objects,
+				Comment:  e.Comment,
+				State:    reportStates[e.State],
+				Created:  util.ConvertPbTimestamp(e.CreationDatetime),
+				ApID:     e.ApId,
+			})
+		}
+		enc.Encode(&reportsResp{Reports: reports})
+	}
+}
+
+type reportIDStruct struct {
+	ID int64 `json:"id"`
+}
+
+// handleReportModify sets the state of a report, for admins.
+func (s *serverWrapper) handleReportModify(state pb.ReportEntry_State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		handle, ok := s.requireAdmin(w, r)
+		if !ok {
+			enc.Encode(&reportResp{Error: adminRequired})
+			return
+		}
+
+		var t reportIDStruct
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			log.Printf(invalidJSONErrorWithPrint, err)
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(&reportResp{Error: invalidJSONError})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		resp, err := s.database.Reports(ctx, &pb.ReportsRequest{
+			RequestType: pb.RequestType_UPDATE,
+			Match:       &pb.ReportEntry{GlobalId: t.ID},
+			Entry:       &pb.ReportEntry{State: state},
+		})
+		if err != nil {
+			log.Printf("Could not update report %d: %v", t.ID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&reportResp{Error: "Could not update report"})
+			return
+		} else if resp.ResultType == pb.ResultType_ERROR_400 {
+			w.WriteHeader(http.StatusNotFound)
+			enc.Encode(&reportResp{Error: resp.Error})
+			return
+		} else if resp.ResultType != pb.ResultType_OK {
+			log.Printf("Could not update report %d: %v", t.ID, resp.Error)
+			w.WriteHeader(http.StatusInternalServerError)
+			enc.Encode(&reportResp{Error: "Could not update report"})
+			return
+		}
+		log.Printf("Admin %#v marked report %d %s", handle, t.ID, reportStates[state])
+		enc.Encode(&reportResp{ID: t.ID})
+	}
+}
+
+// handleReportResolve marks a report as acted on, for admins.
+func (s *serverWrapper) handleReportResolve() http.HandlerFunc {
+	return s.handleReportModify(pb.ReportEntry_RESOLVED)
+}
+
+// handleReportDismiss marks a report as needing no action, for admins.
+func (s *serverWrapper) handleReportDismiss() http.HandlerFunc {
+	return s.handleReportModify(pb.ReportEntry_DISMISSED)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+type FlagFake struct {
+	pb.S2SFlagClient
+
+	rq *pb.FlagDetails
+}
+
+func (f *FlagFake) SendFlagActivity(_ context.Context, r *pb.FlagDetails, _ ...grpc.CallOption) (*pb.GeneralResponse, error) {
+	f.rq = r
+	return &pb.GeneralResponse{ResultType: pb.ResultType_OK}, nil
+}
+
+func newReportsTestServer() (*serverWrapper, *MemoryDatabaseFake, *FlagFake) {
+	srv := newTestServerWrapper()
+	db := &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "jose"},
+			{GlobalId: 2, Handle: "alice"},
+			{GlobalId: 3, Handle: "sender", Host: "https://remote.test"},
+		},
+		posts: []*pb.PostsEntry{
+			{GlobalId: 10, AuthorId: 2},
+			{GlobalId: 11, AuthorId: 3, ApId: "http://remote.test/ap/@sender/7"},
+		},
+	}
+	flag := &FlagFake{}
+	srv.database = db
+	srv.s2sFlag = flag
+	return srv, db, flag
+}
+
+func TestHandleFlagActivity(t *testing.T) {
+	srv, db, _ := newReportsTestServer()
+
+	deliver := func(body string) int {
+		req, _ := http.NewRequest("POST", "/ap/@alice/inbox", bytes.NewBufferString(body))
+		signTestRequest(req, []byte(body))
+		req = mux.SetURLVars(req, map[string]string{"username": "alice"})
+		res := httptest.NewRecorder()
+		srv.handleActorInbox()(res, req)
+		return res.Code
+	}
+
+	body := `{"id": "http://remote.test/flag/1", "type": "Flag",
+		"actor": "http://remote.test/ap/@sender", "content": "spam",
+		"object": ["http://SKINNYTESTS:191/ap/@alice", "http://SKINNYTESTS:191/ap/@alice/10",
+			"http://remote.test/ap/@sender/7"]}`
+	if code := deliver(body); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %#v", code)
+	}
+	if len(db.reports) != 1 {
+		t.Fatalf("Expected 1 report, got %v", db.reports)
+	}
+	r := db.reports[0]
+	want := []string{"http://SKINNYTESTS:191/ap/@alice", "http://SKINNYTESTS:191/ap/@alice/10"}
+	if !reflect.DeepEqual(r.Objects, want) {
+		t.Errorf("Expected only local objects %v, got %v", want, r.Objects)
+	}
+	if r.Reporter != "http://remote.test/ap/@sender" || r.Comment != "spam" ||
+		r.ApId != "http://remote.test/flag/1" {
+		t.Errorf("Unexpected report %v", r)
+	}
+
+	// A single object is accepted, but it must be local.
+	body = `{"id": "http://remote.test/flag/2", "type": "Flag",
+		"actor": "http://remote.test/ap/@sender",
+		"object": "http://remote.test/ap/@sender/7"}`
+	if code := deliver(body); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %#v", code)
+	}
+}
+
+func TestHandleReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		code    int
+		objects []string
+		flag    *pb.FlagDetails
+	}{
+		{
+			name:    "local article",
+			body:    `{"article_id": 10, "comment": "rude"}`,
+			code:    http.StatusOK,
+			objects: []string{"http://SKINNYTESTS:191/ap/@alice", "http://SKINNYTESTS:191/ap/@alice/10"},
+		},
+		{
+			name:    "foreign article",
+			body:    `{"article_id": 11, "comment": "spam"}`,
+			code:    http.StatusOK,
+			objects: []string{testKeyOwner, "http://remote.test/ap/@sender/7"},
+			flag: &pb.FlagDetails{
+				ReporterId: 0,
+				Objects:    []string{testKeyOwner, "http://remote.test/ap/@sender/7"},
+				Comment:    "spam",
+				Inbox:      testKeyOwner + "/inbox",
+			},
+		},
+		{
+			name:    "foreign user",
+			body:    `{"user": "sender@remote.test"}`,
+			code:    http.StatusOK,
+			objects: []string{testKeyOwner},
+			flag: &pb.FlagDetails{
+				Objects: []string{testKeyOwner},
+				Inbox:   testKeyOwner + "/inbox",
+			},
+		},
+		{
+			name: "unknown user",
+			body: `{"user": "nobody"}`,
+			code: http.StatusNotFound,
+		},
+		{
+			name: "user and article",
+			body: `{"user": "alice", "article_id": 10}`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		srv, db, flag := newReportsTestServer()
+		req, _ := http.NewRequest("POST", "/c2s/report", bytes.NewBufferString(tc.body))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		srv.handleReport()(res, req)
+
+		if res.Code != tc.code {
+			t.Errorf("%s: Expected %d, got %#v", tc.name, tc.code, res.Code)
+			continue
+		}
+		if !reflect.DeepEqual(flag.rq, tc.flag) {
+			t.Errorf("%s: Expected flag %v, got %v", tc.name, tc.flag, flag.rq)
+		}
+		if tc.objects == nil {
+			if len(db.reports) != 0 {
+				t.Errorf("%s: Expected no report, got %v", tc.name, db.reports)
+			}
+			continue
+		}
+		if len(db.reports) != 1 {
+			t.Fatalf("%s: Expected 1 report, got %v", tc.name, db.reports)
+		}
+		if r := db.reports[0]; !reflect.DeepEqual(r.Objects, tc.objects) ||
+			r.Reporter != "http://SKINNYTESTS:191/ap/@jose" {
+			t.Errorf("%s: Expected report by jose of %v, got %v", tc.name, tc.objects, r)
+		}
+	}
+}
+
+func TestHandleReportsAdmin(t *testing.T) {
+	srv, db, _ := newReportsTestServer()
+	db.reports = []*pb.ReportEntry{
+		{GlobalId: 1, Reporter: testKeyOwner, Objects: []string{"http://SKINNYTESTS:191/ap/@alice"}},
+		{GlobalId: 2, Reporter: testKeyOwner, Objects: []string{"http://SKINNYTESTS:191/ap/@bob"}},
+	}
+
+	list := func(state string) (int, []int64) {
+		req, _ := http.NewRequest("GET", "/c2s/admin/reports?state="+state, nil)
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		srv.handleReports()(res, req)
+		var r reportsResp
+		json.Unmarshal(res.Body.Bytes(), &r)
+		ids := []int64{}
+		for _, report := range r.Reports {
+			ids = append(ids, report.ID)
+		}
+		return res.Code, ids
+	}
+	modify := func(h http.HandlerFunc, body string) int {
+		req, _ := http.NewRequest("POST", "/c2s/admin/reports/resolve", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		addFakeSession(srv, res, req)
+		h(res, req)
+		return res.Code
+	}
+
+	if code, _ := list(""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for non-admin, got %#v", code)
+	}
+	if code := modify(srv.handleReportResolve(), `{"id": 1}`); code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for non-admin, got %#v", code)
+	}
+
+	srv.admins = parseAdmins("jose")
+	if code, ids := list(""); code != http.StatusOK || !reflect.DeepEqual(ids, []int64{2, 1}) {
+		t.Errorf("Expected open reports [2 1], got %#v %v", code, ids)
+	}
+	if code := modify(srv.handleReportResolve(), `{"id": 1}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	if code := modify(srv.handleReportDismiss(), `{"id": 2}`); code != http.StatusOK {
+		t.Errorf("Expected 200 OK, got %#v", code)
+	}
+	if code := modify(srv.handleReportDismiss(), `{"id": 3}`); code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found, got %#v", code)
+	}
+
+	for state, want := range map[string][]int64{
+		"open":      {},
+		"resolved":  {1},
+		"dismissed": {2},
+		"all":       {2, 1},
+	} {
+		if _, ids := list(state); !reflect.DeepEqual(ids, want) {
+			t.Errorf("Expected %s reports %v, got %v", state, want, ids)
+		}
+	}
+	if code, _ := list("pending"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request for unknown state, got %#v", code)
+	}
+}
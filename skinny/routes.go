@@ -50,6 +50,7 @@ func (s *serverWrapper) setupRoutes() {
 
 	r.HandleFunc("/c2s/feed", s.handleFeed())
 	r.HandleFunc("/c2s/feed/{userId}", s.handleFeed())
+	r.HandleFunc("/c2s/mentions", s.handleMentions())
 	r.HandleFunc("/c2s/search", s.handleSearch())
 	r.HandleFunc("/c2s/@{username}", s.handleFeedPerUser())
 	r.HandleFunc("/c2s/{userId}/rss", s.handleRssPerUser())
@@ -64,6 +65,7 @@ func (s *serverWrapper) setupRoutes() {
 	r.HandleFunc("/c2s/update/user_feed", s.handleUserFeedUpdate())
 	r.HandleFunc("/c2s/update/user", s.handleUserUpdate())
 	r.HandleFunc("/c2s/update/user_pic", s.handleUserUpdateProfilePic())
+	r.HandleFunc("/c2s/update/user_header", s.handleUserUpdateHeader())
 	r.HandleFunc("/c2s/{userId}/recommend_follows",
 		s.getNoOpServiceHandler(followServiceLocationEnv, s.handleRecommendFollows()))
 	r.HandleFunc("/c2s/recommend_posts",
@@ -76,9 +78,24 @@ func (s *serverWrapper) setupRoutes() {
 	r.HandleFunc("/c2s/follows/accept", s.handleAcceptFollow())
 	r.HandleFunc("/c2s/announce", s.handleAnnounce())
 	r.HandleFunc("/c2s/like", s.handleLike())
+	r.HandleFunc("/c2s/report", s.handleReport())
+	r.HandleFunc("/c2s/pin", s.handlePin())
+	r.HandleFunc("/c2s/unpin", s.handleUnpin())
+	r.HandleFunc("/c2s/aliases", s.handleAliases())
+	r.HandleFunc("/c2s/aliases/add", s.handleAliasAdd())
+	r.HandleFunc("/c2s/aliases/remove", s.handleAliasRemove())
+	r.HandleFunc("/c2s/move", s.handleMove())
+	r.HandleFunc("/c2s/authorize_interaction", s.handleInteract())
 
 	r.HandleFunc("/c2s/track_view", s.handleTrackView())
 	r.HandleFunc("/c2s/add_log", s.handleAddLog())
+	r.HandleFunc("/c2s/admin/blacklist", s.handleBlacklist())
+	r.HandleFunc("/c2s/admin/blacklist/add", s.handleBlacklistAdd())
+	r.HandleFunc("/c2s/admin/blacklist/remove", s.handleBlacklistRemove())
+	r.HandleFunc("/c2s/admin/inbox/dead", s.handleInboxDeadLetters())
+	r.HandleFunc("/c2s/admin/reports", s.handleReports())
+	r.HandleFunc("/c2s/admin/reports/resolve", s.handleReportResolve())
+	r.HandleFunc("/c2s/admin/reports/dismiss", s.handleReportDismiss())
 
 	approvalHandler := s.handleApprovalActivity()
 	// ActorInbox routes are routed based on the activity type
@@ -92,16 +109,34 @@ func (s *serverWrapper) setupRoutes() {
 		"reject":   approvalHandler,
 		"announce": s.handleAnnounceActivity(),
 		"update":   s.handleUpdateActivity(),
+		"block":    s.handleBlockActivity(),
+		"flag":     s.handleFlagActivity(),
+		"move":     s.handleMoveActivity(),
 	}
 	s.undoActivityRouter = map[string]http.HandlerFunc{
-		"like":   s.handleLikeUndoActivity(),
-		"follow": s.handleFollowUndoActivity(),
+		"like":     s.handleLikeUndoActivity(),
+		"follow":   s.handleFollowUndoActivity(),
+		"announce": s.handleAnnounceUndoActivity(),
+		"create":   s.handleCreateUndoActivity(),
+		"block":    s.handleBlockUndoActivity(),
 	}
+	r.HandleFunc("/ap/inbox", s.handleSharedInbox())
 	r.HandleFunc("/ap/@{username}/inbox", s.handleActorInbox())
-	r.HandleFunc("/ap/@{username}", s.handleActor())
+	r.HandleFunc("/ap/@{username}", negotiate(s.handleActor(), profileRoute))
 	r.HandleFunc("/ap/@{username}/following", s.handleFollowingCollection())
 	r.HandleFunc("/ap/@{username}/followers", s.handleFollowersCollection())
-	r.HandleFunc("/ap/@{username}/{article_id}", s.handleAPArticle())
+	r.HandleFunc("/ap/@{username}/outbox", s.handleOutbox())
+	r.HandleFunc("/ap/@{username}/featured", s.handleFeaturedCollection())
+	r.HandleFunc("/ap/@{username}/{article_id}",
+		negotiate(s.handleAPArticle(), articleRoute))
+	r.HandleFunc("/ap/@{username}/{article_id}/activity", s.handleAPArticleActivity())
+	r.HandleFunc("/ap/@{username}/{article_id}/replies", s.handleRepliesCollection())
 
 	r.HandleFunc(webfinger.WebFingerPath, s.newWebfingerHandler())
+	r.HandleFunc("/authorize_interaction", s.handleAuthorizeInteraction())
+	r.HandleFunc(hostMetaPath, s.handleHostMeta())
+	r.HandleFunc(hostMetaJSONPath, s.handleHostMetaJSON())
+	r.HandleFunc(nodeInfoPath, s.handleNodeInfoDiscovery())
+	r.HandleFunc("/nodeinfo/2.0", s.handleNodeInfo("2.0"))
+	r.HandleFunc("/nodeinfo/2.1", s.handleNodeInfo("2.1"))
 }
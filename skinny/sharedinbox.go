@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+	"github.com/gorilla/mux"
+)
+
+// addressedActivity holds the fields of an activity used to find who it is
+// addressed to.
+// See https://www.w3.org/TR/activitypub/#delivery
+type addressedActivity struct {
+	ID       string
+	Type     string
+	Actor    string
+	Object   string
+	To       []string
+	Cc       []string
+	Bto      []string
+	Bcc      []string
+	Audience []string
+}
+
+// parseAddressedActivity reads the fields of an activity used to route it,
+// which may be given in any of the forms JSON-LD allows: the actor as an
+// object, the type as an array, or the addresses as objects or links.
+func parseAddressedActivity(body []byte) (*addressedActivity, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	ld := newLDContext(m["@context"])
+	a := &addressedActivity{}
+	for k, v := range m {
+		switch ld.term(k) {
+		case "id":
+			a.ID = ld.linkID(v)
+		case "type":
+			// Use the first type given, which is the ActivityStreams one.
+			if l, ok := v.([]interface{}); ok && len(l) > 0 {
+				v = l[0]
+			}
+			if t, ok := v.(string); ok {
+				a.Type = ld.term(t)
+			}
+		case "actor":
+			a.Actor = ld.linkID(v)
+		case "object":
+			a.Object = ld.linkID(v)
+		case "to":
+			a.To = ld.linkIDs(v)
+		case "cc":
+			a.Cc = ld.linkIDs(v)
+		case "bto":
+			a.Bto = ld.linkIDs(v)
+		case "bcc":
+			a.Bcc = ld.linkIDs(v)
+		case "audience":
+			a.Audience = ld.linkIDs(v)
+		}
+	}
+	return a, nil
+}
+
+// isSelfDelete reports whether the activity is its actor deleting
+// themselves, rather than one of their objects.
+func (a *addressedActivity) isSelfDelete() bool {
+	return strings.ToLower(a.Type) == "delete" && a.Actor != "" && a.Object == a.Actor
+}
+
+func (a *addressedActivity) addresses() []string {
+	var all []string
+	for _, l := range [][]string{a.To, a.Cc, a.Bto, a.Bcc, a.Audience} {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// sharedInboxURL is the shared inbox advertised in the endpoints of every
+// local actor.
+func (s *serverWrapper) sharedInboxURL() string {
+	return util.NormaliseHost(s.hostname) + "/ap/inbox"
+}
+
+// localHandleFromActorID returns the handle of a local actor id, or false if
+// the id is not of an actor on this instance.
+func (s *serverWrapper) localHandleFromActorID(id string) (string, bool) {
+	prefix := s.localActorID("")
+	if !strings.HasPrefix(id, prefix) {
+		return "", false
+	}
+	handle := strings.TrimPrefix(id, prefix)
+	if handle == "" || strings.Contains(handle, "/") {
+		return "", false
+	}
+	return handle, true
+}
+
+// isLocalHost reports whether the host of a URL is this instance. The
+// configured hostname may carry a scheme, so both are normalised first.
+func (s *serverWrapper) isLocalHost(host string) bool {
+	local, err := url.Parse(util.NormaliseHost(s.hostname))
+	return err == nil && host != "" && host == local.Host
+}
+
+// getLocalFollowersOf finds the local users following the foreign actor id.
+// actor is the actor as fetched, or nil if it can't be, as it was deleted.
+func (s *serverWrapper) getLocalFollowersOf(ctx context.Context, id string, actor *util.RemoteActor) ([]string, error) {
+	author, err := s.foreignUserOf(ctx, id, actor)
+	if err == util.UserNotFoundErr {
+		// Nobody here has interacted with this actor.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	fr := &pb.DbFollowRequest{
+		RequestType: pb.RequestType_FIND,
+		Match:       &pb.Follow{Followed: author.GlobalId},
+	}
+	resp, err := s.database.Follow(ctx, fr)
+	if err != nil {
+		return nil, err
+	} else if resp.ResultType != pb.ResultType_OK {
+		return nil, fmt.Errorf("could not get followers: %s", resp.Error)
+	}
+
+	var handles []string
+	for _, f := range resp.Results {
+		follower, err := util.GetAuthorFromDb(ctx, "", "", false, f.Follower, s.database)
+		if err != nil {
+			log.Printf("Could not get follower %d of %#v: %v", f.Follower, id, err)
+			continue
+		}
+		if follower.Host == "" {
+			handles = append(handles, follower.Handle)
+		}
+	}
+	return handles, nil
+}
+
+// resolveLocalRecipients finds the handles of the local users an activity
+// sent to the shared inbox should be delivered to. These are the local actors
+// it is addressed to directly, plus the local followers of the sending actor
+// if it is addressed to the public or to the actor's followers, or if it's
+// the actor deleting themselves.
+func (s *serverWrapper) resolveLocalRecipients(ctx context.Context, a *addressedActivity) ([]string, error) {
+	seen := map[string]bool{}
+	var handles []string
+	add := func(h string) {
+		if !seen[h] {
+			seen[h] = true
+			handles = append(handles, h)
+		}
+	}
+
+	var collections []string
+	for _, addr := range a.addresses() {
+		if h, ok := s.localHandleFromActorID(addr); ok {
+			add(h)
+		} else {
+			collections = append(collections, addr)
+		}
+	}
+	if a.Actor == "" {
+		return handles, nil
+	}
+	if _, local := s.localHandleFromActorID(a.Actor); local {
+		return handles, nil
+	}
+	if a.isSelfDelete() {
+		// All of their followers should hear of it, and the actor can't be
+		// fetched any more.
+		followers, err := s.getLocalFollowersOf(ctx, a.Actor, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range followers {
+			add(h)
+		}
+		return handles, nil
+	}
+	if len(collections) == 0 {
+		return handles, nil
+	}
+
+	actor, err := s.remoteActors.FetchActor(ctx, a.Actor)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch actor %#v: %v", a.Actor, err)
+	}
+	toFollowers := false
+	for _, c := range collections {
+		if c == activityStreamsPublic || c == "as:Public" || c == "Public" ||
+			(actor.Followers != "" && c == actor.Followers) {
+			toFollowers = true
+		}
+	}
+	if !toFollowers {
+		return handles, nil
+	}
+
+	followers, err := s.getLocalFollowersOf(ctx, a.Actor, actor)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range followers {
+		add(h)
+	}
+	return handles, nil
+}
+
+// statusRecorder keeps the status code a handler wrote, so the shared inbox
+// can report on each recipient it dispatched to.
+type statusRecorder struct {
+	header http.Header
+	code   int
+}
+
+func newStatusRecorder() *statusRecorder {
+	return &statusRecorder{header: http.Header{}, code: http.StatusOK}
+}
+
+func (r *statusRecorder) Header() http.Header         { return r.header }
+func (r *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (r *statusRecorder) WriteHeader(code int)        { r.code = code }
+
+// handleSharedInbox accepts activities for any number of local users in one
+// request, and dispatches them to the actorInboxRouter handlers once per
+// local recipient.
+// See https://www.w3.org/TR/activitypub/#shared-inbox-delivery
+func (s *serverWrapper) handleSharedInbox() http.HandlerFunc {
+	const (
+		inboxErr  = "Error handling shared inbox: %s: %v"
+		typeField = "could not parse activity"
+		notFound  = "unable to handle given activity type"
+	)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := s.readSignedActivity(w, r, "shared")
+		if !ok {
+			return
+		}
+
+		a, err := parseAddressedActivity([]byte(body))
+		if err != nil {
+			log.Printf(inboxErr, typeField, err)
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid JSON-LD: %v.", typeField)
+			return
+		}
+
+		m, exists := s.getInboxHandler(a.Type)
+		if !exists {
+			log.Printf(inboxErr, notFound, a.Type)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Could not handle activity '%#v': %v.",
+				a.Type, notFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+		defer cancel()
+
+		recipients, err := s.resolveLocalRecipients(ctx, a)
+		if err != nil {
+			log.Printf(inboxErr, "could not resolve recipients", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Could not resolve recipients.")
+			return
+		}
+		if len(recipients) == 0 {
+			log.Printf("No local recipients for %s from %#v", a.Type, a.Actor)
+			return
+		}
+
+		// Leave out the recipients this activity was already delivered to.
+		var fresh []string
+		for _, handle := range recipients {
+			if s.claimActivity(newStatusRecorder(), handle, a) {
+				fresh = append(fresh, handle)
+			}
+		}
+		if len(fresh) == 0 {
+			return
+		}
+
+		if s.inboxQueue != nil {
+			for i, handle := range fresh {
+				if err := s.inboxQueue.Enqueue(handle, body); err != nil {
+					log.Printf(inboxErr, "could not queue activity", err)
+					for _, h := range fresh[i:] {
+						s.unclaimActivity(h, a)
+					}
+					writeEnqueueError(w, err)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		failed := 0
+		for _, handle := range fresh {
+			rr := mux.SetURLVars(r, map[string]string{"username": handle})
+			rr.Body = ioutil.NopCloser(strings.NewReader(body))
+			rec := newStatusRecorder()
+			m(rec, rr)
+			if rec.code >= 300 {
+				log.Printf("Delivering %s to %#v failed with status %d",
+					a.Type, handle, rec.code)
+				s.unclaimActivity(handle, a)
+				failed++
+			}
+		}
+
+		if failed == len(fresh) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Could not deliver activity to any recipient.")
+		}
+	}
+}
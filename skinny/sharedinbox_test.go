@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	pb "github.com/cpssd/rabble/services/proto"
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+type fakeActorResolver struct{}
+
+var testRemoteActor = &util.RemoteActor{
+	ID:                testKeyOwner,
+	Type:              "Person",
+	PreferredUsername: "sender",
+	Name:              "Remote Sender",
+	Inbox:             testKeyOwner + "/inbox",
+	Followers:         testKeyOwner + "/followers",
+}
+
+func (f *fakeActorResolver) FetchActor(_ context.Context, id string) (*util.RemoteActor, error) {
+	if id != testKeyOwner {
+		return nil, fmt.Errorf("unknown actor %#v", id)
+	}
+	return testRemoteActor, nil
+}
+
+func (f *fakeActorResolver) Forget(id string) *util.RemoteActor {
+	return nil
+}
+
+func (f *fakeActorResolver) Resolve(_ context.Context, handle, host string) (*util.RemoteActor, error) {
+	if handle != "sender" || util.NormaliseHost(host) != "https://remote.test" {
+		return nil, util.ActorNotFoundErr
+	}
+	return testRemoteActor, nil
+}
+
+// newSharedInboxTestServer sets up a server where the local users alice and
+// bob follow the remote test sender, and carol does not. Handled activities
+// are recorded in the returned slice.
+func newSharedInboxTestServer(t *testing.T) (*serverWrapper, *[]string) {
+	srv := newTestServerWrapper()
+	srv.database = &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{
+			{GlobalId: 1, Handle: "alice"},
+			{GlobalId: 2, Handle: "bob"},
+			{GlobalId: 3, Handle: "carol"},
+			{GlobalId: 4, Handle: "sender", Host: "https://remote.test"},
+			{GlobalId: 5, Handle: "dave", Host: "https://remote.test"},
+		},
+		follows: []*pb.Follow{
+			{Follower: 1, Followed: 4},
+			{Follower: 2, Followed: 4},
+			{Follower: 5, Followed: 4},
+		},
+	}
+
+	handled := &[]string{}
+	srv.actorInboxRouter = map[string]http.HandlerFunc{
+		"create": func(w http.ResponseWriter, r *http.Request) {
+			var a activity
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+				t.Errorf("Failed to re-read activity: %v", err)
+			}
+			*handled = append(*handled, mux.Vars(r)["username"])
+		},
+	}
+	return srv, handled
+}
+
+func TestParseAddressedActivity(t *testing.T) {
+	j := `{
+		"@context": ["https://www.w3.org/ns/activitystreams"],
+		"id": "https://d.e/activities/1",
+		"type": ["Create", "toot:Status"],
+		"actor": {"id": "https://d.e/users/f", "type": "Person"},
+		"object": {"id": "https://d.e/1", "type": "Note"},
+		"to": "https://a.b/ap/@c",
+		"cc": [{"type": "Link", "href": "https://d.e/1"}, {"id": "https://d.e/2"}, "as:Public"]
+	}`
+	a, err := parseAddressedActivity([]byte(j))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if a.ID != "https://d.e/activities/1" || a.Type != "Create" ||
+		a.Actor != "https://d.e/users/f" || a.Object != "https://d.e/1" {
+		t.Errorf("Unexpected activity %#v", a)
+	}
+	want := []string{"https://a.b/ap/@c", "https://d.e/1", "https://d.e/2", activityStreamsPublic}
+	if got := a.addresses(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected addresses %#v, got %#v", want, got)
+	}
+}
+
+func TestSharedInboxFanOut(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "direct",
+			body: `{"type": "Create", "actor": "http://remote.test/ap/@sender",
+				"to": ["http://SKINNYTESTS:191/ap/@carol", "http://SKINNYTESTS:191/ap/@bob"],
+				"cc": "http://SKINNYTESTS:191/ap/@carol"}`,
+			want: []string{"bob", "carol"},
+		},
+		{
+			name: "public",
+			body: `{"type": "Create", "actor": "http://remote.test/ap/@sender",
+				"to": "https://www.w3.org/ns/activitystreams#Public"}`,
+			want: []string{"alice", "bob"},
+		},
+		{
+			name: "followers and direct",
+			body: `{"type": "Create", "actor": "http://remote.test/ap/@sender",
+				"to": "http://SKINNYTESTS:191/ap/@carol",
+				"cc": "http://remote.test/ap/@sender/followers"}`,
+			want: []string{"alice", "bob", "carol"},
+		},
+		{
+			name: "embedded actor and links",
+			body: `{"type": ["Create"], "actor": {"id": "http://remote.test/ap/@sender", "type": "Person"},
+				"to": [{"type": "Link", "href": "https://www.w3.org/ns/activitystreams#Public"}],
+				"cc": {"id": "http://SKINNYTESTS:191/ap/@carol"}}`,
+			want: []string{"alice", "bob", "carol"},
+		},
+		{
+			name: "other collection",
+			body: `{"type": "Create", "actor": "http://remote.test/ap/@sender",
+				"to": "http://remote.test/ap/@someoneelse/followers"}`,
+			want: []string{},
+		},
+	}
+
+	for _, tcase := range tests {
+		srv, handled := newSharedInboxTestServer(t)
+
+		req, _ := http.NewRequest("POST", "/ap/inbox", bytes.NewBufferString(tcase.body))
+		signTestRequest(req, []byte(tcase.body))
+		res := httptest.NewRecorder()
+		srv.handleSharedInbox()(res, req)
+
+		if res.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 OK, got %#v", tcase.name, res.Code)
+		}
+		got := append([]string{}, *handled...)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("%s: expected delivery to %v, got %v", tcase.name, tcase.want, got)
+		}
+	}
+}
+
+func TestSharedInboxRejectsUnsigned(t *testing.T) {
+	srv, handled := newSharedInboxTestServer(t)
+	body := `{"type": "Create", "to": "http://SKINNYTESTS:191/ap/@bob"}`
+	req, _ := http.NewRequest("POST", "/ap/inbox", bytes.NewBufferString(body))
+	res := httptest.NewRecorder()
+	srv.handleSharedInbox()(res, req)
+
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized, got %#v", res.Code)
+	}
+	if len(*handled) != 0 {
+		t.Errorf("Expected no deliveries, got %v", *handled)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	util "github.com/cpssd/rabble/services/utils"
+)
+
+const (
+	// maxClockSkew is how far the Date header of a signed request may drift
+	// from our clock. This matches the window Mastodon allows.
+	maxClockSkew = time.Hour * 12
+
+	// publicKeyCacheTTL is how long a fetched key is trusted before it is
+	// fetched again.
+	publicKeyCacheTTL = time.Hour
+)
+
+var (
+	errNoSignature  = errors.New("request is not signed")
+	errBadSignature = errors.New("signature does not match")
+	// errGone is returned by an objectFetcher when the object was deleted.
+	errGone = errors.New("object is gone")
+)
+
+// actorGoneErr is returned by Verify when the signer's key can't be fetched
+// any more because their actor was deleted, but the signature matches the
+// key we last had for them. The only activity to accept on such a signature
+// is the actor's Delete of themselves.
+type actorGoneErr struct {
+	owner string
+}
+
+func (e *actorGoneErr) Error() string {
+	return fmt.Sprintf("actor %s is gone", e.owner)
+}
+
+// keyFetcher retrieves the key object identified by keyID.
+type keyFetcher func(ctx context.Context, keyID string) (*KeyObject, error)
+
+type cachedKey struct {
+	owner   string
+	key     *rsa.PublicKey
+	fetched time.Time
+	// gone is set if the key could no longer be fetched, as its actor was
+	// deleted, so the key we last fetched is used.
+	gone bool
+}
+
+// signatureVerifier checks draft-cavage HTTP Signatures on inbound activities.
+// See https://tools.ietf.org/html/draft-cavage-http-signatures-10
+//
+// Public keys are fetched using the keyId of the signature and cached for
+// publicKeyCacheTTL. Expired keys are kept for when their actor is deleted.
+type signatureVerifier struct {
+	fetch keyFetcher
+	now   func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*cachedKey
+}
+
+func newSignatureVerifier(fetch keyFetcher) *signatureVerifier {
+	return &signatureVerifier{
+		fetch: fetch,
+		now:   time.Now,
+		keys:  map[string]*cachedKey{},
+	}
+}
+
+type signatureParams struct {
+	keyID     string
+	algorithm string
+	headers   []string
+	signature []byte
+}
+
+// parseSignatureHeader parses the value of a Signature header, or the
+// parameters of an Authorization header using the Signature scheme.
+func parseSignatureHeader(v string) (*signatureParams, error) {
+	p := &signatureParams{}
+	for len(v) > 0 {
+		v = strings.TrimLeft(v, " ,")
+		eq := strings.Index(v, "=")
+		if eq == -1 {
+			break
+		}
+		name := strings.TrimSpace(v[:eq])
+		v = v[eq+1:]
+
+		var value string
+		if strings.HasPrefix(v, `"`) {
+			end := strings.Index(v[1:], `"`)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated value for %#v", name)
+			}
+			value = v[1 : end+1]
+			v = v[end+2:]
+		} else if c := strings.Index(v, ","); c != -1 {
+			value, v = v[:c], v[c:]
+		} else {
+			value, v = v, ""
+		}
+
+		switch name {
+		case "keyId":
+			p.keyID = value
+		case "algorithm":
+			p.algorithm = strings.ToLower(value)
+		case "headers":
+			p.headers = strings.Fields(strings.ToLower(value))
+		case "signature":
+			sig, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("signature is not base64: %v", err)
+			}
+			p.signature = sig
+		}
+	}
+
+	if p.keyID == "" || len(p.signature) == 0 {
+		return nil, errors.New("signature is missing keyId or signature")
+	}
+	if len(p.headers) == 0 {
+		// The spec defaults to only the Date header being signed.
+		p.headers = []string{"date"}
+	}
+	return p, nil
+}
+
+func getSignatureParams(r *http.Request) (*signatureParams, error) {
+	if v := r.Header.Get("Signature"); v != "" {
+		return parseSignatureHeader(v)
+	}
+	const scheme = "signature "
+	v := r.Header.Get("Authorization")
+	if len(v) > len(scheme) && strings.ToLower(v[:len(scheme)]) == scheme {
+		return parseSignatureHeader(v[len(scheme):])
+	}
+	return nil, errNoSignature
+}
+
+// buildSigningString reconstructs the string the sender signed.
+func buildSigningString(r *http.Request, headers []string) (string, error) {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		var value string
+		switch h {
+		case "(request-target)":
+			value = strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "host":
+			value = r.Host
+		default:
+			values := r.Header[http.CanonicalHeaderKey(h)]
+			if len(values) == 0 {
+				return "", fmt.Errorf("signed header %#v is missing", h)
+			}
+			value = strings.Join(values, ", ")
+		}
+		lines = append(lines, h+": "+strings.TrimSpace(value))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// checkDigest compares the Digest header against the received body.
+func checkDigest(r *http.Request, body []byte) error {
+	header := r.Header.Get("Digest")
+	if header == "" {
+		return errors.New("request has no Digest header")
+	}
+	for _, d := range strings.Split(header, ",") {
+		split := strings.SplitN(strings.TrimSpace(d), "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+
+		var h hash.Hash
+		switch strings.ToUpper(split[0]) {
+		case "SHA-256":
+			h = sha256.New()
+		case "SHA-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+		h.Write(body)
+		if base64.StdEncoding.EncodeToString(h.Sum(nil)) != split[1] {
+			return errors.New("Digest header does not match body")
+		}
+		return nil
+	}
+	return fmt.Errorf("no supported algorithm in Digest %#v", header)
+}
+
+func (v *signatureVerifier) checkDate(r *http.Request) error {
+	header := r.Header.Get("Date")
+	if header == "" {
+		return errors.New("request has no Date header")
+	}
+	date, err := http.ParseTime(header)
+	if err != nil {
+		return fmt.Errorf("could not parse Date header: %v", err)
+	}
+	skew := v.now().Sub(date)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("Date %#v is outside the allowed clock skew", header)
+	}
+	return nil
+}
+
+func parsePublicKeyPem(p string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(p))
+	if block == nil {
+		return nil, errors.New("could not decode public key PEM")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// getKey returns the key with the given id, fetching it if it isn't cached,
+// has expired, or refresh is set. If the key is gone from its server, the
+// one we last fetched is returned with gone set.
+func (v *signatureVerifier) getKey(ctx context.Context, keyID string, refresh bool) (*cachedKey, error) {
+	v.mu.Lock()
+	k, exists := v.keys[keyID]
+	v.mu.Unlock()
+	if exists && !refresh && v.now().Sub(k.fetched) < publicKeyCacheTTL {
+		return k, nil
+	}
+
+	obj, err := v.fetch(ctx, keyID)
+	if err == errGone && exists {
+		return &cachedKey{owner: k.owner, key: k.key, fetched: k.fetched, gone: true}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not fetch key %#v: %v", keyID, err)
+	}
+	key, err := parsePublicKeyPem(obj.PublicKeyPem)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key %#v: %v", keyID, err)
+	}
+	owner := obj.Owner
+	if owner == "" {
+		owner = strings.SplitN(keyID, "#", 2)[0]
+	}
+	// Only an actor's own server can vouch for its key.
+	if !sameHost(keyID, owner) {
+		return nil, fmt.Errorf("key %#v is owned by %s on another host", keyID, owner)
+	}
+	k = &cachedKey{owner: owner, key: key, fetched: v.now()}
+
+	v.mu.Lock()
+	v.keys[keyID] = k
+	v.mu.Unlock()
+	return k, nil
+}
+
+// Verify checks the signature, Digest and Date of an inbound request and
+// returns the actor owning the key that signed it. Callers must check that
+// this is the actor they act for.
+//
+// body must be the full body that was read from the request.
+func (v *signatureVerifier) Verify(r *http.Request, body []byte) (string, error) {
+	p, err := getSignatureParams(r)
+	if err != nil {
+		return "", err
+	}
+
+	switch p.algorithm {
+	case "", "rsa-sha256", "hs2019":
+	default:
+		return "", fmt.Errorf("unsupported signature algorithm %#v", p.algorithm)
+	}
+
+	signed := map[string]bool{}
+	for _, h := range p.headers {
+		signed[h] = true
+	}
+	if !signed["date"] {
+		return "", errors.New("Date header is not signed")
+	}
+	if err := v.checkDate(r); err != nil {
+		return "", err
+	}
+	if len(body) > 0 {
+		if !signed["digest"] {
+			return "", errors.New("Digest header is not signed")
+		}
+		if err := checkDigest(r, body); err != nil {
+			return "", err
+		}
+	}
+
+	s, err := buildSigningString(r, p.headers)
+	if err != nil {
+		return "", err
+	}
+	hashed := sha256.Sum256([]byte(s))
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+	defer cancel()
+
+	k, err := v.getKey(ctx, p.keyID, false)
+	if err != nil {
+		return "", err
+	}
+	if rsa.VerifyPKCS1v15(k.key, crypto.SHA256, hashed[:], p.signature) == nil {
+		if k.gone {
+			return "", &actorGoneErr{owner: k.owner}
+		}
+		return k.owner, nil
+	}
+
+	// The sender may have rotated their key since we cached it.
+	k, err = v.getKey(ctx, p.keyID, true)
+	if err != nil {
+		return "", err
+	}
+	if rsa.VerifyPKCS1v15(k.key, crypto.SHA256, hashed[:], p.signature) != nil {
+		return "", errBadSignature
+	} else if k.gone {
+		return "", &actorGoneErr{owner: k.owner}
+	}
+	return k.owner, nil
+}
+
+// objectFetcher dereferences the ActivityPub object u and decodes it into v.
+// errGone is returned if the object was deleted.
+type objectFetcher func(ctx context.Context, u string, v interface{}) error
+
+// newActivityFetcher returns an objectFetcher making its requests with
+// client, which should be one made by util.NewRemoteHTTPClient.
+func newActivityFetcher(client *http.Client) objectFetcher {
+	return func(ctx context.Context, u string, v interface{}) error {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		// Mastodon redirects to the user-facing profile without this.
+		req.Header.Set("Accept", "application/activity+json, application/ld+json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+			return errGone
+		} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("got status %d from %s", resp.StatusCode, u)
+		}
+		return util.DecodeRemoteJSON(resp.Body, v)
+	}
+}
+
+// keyDocument holds the fields of either an actor document, with its key
+// in publicKey, or of a bare key object.
+type keyDocument struct {
+	ID           string     `json:"id"`
+	Owner        string     `json:"owner"`
+	PublicKeyPem string     `json:"publicKeyPem"`
+	PublicKey    *KeyObject `json:"publicKey"`
+}
+
+// newPublicKeyFetcher returns a keyFetcher dereferencing the keyId of a
+// signature using fetch. Key ids are usually a fragment of the actor
+// document, e.g. https://a.b/ap/@c#main-key, so both actor documents and bare
+// key objects are accepted.
+//
+// The key is only returned if its owner's actor document publishes it, as
+// otherwise a key could claim to belong to any actor.
+func newPublicKeyFetcher(fetch objectFetcher) keyFetcher {
+	return func(ctx context.Context, keyID string) (*KeyObject, error) {
+		u := strings.SplitN(keyID, "#", 2)[0]
+		var doc keyDocument
+		if err := fetch(ctx, u, &doc); err != nil {
+			return nil, err
+		}
+
+		var key *KeyObject
+		if doc.PublicKey != nil && doc.PublicKey.PublicKeyPem != "" {
+			key = doc.PublicKey
+			if key.Owner == "" {
+				key.Owner = doc.ID
+			}
+		} else if doc.PublicKeyPem != "" {
+			key = &KeyObject{ID: doc.ID, Owner: doc.Owner, PublicKeyPem: doc.PublicKeyPem}
+		} else {
+			log.Printf("No public key found in document at %s", u)
+			return nil, fmt.Errorf("no public key found at %s", u)
+		}
+		if key.ID != keyID {
+			return nil, fmt.Errorf("document at %s has key %#v, not %#v", u, key.ID, keyID)
+		}
+		if key.Owner == "" {
+			return nil, fmt.Errorf("key %#v has no owner", keyID)
+		}
+		if key.Owner == doc.ID && doc.PublicKey != nil {
+			// The document is the owner's actor.
+			return key, nil
+		}
+
+		var owner keyDocument
+		if err := fetch(ctx, key.Owner, &owner); err != nil {
+			return nil, fmt.Errorf("could not fetch owner of key: %v", err)
+		}
+		if owner.ID != key.Owner || owner.PublicKey == nil || owner.PublicKey.ID != keyID {
+			return nil, fmt.Errorf("owner %s doesn't publish key %#v", key.Owner, keyID)
+		}
+		return key, nil
+	}
+}
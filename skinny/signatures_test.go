@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testKeyID    = "http://remote.test/ap/@sender#main-key"
+	testKeyOwner = "http://remote.test/ap/@sender"
+)
+
+var testSigningKey = func() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+func fakeKeyFetcher(_ context.Context, keyID string) (*KeyObject, error) {
+	if keyID != testKeyID {
+		return nil, fmt.Errorf("unknown key %#v", keyID)
+	}
+	b, _ := x509.MarshalPKIXPublicKey(&testSigningKey.PublicKey)
+	p := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b})
+	return &KeyObject{
+		ID:           testKeyID,
+		Owner:        testKeyOwner,
+		PublicKeyPem: string(p),
+	}, nil
+}
+
+// signTestRequest signs r the same way the python activities services do.
+func signTestRequest(r *http.Request, body []byte) {
+	digest := sha256.Sum256(body)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+
+	headers := []string{"(request-target)", "date", "digest"}
+	s, _ := buildSigningString(r, headers)
+	hashed := sha256.Sum256([]byte(s))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, testSigningKey, crypto.SHA256, hashed[:])
+
+	r.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		testKeyID, strings.Join(headers, " "),
+		base64.StdEncoding.EncodeToString(sig)))
+}
+
+func TestParseSignatureHeader(t *testing.T) {
+	h := `keyId="https://a.b/ap/@c#main-key",algorithm="rsa-sha256",` +
+		`headers="(request-target) Date digest",signature="YWJj"`
+	p, err := parseSignatureHeader(h)
+	if err != nil {
+		t.Fatalf("parseSignatureHeader(%#v): unexpected error: %v", h, err)
+	}
+	if p.keyID != "https://a.b/ap/@c#main-key" {
+		t.Errorf("Expected keyId to be parsed, got %#v", p.keyID)
+	}
+	if strings.Join(p.headers, " ") != "(request-target) date digest" {
+		t.Errorf("Expected lowercased headers, got %#v", p.headers)
+	}
+	if string(p.signature) != "abc" {
+		t.Errorf("Expected decoded signature, got %#v", string(p.signature))
+	}
+
+	if _, err := parseSignatureHeader(`algorithm="rsa-sha256"`); err == nil {
+		t.Errorf("Expected error for signature without keyId")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{ "type": "Create" }`)
+
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		err    bool
+	}{
+		{
+			name:   "valid",
+			modify: func(r *http.Request) {},
+		},
+		{
+			name: "unsigned",
+			modify: func(r *http.Request) {
+				r.Header.Del("Signature")
+			},
+			err: true,
+		},
+		{
+			name: "authorization header",
+			modify: func(r *http.Request) {
+				r.Header.Set("Authorization", "Signature "+r.Header.Get("Signature"))
+				r.Header.Del("Signature")
+			},
+		},
+		{
+			name: "tampered digest",
+			modify: func(r *http.Request) {
+				r.Header.Set("Digest", "SHA-256=bm90IHRoZSBib2R5")
+			},
+			err: true,
+		},
+		{
+			name: "stale date",
+			modify: func(r *http.Request) {
+				old := time.Now().Add(-maxClockSkew * 2)
+				r.Header.Set("Date", old.UTC().Format(http.TimeFormat))
+			},
+			err: true,
+		},
+		{
+			name: "different target",
+			modify: func(r *http.Request) {
+				r.URL.Path = "/ap/@someoneelse/inbox"
+			},
+			err: true,
+		},
+	}
+
+	v := newSignatureVerifier(fakeKeyFetcher)
+	for _, tcase := range tests {
+		req, _ := http.NewRequest("POST", "/ap/@testuser/inbox", bytes.NewReader(body))
+		signTestRequest(req, body)
+		tcase.modify(req)
+
+		owner, err := v.Verify(req, body)
+		if err != nil && tcase.err {
+			continue
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tcase.name, err)
+			continue
+		} else if tcase.err {
+			t.Errorf("%s: want error", tcase.name)
+			continue
+		}
+		if owner != testKeyOwner {
+			t.Errorf("%s: expected owner %#v, got %#v", tcase.name, testKeyOwner, owner)
+		}
+	}
+}
+
+func TestActorInboxRejectsUnsigned(t *testing.T) {
+	srv := newTestServerWrapper()
+	setupFakeActorInboxRoutes(t, srv)
+
+	req, _ := http.NewRequest("POST", "/ap/testuser/", bytes.NewBufferString(`{ "type": "create" }`))
+	res := httptest.NewRecorder()
+	srv.handleActorInbox()(res, req)
+
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized, got %#v", res.Code)
+	}
+}
+
+func TestActorInboxRejectsBlacklistedKeyOwner(t *testing.T) {
+	srv := newTestServerWrapper()
+	setupFakeActorInboxRoutes(t, srv)
+	srv.blacklist = NewBlacklist(strings.NewReader("remote.test\n"))
+
+	body := []byte(`{ "type": "create" }`)
+	req, _ := http.NewRequest("POST", "/ap/testuser/", bytes.NewReader(body))
+	signTestRequest(req, body)
+	res := httptest.NewRecorder()
+	srv.handleActorInbox()(res, req)
+
+	if res.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %#v", res.Code)
+	}
+}
+
+func TestActorInboxRejectsOtherActor(t *testing.T) {
+	srv := newTestServerWrapper()
+	setupFakeActorInboxRoutes(t, srv)
+
+	for _, body := range []string{
+		`{ "type": "create", "actor": "http://remote.test/ap/@someoneelse" }`,
+		`{ "type": "create", "actor": "http://elsewhere.test/ap/@sender" }`,
+		`{ "type": "create" }`,
+	} {
+		for name, h := range map[string]http.HandlerFunc{
+			"actor":  srv.handleActorInbox(),
+			"shared": srv.handleSharedInbox(),
+		} {
+			req, _ := http.NewRequest("POST", "/ap/testuser/", bytes.NewBufferString(body))
+			signTestRequest(req, []byte(body))
+			res := httptest.NewRecorder()
+			h(res, req)
+			if res.Code != http.StatusUnauthorized {
+				t.Errorf("%s inbox, %s: expected 401 Unauthorized, got %#v", name, body, res.Code)
+			}
+		}
+	}
+}
+
+func TestPublicKeyFetcher(t *testing.T) {
+	b, _ := x509.MarshalPKIXPublicKey(&testSigningKey.PublicKey)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	docs := map[string]string{
+		// An actor with its key embedded.
+		"http://remote.test/ap/@sender": `{"id": "http://remote.test/ap/@sender",
+			"publicKey": {"id": "http://remote.test/ap/@sender#main-key", "publicKeyPem": ` + strconv.Quote(pemKey) + `}}`,
+		// A key in its own document, published by its owner.
+		"http://remote.test/keys/1": `{"id": "http://remote.test/keys/1",
+			"owner": "http://remote.test/ap/@bob", "publicKeyPem": ` + strconv.Quote(pemKey) + `}`,
+		"http://remote.test/ap/@bob": `{"id": "http://remote.test/ap/@bob",
+			"publicKey": {"id": "http://remote.test/keys/1", "publicKeyPem": ` + strconv.Quote(pemKey) + `}}`,
+		// A key claiming an owner which doesn't publish it.
+		"http://remote.test/keys/2": `{"id": "http://remote.test/keys/2",
+			"owner": "http://remote.test/ap/@bob", "publicKeyPem": ` + strconv.Quote(pemKey) + `}`,
+	}
+	fetch := func(_ context.Context, u string, v interface{}) error {
+		d, ok := docs[u]
+		if !ok {
+			return fmt.Errorf("no document %s", u)
+		}
+		return json.Unmarshal([]byte(d), v)
+	}
+	f := newPublicKeyFetcher(fetch)
+
+	for _, tc := range []struct {
+		keyID string
+		owner string
+	}{
+		{"http://remote.test/ap/@sender#main-key", "http://remote.test/ap/@sender"},
+		{"http://remote.test/keys/1", "http://remote.test/ap/@bob"},
+		{"http://remote.test/keys/2", ""},
+		{"http://remote.test/ap/@sender#other-key", ""},
+	} {
+		k, err := f(context.Background(), tc.keyID)
+		if tc.owner == "" {
+			if err == nil {
+				t.Errorf("%s: expected error, got key of %s", tc.keyID, k.Owner)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.keyID, err)
+		} else if k.Owner != tc.owner {
+			t.Errorf("%s: expected owner %s, got %s", tc.keyID, tc.owner, k.Owner)
+		}
+	}
+}
+
+func TestVerifyRejectsKeyOwnedElsewhere(t *testing.T) {
+	v := newSignatureVerifier(func(ctx context.Context, keyID string) (*KeyObject, error) {
+		k, err := fakeKeyFetcher(ctx, keyID)
+		if k != nil {
+			k.Owner = "http://elsewhere.test/ap/@sender"
+		}
+		return k, err
+	})
+	body := []byte(`{ "type": "Create" }`)
+	req, _ := http.NewRequest("POST", "/ap/@testuser/inbox", bytes.NewReader(body))
+	signTestRequest(req, body)
+	if owner, err := v.Verify(req, body); err == nil {
+		t.Errorf("Expected error for a key owned by another host, got owner %#v", owner)
+	}
+}
@@ -354,7 +354,15 @@ func (s *serverWrapper) getProfilePicPath(userID int64) string {
 	return filepath
 }
 
-func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
+func (s *serverWrapper) getHeaderPicPath(userID int64) string {
+	filename := fmt.Sprintf("header_%d", userID)
+	filepath := path.Join(staticAssets, filename)
+	return filepath
+}
+
+// handleUserUpdateImage stores the image uploaded in the given form field for
+// the logged in user, at the path given by getPath.
+func (s *serverWrapper) handleUserUpdateImage(field string, getPath func(int64) string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var resp userResponse
 		resp.Success = false
@@ -370,8 +378,7 @@ func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
 			return
 		}
 
-		image, _, err := r.FormFile("profile_pic")
-		defer image.Close()
+		image, _, err := r.FormFile(field)
 		if err != nil {
 			log.Printf(couldNotLoadProfilePic+": %v", err)
 			w.WriteHeader(http.StatusBadRequest)
@@ -379,6 +386,7 @@ func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
 			enc.Encode(resp)
 			return
 		}
+		defer image.Close()
 		buf := bytes.NewBuffer(nil)
 		if _, err := io.Copy(buf, image); err != nil {
 			log.Printf("Error copying image to buffer: %v", err)
@@ -408,7 +416,7 @@ func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
 			enc.Encode(resp)
 			return
 		}
-		filepath := s.getProfilePicPath(userID)
+		filepath := getPath(userID)
 		log.Printf("Writing image to %s", filepath)
 		if err := ioutil.WriteFile(filepath, buf.Bytes(), 0644); err != nil {
 			log.Printf("Error writing file to %s: %v", filepath, err)
@@ -422,6 +430,16 @@ func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
 	}
 }
 
+func (s *serverWrapper) handleUserUpdateProfilePic() http.HandlerFunc {
+	return s.handleUserUpdateImage("profile_pic", s.getProfilePicPath)
+}
+
+// handleUserUpdateHeader stores the banner shown at the top of the user's
+// profile.
+func (s *serverWrapper) handleUserUpdateHeader() http.HandlerFunc {
+	return s.handleUserUpdateImage("header", s.getHeaderPicPath)
+}
+
 func (s *serverWrapper) handleUserCSS() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		v := mux.Vars(r)
@@ -497,7 +515,30 @@ func (s *serverWrapper) handleUserDetails() http.HandlerFunc {
 			log.Printf("could not get user, error: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
-		} else if len(resp.Results) != 1 {
+		}
+
+		var user *pb.UsersEntry
+		if len(resp.Results) == 1 {
+			user = resp.Results[0]
+		} else if len(resp.Results) == 0 && host != "" {
+			// Nobody here has interacted with this foreign user yet, so look
+			// them up on their own server instead.
+			actor, err := s.remoteActors.Resolve(ctx, handle, host)
+			if err == util.ActorNotFoundErr {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			} else if err != nil {
+				log.Printf("could not resolve user @%s@%s: %v", handle, host, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			user = &pb.UsersEntry{
+				Handle:      actor.PreferredUsername,
+				Host:        actor.Host(),
+				DisplayName: actor.Name,
+				Bio:         actor.Summary,
+			}
+		} else {
 			log.Printf("could not get user, got %v results", len(resp.Results))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -506,7 +547,7 @@ func (s *serverWrapper) handleUserDetails() http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		enc := json.NewEncoder(w)
 		enc.SetEscapeHTML(false)
-		err = enc.Encode(util.StripUser(resp.Results[0]))
+		err = enc.Encode(util.StripUser(user))
 		if err != nil {
 			log.Printf("could not marshal blogs: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
+	"time"
 
 	pb "github.com/cpssd/rabble/services/proto"
 	util "github.com/cpssd/rabble/services/utils"
@@ -23,73 +34,289 @@ func getStrippedHost(hostname string) string {
 	return split[0]
 }
 
-func (s *serverWrapper) newWebfingerHandler() http.HandlerFunc {
-	wf := webfinger.Default(&wfResolver{
+const (
+	// webfingerResponseTime is the minimum time a webfinger response takes
+	// when decoys are enabled. It should be longer than any real lookup.
+	webfingerResponseTime = 250 * time.Millisecond
+
+	// maxDecoyGlobalID bounds the global ids given to decoy users, to keep
+	// them in the range of real ids.
+	maxDecoyGlobalID = 10000
+
+	// decoyKeySize is the size in bytes of the key decoy ids are derived
+	// with.
+	decoyKeySize = 32
+
+	// maxDecoyAttempts bounds how many ids are tried for a decoy before
+	// giving up on finding one no real user has.
+	maxDecoyAttempts = 16
+
+	hostMetaPath     = "/.well-known/host-meta"
+	hostMetaJSONPath = "/.well-known/host-meta.json"
+	xrdNamespace     = "http://docs.oasis-open.org/ns/xri/xrd-1.0"
+)
+
+func (s *serverWrapper) newWfResolver() *wfResolver {
+	return &wfResolver{
 		users:     s.database,
 		hostname:  getStrippedHost(s.hostname),
 		debugHost: s.hostname,
-	})
+		decoys:    s.webfingerDecoys,
+		decoyKey:  s.decoyKey,
+	}
+}
+
+// loadDecoyKey reads the key decoy ids are derived with from path, creating
+// it if it doesn't exist yet. Without a path a new key is made, so decoys
+// only stay the same until the server restarts.
+func loadDecoyKey(path string) ([]byte, error) {
+	if path != "" {
+		key, err := ioutil.ReadFile(path)
+		if err == nil && len(key) >= decoyKeySize {
+			return key, nil
+		} else if err == nil {
+			return nil, fmt.Errorf("decoy key in %s is too short", path)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	key := make([]byte, decoyKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := ioutil.WriteFile(path, key, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+func (s *serverWrapper) newWebfingerHandler() http.HandlerFunc {
+	wf := webfinger.Default(s.newWfResolver())
 	wf.NoTLSHandler = nil
-	return http.HandlerFunc(wf.Webfinger)
+	if !s.webfingerDecoys {
+		return http.HandlerFunc(wf.Webfinger)
+	}
+	return equaliseResponseTime(webfingerResponseTime, wf.Webfinger)
+}
+
+// bufferedResponse holds a response until it is ready to be sent.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(code int)        { b.code = code }
+
+// equaliseResponseTime holds back the response of h until at least d has
+// passed since the request arrived. This hides the difference in timing
+// between lookups of real users and decoys.
+func equaliseResponseTime(d time.Duration, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		b := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+		h(b, r)
+
+		if wait := d - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		for k, v := range b.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(b.code)
+		w.Write(b.body.Bytes())
+	}
+}
+
+// hostMetaLink is a link in a host-meta document. Only the LRDD link
+// pointing at webfinger is served.
+type hostMetaLink struct {
+	XMLName  xml.Name `xml:"Link" json:"-"`
+	Rel      string   `xml:"rel,attr" json:"rel"`
+	Type     string   `xml:"type,attr,omitempty" json:"type,omitempty"`
+	Template string   `xml:"template,attr" json:"template"`
+}
+
+type hostMetaXRD struct {
+	XMLName xml.Name       `xml:"XRD"`
+	XMLNS   string         `xml:"xmlns,attr"`
+	Links   []hostMetaLink `xml:"Link"`
+}
+
+func (wf *wfResolver) lrddLink(contentType string) hostMetaLink {
+	return hostMetaLink{
+		Rel:      "lrdd",
+		Type:     contentType,
+		Template: wf.baseURL() + webfinger.WebFingerPath + "?resource={uri}",
+	}
+}
+
+// handleHostMeta serves the XRD host-meta document that older clients use
+// to discover the webfinger endpoint.
+// See https://tools.ietf.org/html/rfc6415
+func (s *serverWrapper) handleHostMeta() http.HandlerFunc {
+	wf := s.newWfResolver()
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc := &hostMetaXRD{
+			XMLNS: xrdNamespace,
+			Links: []hostMetaLink{wf.lrddLink("application/xrd+xml")},
+		}
+		w.Header().Set("Content-Type", "application/xrd+xml")
+		w.Write([]byte(xml.Header))
+		if err := xml.NewEncoder(w).Encode(doc); err != nil {
+			log.Printf("Could not marshal host-meta: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleHostMetaJSON serves the JRD form of the host-meta document.
+func (s *serverWrapper) handleHostMetaJSON() http.HandlerFunc {
+	wf := s.newWfResolver()
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc := struct {
+			Links []hostMetaLink `json:"links"`
+		}{
+			Links: []hostMetaLink{wf.lrddLink("application/jrd+json")},
+		}
+		w.Header().Set("Content-Type", "application/jrd+json")
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(doc); err != nil {
+			log.Printf("Could not marshal host-meta: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
 }
 
 type wfResolver struct {
 	users     util.UsersGetter
 	hostname  string
 	debugHost string
+
+	// decoys enables fake resources for unknown users, see DummyUser.
+	decoys bool
+
+	// decoyKey is the secret decoy ids are derived with, so they can't be
+	// told apart from real ones by working them out from the handle.
+	decoyKey []byte
 }
 
 func (wf *wfResolver) subject(user *pb.UsersEntry) string {
 	return fmt.Sprintf("acct:%s@%s", user.Handle, wf.hostname)
 }
 
-func (wf *wfResolver) genLinks(user *pb.UsersEntry) []webfinger.Link {
+// baseURL returns the scheme and host other servers reach us at.
+func (wf *wfResolver) baseURL() string {
 	// Add a special case for local debugging, where we won't have a "dot" in the
 	// hostname.
 	// This does assume that non debug rabble users are using HTTPS and a standard
 	// port, but they're probably decent assumptions to make.
-	host := wf.hostname
-	protocol := "https"
 	if !strings.Contains(wf.hostname, ".") {
-		host = wf.debugHost
-		protocol = "http"
+		return "http://" + wf.debugHost
 	}
+	return "https://" + wf.hostname
+}
+
+func (wf *wfResolver) profileURL(user *pb.UsersEntry) string {
+	return fmt.Sprintf("%s/#/@%s", wf.baseURL(), user.Handle)
+}
+
+func (wf *wfResolver) actorURL(user *pb.UsersEntry) string {
+	return fmt.Sprintf("%s/ap/@%s", wf.baseURL(), user.Handle)
+}
+
+func (wf *wfResolver) genLinks(user *pb.UsersEntry) []webfinger.Link {
+	base := wf.baseURL()
 
 	//TODO(iandioch): Add magic-public-key webfinger links.
 	html := webfinger.Link{
-		HRef: fmt.Sprintf("%s://%s/#/@%s", protocol, host, user.Handle),
+		HRef: wf.profileURL(user),
 		Rel:  "http://webfinger.net/rel/profile-page",
 		Type: "text/html",
 	}
 	ap := webfinger.Link{
-		HRef: fmt.Sprintf("%s://%s/ap/@%s", protocol, host, user.Handle),
+		HRef: wf.actorURL(user),
 		Rel:  "self",
 		Type: "application/activity+json",
 	}
 	// http://microformats.org/wiki/rel-feed
 	rss := webfinger.Link{
-		HRef: fmt.Sprintf("%s://%s/c2s/%s/rss", protocol, host, user.GlobalId),
+		HRef: fmt.Sprintf("%s/c2s/%s/rss", base, user.GlobalId),
 		Rel:  "feed",
 		Type: "application/rss+xml",
 	}
 
 	// http://microformats.org/wiki/rel-alternate
 	altRss := webfinger.Link{
-		HRef: fmt.Sprintf("%s://%s/c2s/%s/rss", protocol, host, user.GlobalId),
+		HRef: fmt.Sprintf("%s/c2s/%s/rss", base, user.GlobalId),
 		Rel:  "alternative",
 		Type: "application/rss+xml",
 	}
-	return []webfinger.Link{html, ap, rss, altRss}
+
+	// Lets people on other servers follow this user from their own server.
+	subscribe := webfinger.Link{
+		Rel:      ostatusSubscribeRel,
+		Template: base + "/authorize_interaction?uri={uri}",
+	}
+	return []webfinger.Link{html, ap, rss, altRss, subscribe}
 }
 
-// FindUser finds the user given the username and hostname
-func (wf *wfResolver) FindUser(handle string, host, requestHost string, r []webfinger.Rel) (*webfinger.Resource, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
-	defer cancel()
+// parseResourceURL handles webfinger lookups by actor or profile page URL,
+// such as resource=https://rabble.host/ap/@user.
+// The webfinger library splits every resource at its last "@", so a URL
+// arrives with the scheme and path as the handle and the username as the
+// host. This reassembles the URL and returns the real handle and host.
+func parseResourceURL(handle, host string) (string, string, error) {
+	u, err := url.Parse(handle + "@" + host)
+	if err != nil {
+		return "", "", err
+	}
+	// Profile pages are served by the frontend router, after the "#".
+	for _, p := range []string{u.Path, u.Fragment} {
+		switch {
+		case strings.HasPrefix(p, "/ap/@"):
+			return strings.TrimPrefix(p, "/ap/@"), u.Host, nil
+		case strings.HasPrefix(p, "/@"):
+			return strings.TrimPrefix(p, "/@"), u.Host, nil
+		}
+	}
+	return "", "", fmt.Errorf("%#v is not an actor or profile URL", u.String())
+}
+
+// resolveResource returns the local handle a webfinger resource refers to,
+// or false if it is not for a user on this server.
+func (wf *wfResolver) resolveResource(handle, host string) (string, bool) {
+	if strings.Contains(handle, "://") {
+		var err error
+		handle, host, err = parseResourceURL(handle, host)
+		if err != nil {
+			fmt.Printf("webfinger: bad resource URL: %v", err)
+			return "", false
+		}
+	}
 
 	// We only support looking up hosts that exist on our server.
 	if host != wf.hostname && host != wf.debugHost {
 		fmt.Printf("webfinger: lookup on %s, expecting %s", host, wf.hostname)
+		return "", false
+	}
+	return handle, true
+}
+
+// FindUser finds the user given the username and hostname.
+// Resources can be acct: URIs, or actor and profile page URLs.
+func (wf *wfResolver) FindUser(handle string, host, requestHost string, r []webfinger.Rel) (*webfinger.Resource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+	defer cancel()
+
+	handle, ok := wf.resolveResource(handle, host)
+	if !ok {
 		return nil, util.UserNotFoundErr
 	}
 
@@ -99,19 +326,64 @@ func (wf *wfResolver) FindUser(handle string, host, requestHost string, r []webf
 		return nil, err
 	}
 
-	res := &webfinger.Resource{
+	return wf.resource(u), nil
+}
+
+func (wf *wfResolver) resource(u *pb.UsersEntry) *webfinger.Resource {
+	return &webfinger.Resource{
 		Subject: wf.subject(u),
+		Aliases: []string{wf.actorURL(u), wf.profileURL(u)},
 		Links:   wf.genLinks(u),
 	}
-	return res, nil
+}
+
+// decoyGlobalID derives a stable, plausible global id for a handle that
+// doesn't exist, so repeated lookups of a decoy agree with each other.
+// Ids of real users are skipped, as the decoy's links would lead to them.
+func (wf *wfResolver) decoyGlobalID(ctx context.Context, handle string) (int64, error) {
+	for attempt := byte(0); attempt < maxDecoyAttempts; attempt++ {
+		mac := hmac.New(sha256.New, wf.decoyKey)
+		mac.Write([]byte{attempt})
+		mac.Write([]byte(handle))
+		sum := mac.Sum(nil)
+		id := int64(binary.BigEndian.Uint64(sum[:8])%maxDecoyGlobalID) + 1
+
+		_, err := util.GetAuthorFromDb(ctx, "", "", false, id, wf.users)
+		if err == util.UserNotFoundErr {
+			return id, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("no unused id for decoy %#v", handle)
 }
 
 // DummyUser allows us to fake a user, to prevent user enumeration.
-//
-// TODO(devoxel): create realistic fakes rather than 404s
 // See https://github.com/sheenobu/go-webfinger/blob/master/resolver.go
+//
+// Unless decoys are enabled, unknown users are reported as not found.
+// With decoys, any handle on this server gets a resource with the same shape
+// as a real one, so probing webfinger doesn't reveal which handles exist.
 func (wf *wfResolver) DummyUser(username string, hostname string, r []webfinger.Rel) (*webfinger.Resource, error) {
-	return nil, util.UserNotFoundErr
+	if !wf.decoys {
+		return nil, util.UserNotFoundErr
+	}
+	handle, ok := wf.resolveResource(username, hostname)
+	if !ok || handle == "" {
+		return nil, util.UserNotFoundErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuration)
+	defer cancel()
+	globalID, err := wf.decoyGlobalID(ctx, handle)
+	if err != nil {
+		log.Printf("webfinger: could not make decoy: %v", err)
+		return nil, util.UserNotFoundErr
+	}
+	return wf.resource(&pb.UsersEntry{
+		Handle:   handle,
+		GlobalId: globalID,
+	}), nil
 }
 
 // IsNotFoundError returns true if the given error is a not found error.
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	webfinger "github.com/writeas/go-webfinger"
+
+	pb "github.com/cpssd/rabble/services/proto"
+)
+
+func newWebfingerDatabase() *MemoryDatabaseFake {
+	return &MemoryDatabaseFake{
+		users: []*pb.UsersEntry{{GlobalId: 1, Handle: "testuser"}},
+	}
+}
+
+func TestParseResourceURL(t *testing.T) {
+	tests := []struct {
+		handle, host string
+		wantHandle   string
+		wantHost     string
+	}{
+		{"https://rabble.test/ap/", "testuser", "testuser", "rabble.test"},
+		{"http://skinny:1916/#/", "testuser", "testuser", "skinny:1916"},
+		{"https://rabble.test/", "testuser", "testuser", "rabble.test"},
+	}
+	for _, tcase := range tests {
+		handle, host, err := parseResourceURL(tcase.handle, tcase.host)
+		if err != nil {
+			t.Errorf("parseResourceURL(%#v, %#v): unexpected error: %v",
+				tcase.handle, tcase.host, err)
+			continue
+		}
+		if handle != tcase.wantHandle || host != tcase.wantHost {
+			t.Errorf("parseResourceURL(%#v, %#v): expected (%#v, %#v), got (%#v, %#v)",
+				tcase.handle, tcase.host, tcase.wantHandle, tcase.wantHost, handle, host)
+		}
+	}
+
+	if _, _, err := parseResourceURL("https://rabble.test/c2s/", "testuser"); err == nil {
+		t.Errorf("Expected error for URL that is not an actor")
+	}
+}
+
+func TestWebfingerResources(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.database = newWebfingerDatabase()
+	handler := srv.newWebfingerHandler()
+
+	tests := []struct {
+		resource string
+		code     int
+	}{
+		{"acct:testuser@SKINNYTESTS", http.StatusOK},
+		{"http://SKINNYTESTS:191/ap/@testuser", http.StatusOK},
+		{"http://SKINNYTESTS:191/#/@testuser", http.StatusOK},
+		{"http://elsewhere.test/ap/@testuser", http.StatusNotFound},
+		{"acct:nobody@SKINNYTESTS", http.StatusNotFound},
+	}
+	for _, tcase := range tests {
+		req, _ := http.NewRequest("GET",
+			"/.well-known/webfinger?resource="+url.QueryEscape(tcase.resource), nil)
+		res := httptest.NewRecorder()
+		handler(res, req)
+
+		if res.Code != tcase.code {
+			t.Errorf("%#v: expected status %d, got %d", tcase.resource, tcase.code, res.Code)
+			continue
+		}
+		if tcase.code != http.StatusOK {
+			continue
+		}
+		var r webfinger.Resource
+		json.Unmarshal(res.Body.Bytes(), &r)
+		if r.Subject != "acct:testuser@SKINNYTESTS" {
+			t.Errorf("%#v: unexpected subject %#v", tcase.resource, r.Subject)
+		}
+		subscribe := r.Links[len(r.Links)-1]
+		if subscribe.Rel != ostatusSubscribeRel || !strings.HasSuffix(subscribe.Template, "/authorize_interaction?uri={uri}") {
+			t.Errorf("%#v: expected a subscribe template link, got %#v", tcase.resource, subscribe)
+		}
+	}
+}
+
+func TestHostMeta(t *testing.T) {
+	const template = "http://SKINNYTESTS:191/.well-known/webfinger?resource={uri}"
+	srv := newTestServerWrapper()
+
+	req, _ := http.NewRequest("GET", hostMetaPath, nil)
+	res := httptest.NewRecorder()
+	srv.handleHostMeta()(res, req)
+	var x hostMetaXRD
+	if err := xml.Unmarshal(res.Body.Bytes(), &x); err != nil {
+		t.Fatalf("Could not decode host-meta: %v", err)
+	}
+	if len(x.Links) != 1 || x.Links[0].Rel != "lrdd" || x.Links[0].Template != template {
+		t.Errorf("Unexpected host-meta links %#v", x.Links)
+	}
+
+	req, _ = http.NewRequest("GET", hostMetaJSONPath, nil)
+	res = httptest.NewRecorder()
+	srv.handleHostMetaJSON()(res, req)
+	var j struct {
+		Links []hostMetaLink `json:"links"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &j); err != nil {
+		t.Fatalf("Could not decode host-meta.json: %v", err)
+	}
+	if len(j.Links) != 1 || j.Links[0].Template != template {
+		t.Errorf("Unexpected host-meta.json links %#v", j.Links)
+	}
+}
+
+func TestWebfingerDecoys(t *testing.T) {
+	srv := newTestServerWrapper()
+	srv.database = newWebfingerDatabase()
+	srv.webfingerDecoys = true
+	handler := srv.newWebfingerHandler()
+
+	get := func(resource string) (*httptest.ResponseRecorder, time.Duration) {
+		req, _ := http.NewRequest("GET",
+			"/.well-known/webfinger?resource="+url.QueryEscape(resource), nil)
+		res := httptest.NewRecorder()
+		start := time.Now()
+		handler(res, req)
+		return res, time.Since(start)
+	}
+
+	found, foundTime := get("acct:testuser@SKINNYTESTS")
+	decoy, decoyTime := get("acct:nobody@SKINNYTESTS")
+	if found.Code != http.StatusOK || decoy.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for both real and decoy, got %d and %d",
+			found.Code, decoy.Code)
+	}
+	if foundTime < webfingerResponseTime || decoyTime < webfingerResponseTime {
+		t.Errorf("Expected responses to take at least %v, took %v and %v",
+			webfingerResponseTime, foundTime, decoyTime)
+	}
+
+	var r, d webfinger.Resource
+	json.Unmarshal(found.Body.Bytes(), &r)
+	json.Unmarshal(decoy.Body.Bytes(), &d)
+	if d.Subject != "acct:nobody@SKINNYTESTS" {
+		t.Errorf("Unexpected decoy subject %#v", d.Subject)
+	}
+	if len(d.Links) != len(r.Links) || len(d.Aliases) != len(r.Aliases) {
+		t.Errorf("Expected decoy to look like a real resource, got %#v", d)
+	}
+	for i := range r.Links {
+		if r.Links[i].Rel != d.Links[i].Rel || r.Links[i].Type != d.Links[i].Type {
+			t.Errorf("Decoy link %d differs: %#v vs %#v", i, d.Links[i], r.Links[i])
+		}
+	}
+
+	again, _ := get("acct:nobody@SKINNYTESTS")
+	if again.Body.String() != decoy.Body.String() {
+		t.Errorf("Expected decoys to be deterministic")
+	}
+
+	if other, _ := get("acct:nobody@elsewhere.test"); other.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a decoy on another host, got %d", other.Code)
+	}
+}
+
+func TestDecoyGlobalID(t *testing.T) {
+	wf := &wfResolver{users: newWebfingerDatabase(), decoyKey: []byte("key")}
+	other := &wfResolver{users: newWebfingerDatabase(), decoyKey: []byte("other key")}
+	ctx := context.Background()
+
+	differ := false
+	for _, handle := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		id, err := wf.decoyGlobalID(ctx, handle)
+		if err != nil {
+			t.Fatalf("decoyGlobalID(%#v): unexpected error %v", handle, err)
+		}
+		// testuser has global id 1.
+		if id < 2 || id > maxDecoyGlobalID {
+			t.Errorf("decoyGlobalID(%#v) = %d, want an unused id up to %d", handle, id, maxDecoyGlobalID)
+		}
+		if again, _ := wf.decoyGlobalID(ctx, handle); again != id {
+			t.Errorf("decoyGlobalID(%#v) gave %d then %d", handle, id, again)
+		}
+		if o, _ := other.decoyGlobalID(ctx, handle); o != id {
+			differ = true
+		}
+	}
+	if !differ {
+		t.Errorf("Expected decoy ids to depend on the key")
+	}
+}
+
+func TestLoadDecoyKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "decoy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+
+	key, err := loadDecoyKey(path)
+	if err != nil || len(key) != decoyKeySize {
+		t.Fatalf("Expected a new %d byte key, got %v, %v", decoyKeySize, key, err)
+	}
+	if again, err := loadDecoyKey(path); err != nil || !bytes.Equal(again, key) {
+		t.Errorf("Expected the stored key %v, got %v, %v", key, again, err)
+	}
+}